@@ -0,0 +1,124 @@
+package dns_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/acceptance-tests/testing/helpers"
+	testconsumerclient "github.com/cloudfoundry-incubator/consul-release/src/acceptance-tests/testing/testconsumer/client"
+	"github.com/pivotal-cf-experimental/bosh-test/bosh"
+	"github.com/pivotal-cf-experimental/destiny/consul"
+	"github.com/pivotal-cf-experimental/destiny/core"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DNS config", func() {
+	var (
+		manifest consul.Manifest
+		tcClient testconsumerclient.Client
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		manifest, _, err = helpers.DeployConsulWithInstanceCount(1, boshClient, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() ([]bosh.VM, error) {
+			return boshClient.DeploymentVMs(manifest.Name)
+		}, "1m", "10s").Should(ConsistOf(helpers.GetVMsFromManifest(manifest)))
+
+		tcClient = testconsumerclient.New(fmt.Sprintf("http://%s:6769", manifest.Jobs[1].Networks[0].StaticIPs[0]))
+	})
+
+	AfterEach(func() {
+		if !CurrentGinkgoTestDescription().Failed {
+			err := boshClient.DeleteDeployment(manifest.Name)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("serves records with the configured TTLs and only passing services", func() {
+		By("registering a service whose failing check only warns", func() {
+			healthCheck := fmt.Sprintf("curl -f http://%s:6769/health_check || exit 1", manifest.Jobs[1].Networks[0].StaticIPs[0])
+			manifest.Jobs[1].Properties = &core.JobProperties{
+				Consul: core.JobPropertiesConsul{
+					Agent: core.JobPropertiesConsulAgent{
+						Mode: "client",
+						Services: core.JobPropertiesConsulAgentServices{
+							"some-service": core.JobPropertiesConsulAgentService{
+								Check: &core.JobPropertiesConsulAgentServiceCheck{
+									Name:     "some-service-check",
+									Script:   healthCheck,
+									Interval: "10s",
+								},
+							},
+						},
+					},
+				},
+			}
+		})
+
+		By("deploying with DNS settings", func() {
+			yaml, err := manifest.ToYAML()
+			Expect(err).NotTo(HaveOccurred())
+
+			yaml, err = helpers.SetConsulAgentProperty(yaml, "dns_config", map[string]interface{}{
+				"node_ttl": "10s",
+				"service_ttl": map[string]interface{}{
+					"some-service": "30s",
+				},
+				"only_passing": true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			yaml, err = boshClient.ResolveManifestVersions(yaml)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = boshClient.Deploy(yaml)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() ([]bosh.VM, error) {
+				return boshClient.DeploymentVMs(manifest.Name)
+			}, "1m", "10s").Should(ConsistOf(helpers.GetVMsFromManifest(manifest)))
+		})
+
+		By("serving the service with its TTL", func() {
+			Eventually(func() ([]string, error) {
+				return tcClient.DNS("some-service.service.cf.internal")
+			}, "1m", "10s").Should(ConsistOf(manifest.Jobs[1].Networks[0].StaticIPs))
+
+			Expect(tcClient.DNSTTLs("some-service.service.cf.internal")).To(Equal([]int{30}))
+		})
+
+		By("serving the node with its TTL", func() {
+			nodeName := fmt.Sprintf("%s-0", strings.Replace(manifest.Jobs[1].Name, "_", "-", -1))
+
+			Expect(tcClient.DNSTTLs(fmt.Sprintf("%s.node.cf.internal", nodeName))).To(Equal([]int{10}))
+		})
+
+		By("causing the health check to warn", func() {
+			err := tcClient.SetHealthCheck(false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		By("no longer serving the service", func() {
+			Eventually(func() ([]string, error) {
+				return tcClient.DNS("some-service.service.cf.internal")
+			}, "1m", "10s").Should(BeEmpty())
+		})
+
+		By("causing the health check to pass", func() {
+			err := tcClient.SetHealthCheck(true)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		By("serving the service again", func() {
+			Eventually(func() ([]string, error) {
+				return tcClient.DNS("some-service.service.cf.internal")
+			}, "1m", "10s").Should(ConsistOf(manifest.Jobs[1].Networks[0].StaticIPs))
+		})
+	})
+})
@@ -1,6 +1,9 @@
 package helpers
 
 import (
+	"errors"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
 	"github.com/pivotal-cf-experimental/bosh-test/bosh"
 	"github.com/pivotal-cf-experimental/destiny/consul"
 )
@@ -17,3 +20,53 @@ func GetVMsFromManifest(manifest consul.Manifest) []bosh.VM {
 
 	return vms
 }
+
+// SetConsulAgentProperty sets consul.agent.<name> in the global properties
+// and in those of every job, for properties that destiny does not model.
+func SetConsulAgentProperty(manifestYAML []byte, name string, value interface{}) ([]byte, error) {
+	var manifest map[interface{}]interface{}
+	if err := candiedyaml.Unmarshal(manifestYAML, &manifest); err != nil {
+		return nil, err
+	}
+
+	if err := setConsulAgentProperty(manifest, name, value); err != nil {
+		return nil, err
+	}
+
+	jobs, _ := manifest["jobs"].([]interface{})
+	for _, job := range jobs {
+		job, ok := job.(map[interface{}]interface{})
+		if !ok {
+			return nil, errors.New("manifest jobs must be maps")
+		}
+
+		if _, ok := job["properties"]; !ok {
+			continue
+		}
+
+		if err := setConsulAgentProperty(job, name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return candiedyaml.Marshal(manifest)
+}
+
+func setConsulAgentProperty(parent map[interface{}]interface{}, name string, value interface{}) error {
+	for _, key := range []string{"properties", "consul", "agent"} {
+		child, ok := parent[key]
+		if !ok || child == nil {
+			child = map[interface{}]interface{}{}
+			parent[key] = child
+		}
+
+		parent, ok = child.(map[interface{}]interface{})
+		if !ok {
+			return errors.New(key + " must be a map")
+		}
+	}
+
+	parent[name] = value
+
+	return nil
+}
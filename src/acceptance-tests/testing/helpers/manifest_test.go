@@ -0,0 +1,78 @@
+package helpers_test
+
+import (
+	"github.com/cloudfoundry-incubator/consul-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("manifest", func() {
+	Describe("SetConsulAgentProperty", func() {
+		It("sets the property globally and on every job with properties", func() {
+			manifest, err := helpers.SetConsulAgentProperty([]byte(`---
+name: some-deployment
+jobs:
+- name: consul_z1
+  instances: 1
+- name: consul-test-consumer
+  instances: 1
+  properties:
+    consul:
+      agent:
+        mode: client
+properties:
+  consul:
+    agent:
+      domain: cf.internal
+`), "dns_config", map[string]interface{}{"only_passing": true})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manifest).To(MatchYAML(`---
+name: some-deployment
+jobs:
+- name: consul_z1
+  instances: 1
+- name: consul-test-consumer
+  instances: 1
+  properties:
+    consul:
+      agent:
+        mode: client
+        dns_config:
+          only_passing: true
+properties:
+  consul:
+    agent:
+      domain: cf.internal
+      dns_config:
+        only_passing: true
+`))
+		})
+
+		It("creates the global properties when there are none", func() {
+			manifest, err := helpers.SetConsulAgentProperty([]byte("name: some-deployment\n"), "recursor_timeout", "2s")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manifest).To(MatchYAML(`---
+name: some-deployment
+properties:
+  consul:
+    agent:
+      recursor_timeout: 2s
+`))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the manifest is not valid YAML", func() {
+				_, err := helpers.SetConsulAgentProperty([]byte("jobs: ["), "recursor_timeout", "2s")
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("returns an error when the consul properties are not a map", func() {
+				_, err := helpers.SetConsulAgentProperty([]byte("properties:\n  consul: some-string\n"), "recursor_timeout", "2s")
+				Expect(err).To(MatchError("consul must be a map"))
+			})
+		})
+	})
+})
@@ -38,6 +38,25 @@ func (c Client) DNS(serviceName string) ([]string, error) {
 	return addresses, nil
 }
 
+func (c Client) DNSTTLs(serviceName string) ([]int, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/dns_ttl?service=%s", c.url, serviceName))
+	if err != nil {
+		return []int{}, err
+	}
+
+	body, err := readBodyAndResponse(resp)
+	if err != nil {
+		return []int{}, err
+	}
+
+	var ttls []int
+	if err := json.Unmarshal(body, &ttls); err != nil {
+		return []int{}, err
+	}
+
+	return ttls, nil
+}
+
 func (c Client) SetHealthCheck(health bool) error {
 	resp, err := http.Post(fmt.Sprintf("%s/health_check", c.url),
 		"application/json",
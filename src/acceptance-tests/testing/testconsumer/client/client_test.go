@@ -134,4 +134,50 @@ var _ = Describe("client", func() {
 			})
 		})
 	})
+	Describe("DNSTTLs", func() {
+		It("returns the TTLs of the records for a service", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/dns_ttl" && req.Method == "GET" {
+					if req.URL.Query().Get("service") == "some-service-name" {
+						fmt.Fprint(w, `[30,30]`)
+						return
+					}
+				}
+
+				w.WriteHeader(http.StatusTeapot)
+			}))
+
+			tcClient := client.New(server.URL)
+
+			ttls, err := tcClient.DNSTTLs("some-service-name")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ttls).To(Equal([]int{30, 30}))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the response is not 200", func() {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprint(w, "DNS query failed with rcode 3")
+				}))
+
+				tcClient := client.New(server.URL)
+
+				_, err := tcClient.DNSTTLs("some-service-name")
+				Expect(err).To(MatchError("unexpected status: 500 Internal Server Error DNS query failed with rcode 3"))
+			})
+
+			It("returns an error when the json response is malformed", func() {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					fmt.Fprint(w, "%%%%%%%%%%%")
+				}))
+
+				tcClient := client.New(server.URL)
+
+				_, err := tcClient.DNSTTLs("some-service-name")
+				Expect(err).To(MatchError(ContainSubstring("invalid character")))
+			})
+		})
+	})
 })
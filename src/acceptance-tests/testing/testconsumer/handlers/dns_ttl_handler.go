@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	dnsTypeA   = 1
+	dnsClassIN = 1
+)
+
+// DNSTTLHandler reports the TTLs of the A records a DNS server returns for a
+// name, which the system resolver used by check-a-record does not expose.
+type DNSTTLHandler struct {
+	server string
+}
+
+func NewDNSTTLHandler(server string) DNSTTLHandler {
+	return DNSTTLHandler{
+		server: server,
+	}
+}
+
+func (d DNSTTLHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	serviceName := request.URL.Query().Get("service")
+
+	if serviceName == "" {
+		response.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(response, "service is a required parameter")
+		return
+	}
+
+	ttls, err := queryTTLs(d.server, serviceName)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(response, err.Error())
+		return
+	}
+
+	buf, err := json.Marshal(ttls)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(response, err.Error())
+		return
+	}
+
+	fmt.Fprint(response, string(buf))
+}
+
+func queryTTLs(server, name string) ([]uint32, error) {
+	conn, err := net.Dial("udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	id := uint16(rand.Intn(1 << 16))
+	query, err := dnsQuery(id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	answer := make([]byte, 65535)
+	n, err := conn.Read(answer)
+	if err != nil {
+		return nil, err
+	}
+
+	return dnsAnswerTTLs(id, answer[:n])
+}
+
+func dnsQuery(id uint16, name string) ([]byte, error) {
+	query := make([]byte, 12)
+	binary.BigEndian.PutUint16(query[0:], id)
+	binary.BigEndian.PutUint16(query[2:], 0x0100)
+	binary.BigEndian.PutUint16(query[4:], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid name %q", name)
+		}
+
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+
+	return append(query, 0, 0, dnsTypeA, 0, dnsClassIN), nil
+}
+
+func dnsAnswerTTLs(id uint16, answer []byte) ([]uint32, error) {
+	errMalformed := errors.New("malformed DNS answer")
+
+	if len(answer) < 12 {
+		return nil, errMalformed
+	}
+
+	if binary.BigEndian.Uint16(answer[0:]) != id {
+		return nil, errors.New("DNS answer does not match the query")
+	}
+
+	if rcode := answer[3] & 0x0f; rcode != 0 {
+		return nil, fmt.Errorf("DNS query failed with rcode %d", rcode)
+	}
+
+	questions := int(binary.BigEndian.Uint16(answer[4:]))
+	records := int(binary.BigEndian.Uint16(answer[6:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		offset = skipDNSName(answer, offset)
+		if offset < 0 || offset+4 > len(answer) {
+			return nil, errMalformed
+		}
+
+		offset += 4
+	}
+
+	ttls := []uint32{}
+	for i := 0; i < records; i++ {
+		offset = skipDNSName(answer, offset)
+		if offset < 0 || offset+10 > len(answer) {
+			return nil, errMalformed
+		}
+
+		recordType := binary.BigEndian.Uint16(answer[offset:])
+		ttl := binary.BigEndian.Uint32(answer[offset+4:])
+		length := int(binary.BigEndian.Uint16(answer[offset+8:]))
+
+		offset += 10 + length
+		if offset > len(answer) {
+			return nil, errMalformed
+		}
+
+		if recordType == dnsTypeA {
+			ttls = append(ttls, ttl)
+		}
+	}
+
+	return ttls, nil
+}
+
+// skipDNSName returns the offset after the name at offset, or -1 when the
+// name runs past the end of the message.
+func skipDNSName(message []byte, offset int) int {
+	for offset >= 0 && offset < len(message) {
+		length := int(message[offset])
+
+		switch {
+		case length == 0:
+			return offset + 1
+		case length&0xc0 == 0xc0:
+			return offset + 2
+		default:
+			offset += 1 + length
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,124 @@
+package handlers_test
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/acceptance-tests/testing/testconsumer/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func serveDNS(answer func(query []byte) []byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	go func() {
+		defer conn.Close()
+
+		buf := make([]byte, 512)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		conn.WriteTo(answer(buf[:n]), addr)
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func answerWithTTLs(rcode byte, ttls ...uint32) func([]byte) []byte {
+	return func(query []byte) []byte {
+		answer := append([]byte{}, query...)
+		answer[2] |= 0x80
+		answer[3] = rcode
+		binary.BigEndian.PutUint16(answer[6:], uint16(len(ttls)))
+
+		for i, ttl := range ttls {
+			record := []byte{0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 0, 0, 4, 127, 0, 0, byte(i + 2)}
+			binary.BigEndian.PutUint32(record[6:], ttl)
+			answer = append(answer, record...)
+		}
+
+		return answer
+	}
+}
+
+var _ = Describe("dns_ttl", func() {
+	It("returns the TTLs of the A records", func() {
+		server := serveDNS(answerWithTTLs(0, 30, 30))
+
+		request, err := http.NewRequest("GET", "/dns_ttl?service=some-service.service.cf.internal", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		handler := handlers.NewDNSTTLHandler(server)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(Equal(`[30,30]`))
+	})
+
+	It("returns an empty array when there are no records", func() {
+		server := serveDNS(answerWithTTLs(0))
+
+		request, err := http.NewRequest("GET", "/dns_ttl?service=some-service.service.cf.internal", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		handler := handlers.NewDNSTTLHandler(server)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(Equal(`[]`))
+	})
+
+	Context("failure cases", func() {
+		It("returns a 500 when the query fails", func() {
+			server := serveDNS(answerWithTTLs(3))
+
+			request, err := http.NewRequest("GET", "/dns_ttl?service=some-service.service.cf.internal", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			handler := handlers.NewDNSTTLHandler(server)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(Equal("DNS query failed with rcode 3"))
+		})
+
+		It("returns a 500 when the answer is truncated", func() {
+			server := serveDNS(func(query []byte) []byte {
+				answer := answerWithTTLs(0, 30)(query)
+				return answer[:len(answer)-6]
+			})
+
+			request, err := http.NewRequest("GET", "/dns_ttl?service=some-service.service.cf.internal", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			handler := handlers.NewDNSTTLHandler(server)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(Equal("malformed DNS answer"))
+		})
+
+		It("returns a 400 when no service has been provided", func() {
+			request, err := http.NewRequest("GET", "/dns_ttl", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			handler := handlers.NewDNSTTLHandler("")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(Equal("service is a required parameter"))
+		})
+	})
+})
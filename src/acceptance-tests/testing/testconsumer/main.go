@@ -15,7 +15,7 @@ import (
 )
 
 func main() {
-	port, consulURL, pathToCheckARecord := parseCommandLineFlags()
+	port, consulURL, pathToCheckARecord, dnsServer := parseCommandLineFlags()
 	proxyURL, err := url.Parse(consulURL)
 	if err != nil {
 		log.Fatal(err)
@@ -29,6 +29,7 @@ func main() {
 	logBuffer := bytes.NewBuffer([]byte{})
 	healthCheckHandler := handlers.NewHealthCheckHandler()
 	dnsHandler := handlers.NewDNSHandler(pathToCheckARecord)
+	dnsTTLHandler := handlers.NewDNSTTLHandler(dnsServer)
 
 	proxy := httputil.NewSingleHostReverseProxy(proxyURL)
 	director := proxy.Director
@@ -53,18 +54,24 @@ func main() {
 		dnsHandler.ServeHTTP(w, req)
 	})
 
+	mux.HandleFunc("/dns_ttl", func(w http.ResponseWriter, req *http.Request) {
+		dnsTTLHandler.ServeHTTP(w, req)
+	})
+
 	log.Fatal(http.ListenAndServe(fmt.Sprintf("0.0.0.0:%s", port), mux))
 }
 
-func parseCommandLineFlags() (string, string, string) {
+func parseCommandLineFlags() (string, string, string, string) {
 	var port string
 	var consulURL string
 	var pathToCheckARecord string
+	var dnsServer string
 
 	flag.StringVar(&port, "port", "", "port to use for test consumer server")
 	flag.StringVar(&consulURL, "consul-url", "", "url of local consul agent")
 	flag.StringVar(&pathToCheckARecord, "path-to-check-a-record", "", "path to check-a-record binary")
+	flag.StringVar(&dnsServer, "dns-server", "127.0.0.1:53", "address of the DNS server to report record TTLs from")
 	flag.Parse()
 
-	return port, consulURL, pathToCheckARecord
+	return port, consulURL, pathToCheckARecord, dnsServer
 }
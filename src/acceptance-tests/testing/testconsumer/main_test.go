@@ -123,6 +123,29 @@ var _ = Describe("Proxying consul requests", func() {
 		})
 	})
 
+	Context("dns_ttl", func() {
+		BeforeEach(func() {
+			dnsServer, err := net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			dnsAddress := dnsServer.LocalAddr().String()
+			Expect(dnsServer.Close()).To(Succeed())
+
+			command := exec.Command(pathToConsumer, "--port", port, "--consul-url", "127.0.0.1", "--path-to-check-a-record", pathToCheckARecord, "--dns-server", dnsAddress)
+
+			session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+
+			waitForServerToStart(port)
+		})
+
+		It("queries the configured DNS server", func() {
+			status, body, err := makeRequest("GET", fmt.Sprintf("http://localhost:%s/dns_ttl?service=something.service.cf.internal", port), "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(Equal(http.StatusInternalServerError))
+			Expect(body).To(ContainSubstring("connection refused"))
+		})
+	})
+
 	Context("with a functioning consul", func() {
 		BeforeEach(func() {
 			consulServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
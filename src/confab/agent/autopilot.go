@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const autopilotHealthPath = "/v1/operator/autopilot/health"
+
+// ErrAutopilotUnavailable is returned by AutopilotClient.Health when the
+// agent does not serve the autopilot health endpoint (consul < 0.9.0).
+var ErrAutopilotUnavailable = errors.New("autopilot health is not available")
+
+type AutopilotHealth struct {
+	Healthy          bool
+	FailureTolerance int
+	Servers          []AutopilotServerHealth
+}
+
+type AutopilotServerHealth struct {
+	ID      string
+	Name    string
+	Address string
+	Leader  bool
+	Voter   bool
+	Healthy bool
+}
+
+type AutopilotClient struct {
+	Address    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func (a AutopilotClient) Health() (AutopilotHealth, error) {
+	request, err := http.NewRequest("GET", fmt.Sprintf("http://%s%s", a.Address, autopilotHealthPath), nil)
+	if err != nil {
+		return AutopilotHealth{}, err
+	}
+
+	if a.Token != "" {
+		request.Header.Set("X-Consul-Token", a.Token)
+	}
+
+	response, err := a.HTTPClient.Do(request)
+	if err != nil {
+		return AutopilotHealth{}, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusTooManyRequests:
+		// consul answers 429 when the cluster is unhealthy, the body still
+		// carries the per-server report
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return AutopilotHealth{}, ErrAutopilotUnavailable
+	default:
+		return AutopilotHealth{}, fmt.Errorf("unexpected response from %s: %s", autopilotHealthPath, response.Status)
+	}
+
+	var health AutopilotHealth
+	if err := json.NewDecoder(response.Body).Decode(&health); err != nil {
+		return AutopilotHealth{}, errors.New(err.Error())
+	}
+
+	return health, nil
+}
@@ -0,0 +1,106 @@
+package agent_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AutopilotClient", func() {
+	var (
+		server    *httptest.Server
+		status    int
+		body      string
+		request   *http.Request
+		autopilot agent.AutopilotClient
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		body = `{
+			"Healthy": true,
+			"FailureTolerance": 1,
+			"Servers": [
+				{"ID": "id-0", "Name": "server-0", "Address": "10.0.0.1:8300", "Leader": true, "Voter": true, "Healthy": true},
+				{"ID": "id-1", "Name": "server-1", "Address": "10.0.0.2:8300", "Leader": false, "Voter": true, "Healthy": true}
+			]
+		}`
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request = r
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+
+		autopilot = agent.AutopilotClient{
+			Address:    strings.TrimPrefix(server.URL, "http://"),
+			Token:      "some-token",
+			HTTPClient: http.DefaultClient,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("returns the autopilot server health", func() {
+		health, err := autopilot.Health()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(request.URL.Path).To(Equal("/v1/operator/autopilot/health"))
+		Expect(request.Header.Get("X-Consul-Token")).To(Equal("some-token"))
+		Expect(health).To(Equal(agent.AutopilotHealth{
+			Healthy:          true,
+			FailureTolerance: 1,
+			Servers: []agent.AutopilotServerHealth{
+				{ID: "id-0", Name: "server-0", Address: "10.0.0.1:8300", Leader: true, Voter: true, Healthy: true},
+				{ID: "id-1", Name: "server-1", Address: "10.0.0.2:8300", Voter: true, Healthy: true},
+			},
+		}))
+	})
+
+	It("decodes the report of an unhealthy cluster", func() {
+		status = http.StatusTooManyRequests
+		body = `{"Healthy": false, "Servers": [{"Name": "server-0", "Healthy": false}]}`
+
+		health, err := autopilot.Health()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(health.Healthy).To(BeFalse())
+		Expect(health.Servers).To(HaveLen(1))
+	})
+
+	Context("failure cases", func() {
+		It("returns ErrAutopilotUnavailable when the endpoint does not exist", func() {
+			status = http.StatusNotFound
+			body = ""
+
+			_, err := autopilot.Health()
+			Expect(err).To(Equal(agent.ErrAutopilotUnavailable))
+		})
+
+		It("returns an error on an unexpected status", func() {
+			status = http.StatusInternalServerError
+
+			_, err := autopilot.Health()
+			Expect(err).To(MatchError("unexpected response from /v1/operator/autopilot/health: 500 Internal Server Error"))
+		})
+
+		It("returns an error on malformed json", func() {
+			body = "%%%"
+
+			_, err := autopilot.Health()
+			Expect(err).To(MatchError(ContainSubstring("invalid character")))
+		})
+
+		It("returns an error when the agent cannot be reached", func() {
+			server.Close()
+
+			_, err := autopilot.Health()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
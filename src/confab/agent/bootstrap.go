@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pivotal-golang/lager"
+)
+
+const statusLeaderPath = "/v1/status/leader"
+
+// ClusterDetector tells a server that is about to start whether a cluster
+// already exists, in which case the server has to join it rather than
+// bootstrap a new one.
+type ClusterDetector struct {
+	DataDir    string
+	Port       int
+	HTTPClient *http.Client
+	Logger     logger
+}
+
+// HasRaftState reports whether the data dir holds raft state from an earlier
+// run of the server.
+func (d ClusterDetector) HasRaftState() bool {
+	_, err := os.Stat(filepath.Join(d.DataDir, "raft", "raft.db"))
+	return err == nil
+}
+
+// Leader asks the HTTP API of each of the servers for the cluster leader and
+// returns the first one reported. Servers that cannot be reached or have no
+// leader yet are skipped and the failures logged, so an empty result means
+// no established cluster could be found. The servers are expected to serve
+// their HTTP API on the same port as this one, on an address other hosts
+// can reach.
+func (d ClusterDetector) Leader(servers []string) string {
+	type probe struct {
+		server string
+		leader string
+		err    error
+	}
+
+	probes := make(chan probe, len(servers))
+	for _, server := range servers {
+		go func(server string) {
+			leader, err := d.leader(server)
+			probes <- probe{server: server, leader: leader, err: err}
+		}(server)
+	}
+
+	var found string
+	for range servers {
+		p := <-probes
+		if p.err != nil {
+			d.Logger.Error("cluster-detector.leader.probe.failed", p.err, lager.Data{
+				"server": p.server,
+			})
+			continue
+		}
+
+		if p.leader != "" && found == "" {
+			found = p.leader
+		}
+	}
+
+	return found
+}
+
+func (d ClusterDetector) leader(server string) (string, error) {
+	host := server
+	if h, _, err := net.SplitHostPort(server); err == nil {
+		host = h
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(d.Port))
+	response, err := d.HTTPClient.Get("http://" + address + statusLeaderPath)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from %s%s: %s", address, statusLeaderPath, response.Status)
+	}
+
+	var leader string
+	if err := json.NewDecoder(response.Body).Decode(&leader); err != nil {
+		return "", err
+	}
+
+	return leader, nil
+}
@@ -0,0 +1,111 @@
+package agent_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ClusterDetector", func() {
+	var (
+		dataDir  string
+		logger   *fakes.Logger
+		detector agent.ClusterDetector
+	)
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = ioutil.TempDir("", "data-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		logger = &fakes.Logger{}
+		detector = agent.ClusterDetector{
+			DataDir:    dataDir,
+			HTTPClient: http.DefaultClient,
+			Logger:     logger,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	Describe("HasRaftState", func() {
+		It("reports whether the data dir holds a raft database", func() {
+			Expect(detector.HasRaftState()).To(BeFalse())
+
+			Expect(os.MkdirAll(filepath.Join(dataDir, "raft"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dataDir, "raft", "raft.db"), []byte{}, 0600)).To(Succeed())
+			Expect(detector.HasRaftState()).To(BeTrue())
+		})
+	})
+
+	Describe("Leader", func() {
+		var (
+			server *httptest.Server
+			status int
+			body   string
+			path   string
+		)
+
+		BeforeEach(func() {
+			status = http.StatusOK
+			body = `"10.0.0.1:8300"`
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				w.WriteHeader(status)
+				w.Write([]byte(body))
+			}))
+
+			_, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+			Expect(err).NotTo(HaveOccurred())
+			detector.Port, err = strconv.Atoi(port)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("returns the leader reported by a reachable server", func() {
+			Expect(detector.Leader([]string{"127.0.0.1:8301"})).To(Equal("10.0.0.1:8300"))
+			Expect(path).To(Equal("/v1/status/leader"))
+		})
+
+		It("returns nothing when the servers have no leader yet", func() {
+			body = `""`
+			Expect(detector.Leader([]string{"127.0.0.1"})).To(BeEmpty())
+		})
+
+		It("ignores servers that do not answer and logs why", func() {
+			status = http.StatusInternalServerError
+			Expect(detector.Leader([]string{"127.0.0.1"})).To(BeEmpty())
+			Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+				Action: "cluster-detector.leader.probe.failed",
+				Error:  fmt.Errorf("unexpected response from 127.0.0.1:%d/v1/status/leader: 500 Internal Server Error", detector.Port),
+				Data: []lager.Data{{
+					"server": "127.0.0.1",
+				}},
+			}))
+
+			server.Close()
+			Expect(detector.Leader([]string{"127.0.0.1"})).To(BeEmpty())
+			Expect(logger.Messages).To(HaveLen(2))
+			Expect(logger.Messages[1].Action).To(Equal("cluster-detector.leader.probe.failed"))
+		})
+	})
+})
@@ -1,16 +1,21 @@
 package agent
 
 import (
-	"crypto/sha1"
-	"encoding/base64"
 	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
 
-	"golang.org/x/crypto/pbkdf2"
-
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/keyring"
 	"github.com/hashicorp/consul/api"
 	"github.com/pivotal-golang/lager"
 )
 
+// memberStatusAlive is serf's StatusAlive as reported by the agent API.
+const memberStatusAlive = 1
+
 type logger interface {
 	Info(action string, data ...lager.Data)
 	Error(action string, err error, data ...lager.Data)
@@ -18,6 +23,25 @@ type logger interface {
 
 type consulAPIAgent interface {
 	Members(wan bool) ([]*api.AgentMember, error)
+	Self() (map[string]map[string]interface{}, error)
+	Services() (map[string]*api.AgentService, error)
+	Checks() (map[string]*api.AgentCheck, error)
+	EnableNodeMaintenance(reason string) error
+	DisableNodeMaintenance() error
+	EnableServiceMaintenance(serviceID, reason string) error
+	DisableServiceMaintenance(serviceID string) error
+}
+
+type metrics interface {
+	IncrCounter(key []string, val float32)
+}
+
+type consulACL interface {
+	Update(acl *api.ACLEntry, q *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+type autopilot interface {
+	Health() (AutopilotHealth, error)
 }
 
 type ConsulRPCClient interface {
@@ -29,14 +53,38 @@ type ConsulRPCClient interface {
 	Leave() error
 }
 
+// ForeignServersError is returned by VerifyJoined when the agent sees servers
+// that are not part of the expected cluster. Retrying does not help, the
+// agent has to be pointed at the right servers.
+type ForeignServersError struct {
+	Servers []string
+}
+
+func (e ForeignServersError) Error() string {
+	return fmt.Sprintf("joined a foreign cluster, unexpected servers: %s", strings.Join(e.Servers, ", "))
+}
+
 type Client struct {
 	ExpectedMembers []string
+	Datacenter      string
+	MinServers      int
+	EncryptStage    string
 	ConsulAPIAgent  consulAPIAgent
 	ConsulRPCClient ConsulRPCClient
+	ConsulACL       consulACL
+	ConsulHealth    consulHealth
+	Resolver        config.Resolver
+	Autopilot       autopilot
 	Logger          logger
+	Metrics         metrics
 }
 
 func (c Client) VerifyJoined() error {
+	expected, err := c.expectedMembers("agent-client.verify-joined")
+	if err != nil {
+		return err
+	}
+
 	c.Logger.Info("agent-client.verify-joined.members.request", lager.Data{
 		"wan": false,
 	})
@@ -59,14 +107,59 @@ func (c Client) VerifyJoined() error {
 		"members": addresses,
 	})
 
+	// Servers of our datacenter that are not expected are only reported: they
+	// may have been added before this node's server list was updated, or be
+	// missing from a partial DNS answer. They do not count as joined servers.
+	var servers, unexpected, foreign []string
 	for _, member := range members {
-		if member.Tags["role"] == "consul" {
-			c.Logger.Info("agent-client.verify-joined.members.joined")
-			return nil
+		if member.Tags["role"] != "consul" {
+			continue
 		}
+
+		switch {
+		case c.Datacenter != "" && member.Tags["dc"] != c.Datacenter:
+			foreign = append(foreign, fmt.Sprintf("%s (datacenter %q)", member.Addr, member.Tags["dc"]))
+		case len(expected) > 0 && !isExpectedMember(expected, member.Addr):
+			unexpected = append(unexpected, member.Addr)
+		case member.Status == memberStatusAlive:
+			servers = append(servers, member.Addr)
+		}
+	}
+
+	if len(unexpected) > 0 {
+		c.Logger.Info("agent-client.verify-joined.members.unexpected-servers", lager.Data{
+			"expected":   expected,
+			"unexpected": unexpected,
+		})
+	}
+
+	if len(foreign) > 0 {
+		err = ForeignServersError{Servers: foreign}
+		c.Logger.Error("agent-client.verify-joined.members.foreign-servers", err, lager.Data{
+			"wan":     false,
+			"members": addresses,
+			"foreign": foreign,
+		})
+		return err
+	}
+
+	minServers := c.MinServers
+	if minServers < 1 {
+		minServers = 1
+	}
+
+	if len(servers) >= minServers {
+		c.Logger.Info("agent-client.verify-joined.members.joined", lager.Data{
+			"servers": servers,
+		})
+		return nil
 	}
 
 	err = errors.New("no expected members")
+	if len(servers) > 0 {
+		err = fmt.Errorf("%d of at least %d expected servers are alive", len(servers), minServers)
+	}
+
 	c.Logger.Error("agent-client.verify-joined.members.not-joined", err, lager.Data{
 		"wan":     false,
 		"members": addresses,
@@ -75,7 +168,56 @@ func (c Client) VerifyJoined() error {
 	return err
 }
 
+// expectedMembers returns ExpectedMembers, resolved again on every call when
+// a Resolver is set so that servers listed by name can change.
+func (c Client) expectedMembers(action string) ([]string, error) {
+	if c.Resolver == nil {
+		return c.ExpectedMembers, nil
+	}
+
+	members, err := config.ResolveServers(c.Resolver, c.ExpectedMembers)
+	if err != nil {
+		c.Logger.Error(action+".resolve-servers.failed", err, lager.Data{
+			"servers": c.ExpectedMembers,
+		})
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// isExpectedMember reports whether addr is one of the expected members, which
+// may carry a port.
+func isExpectedMember(expected []string, addr string) bool {
+	for _, member := range expected {
+		if host, _, err := net.SplitHostPort(member); err == nil {
+			member = host
+		}
+
+		if member == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c Client) VerifySynced() error {
+	if c.Autopilot != nil {
+		c.Logger.Info("agent-client.verify-synced.autopilot-health.request")
+
+		health, err := c.Autopilot.Health()
+		switch {
+		case err == ErrAutopilotUnavailable:
+			c.Logger.Info("agent-client.verify-synced.autopilot-health.unavailable")
+		case err != nil:
+			c.Logger.Error("agent-client.verify-synced.autopilot-health.request.failed", err)
+			return err
+		default:
+			return c.verifyAutopilotHealth(health)
+		}
+	}
+
 	c.Logger.Info("agent-client.verify-synced.stats.request")
 
 	stats, err := c.ConsulRPCClient.Stats()
@@ -108,7 +250,48 @@ func (c Client) VerifySynced() error {
 	return nil
 }
 
+func (c Client) verifyAutopilotHealth(health AutopilotHealth) error {
+	var leader string
+	var unhealthy []string
+	for _, server := range health.Servers {
+		if server.Leader {
+			leader = server.Name
+		}
+
+		if !server.Healthy {
+			unhealthy = append(unhealthy, server.Name)
+		}
+	}
+
+	c.Logger.Info("agent-client.verify-synced.autopilot-health.response", lager.Data{
+		"healthy":           health.Healthy,
+		"failure_tolerance": health.FailureTolerance,
+		"leader":            leader,
+		"unhealthy":         unhealthy,
+	})
+
+	if leader == "" {
+		err := errors.New("autopilot reports no leader")
+		c.Logger.Error("agent-client.verify-synced.no-leader", err)
+		return err
+	}
+
+	if !health.Healthy {
+		err := fmt.Errorf("autopilot reports unhealthy servers: %s", strings.Join(unhealthy, ", "))
+		c.Logger.Error("agent-client.verify-synced.unhealthy", err)
+		return err
+	}
+
+	c.Logger.Info("agent-client.verify-synced.synced")
+	return nil
+}
+
 func (c Client) IsLastNode() (bool, error) {
+	expected, err := c.expectedMembers("agent-client.is-last-node")
+	if err != nil {
+		return false, err
+	}
+
 	c.Logger.Info("agent-client.is-last-node.members.request", lager.Data{
 		"wan": false,
 	})
@@ -138,17 +321,125 @@ func (c Client) IsLastNode() (bool, error) {
 		}
 	}
 
-	hasAllExpectedMembers := serversCount == len(c.ExpectedMembers)
+	hasAllExpectedMembers := serversCount == len(expected)
 
 	c.Logger.Info("agent-client.is-last-node.result", lager.Data{
 		"actual_members_count":   serversCount,
-		"expected_members_count": len(c.ExpectedMembers),
+		"expected_members_count": len(expected),
 		"is_last_node":           hasAllExpectedMembers,
 	})
 
 	return hasAllExpectedMembers, nil
 }
 
+type Status struct {
+	LANMembers      int
+	LANServers      int
+	ExpectedServers int
+	Raft            bool
+	CommitIndex     int64
+	LastLogIndex    int64
+	KeyringKeys     int
+	EncryptStage    string
+}
+
+// Status gathers the membership, raft and keyring state reported by the
+// agent. Raft and keyring state are only collected when an RPC client is set,
+// and the keyring is left alone while encryption is in the accept stage.
+func (c Client) Status() (Status, error) {
+	expected, err := c.expectedMembers("agent-client.status")
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := Status{
+		ExpectedServers: len(expected),
+		EncryptStage:    c.EncryptStage,
+	}
+
+	c.Logger.Info("agent-client.status.members.request", lager.Data{
+		"wan": false,
+	})
+
+	members, err := c.ConsulAPIAgent.Members(false)
+	if err != nil {
+		c.Logger.Error("agent-client.status.members.request.failed", err, lager.Data{
+			"wan": false,
+		})
+		return Status{}, err
+	}
+
+	for _, member := range members {
+		status.LANMembers++
+		if member.Tags["role"] == "consul" && member.Status == memberStatusAlive {
+			status.LANServers++
+		}
+	}
+
+	if c.ConsulRPCClient == nil {
+		c.Logger.Info("agent-client.status.success", lager.Data{
+			"status": status,
+		})
+		return status, nil
+	}
+
+	c.Logger.Info("agent-client.status.stats.request")
+	stats, err := c.ConsulRPCClient.Stats()
+	if err != nil {
+		c.Logger.Error("agent-client.status.stats.request.failed", err)
+		return Status{}, err
+	}
+
+	if raft, ok := stats["raft"]; ok {
+		status.Raft = true
+		status.CommitIndex, _ = strconv.ParseInt(raft["commit_index"], 10, 64)
+		status.LastLogIndex, _ = strconv.ParseInt(raft["last_log_index"], 10, 64)
+	}
+
+	if c.EncryptStage == config.EncryptStageAccept {
+		c.Logger.Info("agent-client.status.success", lager.Data{
+			"status": status,
+		})
+		return status, nil
+	}
+
+	c.Logger.Info("agent-client.status.list-keys.request")
+	keys, err := c.ConsulRPCClient.ListKeys()
+	if err != nil {
+		c.Logger.Error("agent-client.status.list-keys.request.failed", err)
+		return Status{}, err
+	}
+	status.KeyringKeys = len(keys)
+
+	c.Logger.Info("agent-client.status.success", lager.Data{
+		"status": status,
+	})
+	return status, nil
+}
+
+func (c Client) Version() (string, error) {
+	c.Logger.Info("agent-client.version.self.request")
+
+	self, err := c.ConsulAPIAgent.Self()
+	if err != nil {
+		c.Logger.Error("agent-client.version.self.request.failed", err)
+		return "", err
+	}
+
+	version, ok := self["Config"]["Version"].(string)
+	if !ok {
+		err = errors.New("agent self did not include a version")
+		c.Logger.Error("agent-client.version.self.missing-version", err)
+		return "", err
+	}
+
+	c.Logger.Info("agent-client.version.self.response", lager.Data{
+		"version": version,
+	})
+
+	return version, nil
+}
+
 func (c Client) SetKeys(keys []string) error {
 	if keys == nil {
 		err := errors.New("must provide a non-nil slice of keys")
@@ -162,20 +453,18 @@ func (c Client) SetKeys(keys []string) error {
 		return err
 	}
 
-	c.Logger.Info("agent-client.set-keys.list-keys.request")
-
-	var encryptedKeys []string
-	for _, key := range keys {
-		encryptedKey := key
-
-		decodedKey, err := base64.StdEncoding.DecodeString(key)
-		if err != nil || len(decodedKey) != 16 {
-			encryptedKey = base64.StdEncoding.EncodeToString(pbkdf2.Key([]byte(key), []byte(""), 20000, 16, sha1.New))
-		}
-
-		encryptedKeys = append(encryptedKeys, encryptedKey)
+	// Members that have not been given the key yet cannot take part in the
+	// cluster-wide keyring operations, so they wait until the send stage.
+	if c.EncryptStage == config.EncryptStageAccept {
+		c.Logger.Info("agent-client.set-keys.skip", lager.Data{
+			"encrypt_stage": c.EncryptStage,
+		})
+		return nil
 	}
 
+	encryptedKeys := keyring.Keys(keys)
+
+	c.Logger.Info("agent-client.set-keys.list-keys.request")
 	existingKeys, err := c.ConsulRPCClient.ListKeys()
 	if err != nil {
 		c.Logger.Error("agent-client.set-keys.list-keys.request.failed", err)
@@ -183,65 +472,88 @@ func (c Client) SetKeys(keys []string) error {
 	}
 
 	c.Logger.Info("agent-client.set-keys.list-keys.response", lager.Data{
-		"keys": existingKeys,
+		"fingerprints": keyring.KeyFingerprints(existingKeys),
 	})
 
 	for _, key := range existingKeys {
 		if !containsString(encryptedKeys, key) {
-			c.Logger.Info("agent-client.set-keys.remove-key.request", lager.Data{
-				"key": key,
-			})
+			data := lager.Data{
+				"fingerprint": keyring.KeyFingerprint(key),
+			}
+
+			c.Logger.Info("agent-client.set-keys.remove-key.request", data)
 			err := c.ConsulRPCClient.RemoveKey(key)
 			if err != nil {
-				c.Logger.Error("agent-client.set-keys.remove-key.request.failed", err, lager.Data{
-					"key": key,
-				})
+				c.Logger.Error("agent-client.set-keys.remove-key.request.failed", err, data)
 				return err
 			}
-			c.Logger.Info("agent-client.set-keys.remove-key.response", lager.Data{
-				"key": key,
-			})
+			c.Metrics.IncrCounter([]string{"keyring", "remove"}, 1)
+			c.Logger.Info("agent-client.set-keys.remove-key.response", data)
 		}
 	}
 
 	for _, key := range encryptedKeys {
-		c.Logger.Info("agent-client.set-keys.install-key.request", lager.Data{
-			"key": key,
-		})
+		data := lager.Data{
+			"fingerprint": keyring.KeyFingerprint(key),
+		}
 
+		c.Logger.Info("agent-client.set-keys.install-key.request", data)
 		err := c.ConsulRPCClient.InstallKey(key)
 		if err != nil {
-			c.Logger.Error("agent-client.set-keys.install-key.request.failed", err, lager.Data{
-				"key": key,
-			})
+			c.Logger.Error("agent-client.set-keys.install-key.request.failed", err, data)
 			return err
 		}
 
-		c.Logger.Info("agent-client.set-keys.install-key.response", lager.Data{
-			"key": key,
-		})
+		c.Metrics.IncrCounter([]string{"keyring", "install"}, 1)
+		c.Logger.Info("agent-client.set-keys.install-key.response", data)
 	}
 
-	c.Logger.Info("agent-client.set-keys.use-key.request", lager.Data{
-		"key": encryptedKeys[0],
-	})
+	data := lager.Data{
+		"fingerprint": keyring.KeyFingerprint(encryptedKeys[0]),
+	}
 
+	c.Logger.Info("agent-client.set-keys.use-key.request", data)
 	err = c.ConsulRPCClient.UseKey(encryptedKeys[0])
 	if err != nil {
-		c.Logger.Error("agent-client.set-keys.use-key.request.failed", err, lager.Data{
-			"key": encryptedKeys[0],
-		})
+		c.Logger.Error("agent-client.set-keys.use-key.request.failed", err, data)
 		return err
 	}
 
-	c.Logger.Info("agent-client.set-keys.use-key.response", lager.Data{
-		"key": encryptedKeys[0],
-	})
+	c.Metrics.IncrCounter([]string{"keyring", "use"}, 1)
+	c.Logger.Info("agent-client.set-keys.use-key.response", data)
 
 	c.Logger.Info("agent-client.set-keys.success")
 	return nil
 }
 
+func (c Client) BootstrapACLs(policies []config.ACLPolicy) error {
+	for _, policy := range policies {
+		c.Logger.Info("agent-client.bootstrap-acls.update.request", lager.Data{
+			"name": policy.Name,
+		})
+
+		_, err := c.ConsulACL.Update(&api.ACLEntry{
+			ID:    policy.Token,
+			Name:  policy.Name,
+			Type:  api.ACLClientType,
+			Rules: policy.Rules,
+		}, nil)
+		if err != nil {
+			c.Logger.Error("agent-client.bootstrap-acls.update.request.failed", err, lager.Data{
+				"name": policy.Name,
+			})
+			return err
+		}
+
+		c.Logger.Info("agent-client.bootstrap-acls.update.response", lager.Data{
+			"name": policy.Name,
+		})
+	}
+
+	c.Logger.Info("agent-client.bootstrap-acls.success")
+	return nil
+}
+
 func (c Client) Leave() error {
 	if c.ConsulRPCClient == nil {
 		err := errors.New("consul rpc client is nil")
@@ -2,9 +2,12 @@ package agent_test
 
 import (
 	"errors"
+	"net"
 
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/keyring"
 	"github.com/hashicorp/consul/api"
 	"github.com/pivotal-golang/lager"
 
@@ -17,6 +20,8 @@ var _ = Describe("Client", func() {
 	var (
 		consulAPIAgent  *fakes.FakeconsulAPIAgent
 		consulRPCClient *fakes.FakeconsulRPCClient
+		consulACL       *fakes.FakeconsulACL
+		metrics         *fakes.Metrics
 		logger          *fakes.Logger
 		client          agent.Client
 	)
@@ -24,11 +29,15 @@ var _ = Describe("Client", func() {
 	BeforeEach(func() {
 		consulAPIAgent = &fakes.FakeconsulAPIAgent{}
 		consulRPCClient = &fakes.FakeconsulRPCClient{}
+		consulACL = &fakes.FakeconsulACL{}
+		metrics = &fakes.Metrics{}
 		logger = &fakes.Logger{}
 		client = agent.Client{
 			ConsulAPIAgent:  consulAPIAgent,
 			ConsulRPCClient: consulRPCClient,
+			ConsulACL:       consulACL,
 			Logger:          logger,
+			Metrics:         metrics,
 		}
 	})
 
@@ -38,19 +47,22 @@ var _ = Describe("Client", func() {
 				client.ExpectedMembers = []string{"member1", "member2", "member3"}
 				consulAPIAgent.MembersReturns([]*api.AgentMember{
 					&api.AgentMember{
-						Addr: "member1",
+						Addr:   "member1",
+						Status: 1,
 						Tags: map[string]string{
 							"role": "consul",
 						},
 					},
 					&api.AgentMember{
-						Addr: "member2",
+						Addr:   "member2",
+						Status: 1,
 						Tags: map[string]string{
 							"role": "consul",
 						},
 					},
 					&api.AgentMember{
-						Addr: "member3",
+						Addr:   "member3",
+						Status: 1,
 						Tags: map[string]string{
 							"role": "consul",
 						},
@@ -76,11 +88,132 @@ var _ = Describe("Client", func() {
 					},
 					{
 						Action: "agent-client.verify-joined.members.joined",
+						Data: []lager.Data{{
+							"servers": []string{"member1", "member2", "member3"},
+						}},
 					},
 				}))
 			})
 		})
 
+		Context("when verifying the servers more strictly", func() {
+			var members []*api.AgentMember
+
+			BeforeEach(func() {
+				client.ExpectedMembers = []string{"10.0.0.1", "10.0.0.2:8301", "10.0.0.3"}
+				client.Datacenter = "dc1"
+				client.MinServers = 2
+
+				members = []*api.AgentMember{
+					{Addr: "10.0.0.1", Status: 1, Tags: map[string]string{"role": "consul", "dc": "dc1"}},
+					{Addr: "10.0.0.2", Status: 1, Tags: map[string]string{"role": "consul", "dc": "dc1"}},
+					{Addr: "10.0.0.3", Status: 4, Tags: map[string]string{"role": "consul", "dc": "dc1"}},
+					{Addr: "10.0.0.4", Status: 1, Tags: map[string]string{"role": "node", "dc": "dc1"}},
+				}
+			})
+
+			It("resolves servers listed by name again on every call", func() {
+				resolver := &fakes.Resolver{}
+				resolver.LookupHostCall.Returns.Addresses = map[string][]string{
+					"consul.service.internal": {"10.0.0.1"},
+				}
+				client.Resolver = resolver
+				client.ExpectedMembers = []string{"consul.service.internal"}
+				client.MinServers = 1
+				consulAPIAgent.MembersReturns(members[:1], nil)
+
+				Expect(client.VerifyJoined()).To(Succeed())
+
+				resolver.LookupHostCall.Returns.Addresses["consul.service.internal"] = []string{"10.0.0.2"}
+				Expect(client.VerifyJoined()).To(MatchError("no expected members"))
+				Expect(resolver.LookupHostCall.CallCount).To(Equal(2))
+			})
+
+			It("returns an error when the servers cannot be resolved", func() {
+				resolver := &fakes.Resolver{}
+				resolver.LookupHostCall.Returns.Error = errors.New("lookup failed")
+				client.Resolver = resolver
+				client.ExpectedMembers = []string{"consul.service.internal"}
+
+				err := client.VerifyJoined()
+				Expect(err).To(MatchError(`resolving server "consul.service.internal": lookup failed`))
+				Expect(consulAPIAgent.MembersCallCount()).To(Equal(0))
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "agent-client.verify-joined.resolve-servers.failed",
+					Error:  err,
+					Data: []lager.Data{{
+						"servers": []string{"consul.service.internal"},
+					}},
+				}))
+			})
+
+			It("succeeds once enough expected servers are alive", func() {
+				consulAPIAgent.MembersReturns(members, nil)
+
+				Expect(client.VerifyJoined()).To(Succeed())
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "agent-client.verify-joined.members.joined",
+					Data: []lager.Data{{
+						"servers": []string{"10.0.0.1", "10.0.0.2"},
+					}},
+				}))
+			})
+
+			It("returns an error when too few expected servers are alive", func() {
+				members[1].Status = 3
+				consulAPIAgent.MembersReturns(members, nil)
+
+				Expect(client.VerifyJoined()).To(MatchError("1 of at least 2 expected servers are alive"))
+			})
+
+			It("lists the servers of another datacenter", func() {
+				members = append(members,
+					&api.AgentMember{Addr: "10.0.0.1", Status: 1, Tags: map[string]string{"role": "consul", "dc": "dc2"}},
+					&api.AgentMember{Addr: "10.0.0.8", Status: 1, Tags: map[string]string{"role": "consul", "dc": "dc3"}},
+				)
+				consulAPIAgent.MembersReturns(members, nil)
+
+				err := client.VerifyJoined()
+				Expect(err).To(BeAssignableToTypeOf(agent.ForeignServersError{}))
+				Expect(err).To(MatchError(`joined a foreign cluster, unexpected servers: 10.0.0.1 (datacenter "dc2"), 10.0.0.8 (datacenter "dc3")`))
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "agent-client.verify-joined.members.foreign-servers",
+					Error:  err,
+					Data: []lager.Data{{
+						"wan":     false,
+						"members": []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.1", "10.0.0.8"},
+						"foreign": []string{`10.0.0.1 (datacenter "dc2")`, `10.0.0.8 (datacenter "dc3")`},
+					}},
+				}))
+			})
+
+			It("reports servers of the datacenter that are not expected without counting them", func() {
+				members = append(members,
+					&api.AgentMember{Addr: "10.0.0.9", Status: 1, Tags: map[string]string{"role": "consul", "dc": "dc1"}},
+				)
+				consulAPIAgent.MembersReturns(members, nil)
+
+				Expect(client.VerifyJoined()).To(Succeed())
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "agent-client.verify-joined.members.unexpected-servers",
+					Data: []lager.Data{{
+						"expected":   []string{"10.0.0.1", "10.0.0.2:8301", "10.0.0.3"},
+						"unexpected": []string{"10.0.0.9"},
+					}},
+				}))
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "agent-client.verify-joined.members.joined",
+					Data: []lager.Data{{
+						"servers": []string{"10.0.0.1", "10.0.0.2"},
+					}},
+				}))
+
+				members[1].Status = 3
+				consulAPIAgent.MembersReturns(members, nil)
+				Expect(client.VerifyJoined()).To(MatchError("1 of at least 2 expected servers are alive"))
+			})
+		})
+
 		Context("when the members are all strangers", func() {
 			It("returns an error", func() {
 				client.ExpectedMembers = []string{"member1", "member2", "member3"}
@@ -258,6 +391,108 @@ var _ = Describe("Client", func() {
 				}))
 			})
 		})
+
+		Context("when autopilot health is available", func() {
+			var autopilot *fakes.Autopilot
+
+			BeforeEach(func() {
+				autopilot = &fakes.Autopilot{}
+				autopilot.HealthCall.Returns.Health = agent.AutopilotHealth{
+					Healthy:          true,
+					FailureTolerance: 1,
+					Servers: []agent.AutopilotServerHealth{
+						{Name: "server-0", Leader: true, Healthy: true},
+						{Name: "server-1", Healthy: true},
+						{Name: "server-2", Healthy: true},
+					},
+				}
+				client.Autopilot = autopilot
+			})
+
+			It("verifies the servers are healthy without consulting the raft stats", func() {
+				Expect(client.VerifySynced()).To(Succeed())
+				Expect(autopilot.HealthCall.CallCount).To(Equal(1))
+				Expect(consulRPCClient.StatsCallCount()).To(Equal(0))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "agent-client.verify-synced.autopilot-health.request",
+					},
+					{
+						Action: "agent-client.verify-synced.autopilot-health.response",
+						Data: []lager.Data{{
+							"healthy":           true,
+							"failure_tolerance": 1,
+							"leader":            "server-0",
+							"unhealthy":         []string(nil),
+						}},
+					},
+					{
+						Action: "agent-client.verify-synced.synced",
+					},
+				}))
+			})
+
+			Context("when a server is unhealthy", func() {
+				It("returns an error naming the server", func() {
+					autopilot.HealthCall.Returns.Health.Healthy = false
+					autopilot.HealthCall.Returns.Health.Servers[2].Healthy = false
+
+					Expect(client.VerifySynced()).To(MatchError("autopilot reports unhealthy servers: server-2"))
+					Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+						{
+							Action: "agent-client.verify-synced.unhealthy",
+							Error:  errors.New("autopilot reports unhealthy servers: server-2"),
+						},
+					}))
+				})
+			})
+
+			Context("when no server is the leader", func() {
+				It("returns an error", func() {
+					autopilot.HealthCall.Returns.Health.Servers[0].Leader = false
+
+					Expect(client.VerifySynced()).To(MatchError("autopilot reports no leader"))
+					Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+						{
+							Action: "agent-client.verify-synced.no-leader",
+							Error:  errors.New("autopilot reports no leader"),
+						},
+					}))
+				})
+			})
+
+			Context("when the agent does not serve autopilot health", func() {
+				It("falls back to the raft stats", func() {
+					autopilot.HealthCall.Returns.Error = agent.ErrAutopilotUnavailable
+
+					Expect(client.VerifySynced()).To(Succeed())
+					Expect(consulRPCClient.StatsCallCount()).To(Equal(1))
+					Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+						{
+							Action: "agent-client.verify-synced.autopilot-health.unavailable",
+						},
+						{
+							Action: "agent-client.verify-synced.stats.request",
+						},
+					}))
+				})
+			})
+
+			Context("when the autopilot health request fails", func() {
+				It("returns an error", func() {
+					autopilot.HealthCall.Returns.Error = errors.New("connection refused")
+
+					Expect(client.VerifySynced()).To(MatchError("connection refused"))
+					Expect(consulRPCClient.StatsCallCount()).To(Equal(0))
+					Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+						{
+							Action: "agent-client.verify-synced.autopilot-health.request.failed",
+							Error:  errors.New("connection refused"),
+						},
+					}))
+				})
+			})
+		})
 	})
 
 	Describe("IsLastNode", func() {
@@ -271,6 +506,28 @@ var _ = Describe("Client", func() {
 			client.ExpectedMembers = []string{"member1", "member2", "member3"}
 		})
 
+		It("compares against the number of resolved servers", func() {
+			resolver := &fakes.Resolver{}
+			resolver.LookupSRVCall.Returns.Records = map[string][]*net.SRV{
+				"_consul._tcp.internal": {
+					{Target: "10.0.0.1", Port: 8301},
+					{Target: "10.0.0.2", Port: 8301},
+				},
+			}
+			client.Resolver = resolver
+			client.ExpectedMembers = []string{"_consul._tcp.internal"}
+
+			Expect(client.IsLastNode()).To(BeFalse())
+			Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+				Action: "agent-client.is-last-node.result",
+				Data: []lager.Data{{
+					"actual_members_count":   3,
+					"expected_members_count": 2,
+					"is_last_node":           false,
+				}},
+			}))
+		})
+
 		It("returns true", func() {
 			Expect(client.IsLastNode()).To(BeTrue())
 			Expect(consulAPIAgent.MembersCallCount()).To(Equal(1))
@@ -403,6 +660,154 @@ var _ = Describe("Client", func() {
 		})
 	})
 
+	Describe("Status", func() {
+		BeforeEach(func() {
+			client.ExpectedMembers = []string{"member1", "member2", "member3"}
+			consulAPIAgent.MembersReturns([]*api.AgentMember{
+				{Addr: "member1", Status: 1, Tags: map[string]string{"role": "consul"}},
+				{Addr: "member2", Status: 1, Tags: map[string]string{"role": "consul"}},
+				{Addr: "member3", Status: 4, Tags: map[string]string{"role": "consul"}},
+				{Addr: "member4", Status: 1, Tags: map[string]string{"role": "node"}},
+			}, nil)
+			consulRPCClient.StatsReturns(map[string]map[string]string{
+				"raft": {
+					"commit_index":   "12",
+					"last_log_index": "14",
+				},
+			}, nil)
+			consulRPCClient.ListKeysReturns([]string{"key1", "key2"}, nil)
+		})
+
+		It("reports the membership, raft and keyring state", func() {
+			status, err := client.Status()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(Equal(agent.Status{
+				LANMembers:      4,
+				LANServers:      2,
+				ExpectedServers: 3,
+				Raft:            true,
+				CommitIndex:     12,
+				LastLogIndex:    14,
+				KeyringKeys:     2,
+			}))
+		})
+
+		It("reports the encrypt stage and skips the keyring while accepting plaintext gossip", func() {
+			client.EncryptStage = "accept"
+
+			status, err := client.Status()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.EncryptStage).To(Equal("accept"))
+			Expect(status.KeyringKeys).To(BeZero())
+			Expect(status.Raft).To(BeTrue())
+			Expect(consulRPCClient.ListKeysCallCount()).To(Equal(0))
+		})
+
+		It("does not report raft state when the agent is not a server", func() {
+			consulRPCClient.StatsReturns(map[string]map[string]string{}, nil)
+
+			status, err := client.Status()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Raft).To(BeFalse())
+			Expect(status.CommitIndex).To(BeZero())
+		})
+
+		Context("when there is no rpc client", func() {
+			It("reports only the membership state", func() {
+				client.ConsulRPCClient = nil
+
+				status, err := client.Status()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status).To(Equal(agent.Status{
+					LANMembers:      4,
+					LANServers:      2,
+					ExpectedServers: 3,
+				}))
+			})
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when members cannot be retrieved", func() {
+				consulAPIAgent.MembersReturns(nil, errors.New("members error"))
+
+				_, err := client.Status()
+				Expect(err).To(MatchError("members error"))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "agent-client.status.members.request.failed",
+						Error:  errors.New("members error"),
+						Data: []lager.Data{{
+							"wan": false,
+						}},
+					},
+				}))
+			})
+
+			It("returns an error when stats cannot be retrieved", func() {
+				consulRPCClient.StatsReturns(nil, errors.New("stats error"))
+
+				_, err := client.Status()
+				Expect(err).To(MatchError("stats error"))
+			})
+
+			It("returns an error when keys cannot be listed", func() {
+				consulRPCClient.ListKeysReturns(nil, errors.New("list keys error"))
+
+				_, err := client.Status()
+				Expect(err).To(MatchError("list keys error"))
+			})
+		})
+	})
+
+	Describe("Version", func() {
+		It("returns the version reported by the running agent", func() {
+			consulAPIAgent.SelfReturns(map[string]map[string]interface{}{
+				"Config": {
+					"Version": "0.6.4",
+				},
+			}, nil)
+
+			version, err := client.Version()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal("0.6.4"))
+
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "agent-client.version.self.request",
+				},
+				{
+					Action: "agent-client.version.self.response",
+					Data: []lager.Data{{
+						"version": "0.6.4",
+					}},
+				},
+			}))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the self call fails", func() {
+				consulAPIAgent.SelfReturns(nil, errors.New("self error"))
+
+				_, err := client.Version()
+				Expect(err).To(MatchError("self error"))
+
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "agent-client.version.self.request.failed",
+						Error:  errors.New("self error"),
+					},
+				}))
+			})
+
+			It("returns an error when the response does not include a version", func() {
+				consulAPIAgent.SelfReturns(map[string]map[string]interface{}{}, nil)
+
+				_, err := client.Version()
+				Expect(err).To(MatchError("agent self did not include a version"))
+			})
+		})
+	})
+
 	Describe("SetKeys", func() {
 		encryptedKey1 := "5v4WCjw2FyuezPYYUvo0zA=="
 		encryptedKey2 := "gcC8kpXH4sUwLaxtiz2mBw=="
@@ -415,6 +820,40 @@ var _ = Describe("Client", func() {
 			consulRPCClient.RemoveKeyReturns(nil)
 		})
 
+		It("counts the keyring operations", func() {
+			consulRPCClient.ListKeysReturns([]string{"old-key"}, nil)
+
+			Expect(client.SetKeys([]string{encryptedKey1, "key2"})).To(Succeed())
+			Expect(metrics.Counters).To(Equal(map[string]float32{
+				"keyring.remove":  1,
+				"keyring.install": 2,
+				"keyring.use":     1,
+			}))
+		})
+
+		It("leaves the keyring alone while accepting plaintext gossip", func() {
+			client.EncryptStage = "accept"
+
+			Expect(client.SetKeys([]string{encryptedKey1})).To(Succeed())
+			Expect(consulRPCClient.ListKeysCallCount()).To(Equal(0))
+			Expect(consulRPCClient.InstallKeyCallCount()).To(Equal(0))
+			Expect(consulRPCClient.UseKeyCallCount()).To(Equal(0))
+			Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+				Action: "agent-client.set-keys.skip",
+				Data: []lager.Data{{
+					"encrypt_stage": "accept",
+				}},
+			}))
+		})
+
+		It("manages the keyring once gossip is encrypted", func() {
+			client.EncryptStage = "send"
+
+			Expect(client.SetKeys([]string{encryptedKey1})).To(Succeed())
+			Expect(consulRPCClient.InstallKeyCallCount()).To(Equal(1))
+			Expect(consulRPCClient.UseKeyCallCount()).To(Equal(1))
+		})
+
 		It("installs the given keys", func() {
 			Expect(client.SetKeys([]string{encryptedKey1, "key2", "key%%"})).To(Succeed())
 			Expect(consulRPCClient.InstallKeyCallCount()).To(Equal(3))
@@ -442,55 +881,55 @@ var _ = Describe("Client", func() {
 				{
 					Action: "agent-client.set-keys.list-keys.response",
 					Data: []lager.Data{{
-						"keys": []string{},
+						"fingerprints": keyring.KeyFingerprints([]string{}),
 					}},
 				},
 				{
 					Action: "agent-client.set-keys.install-key.request",
 					Data: []lager.Data{{
-						"key": encryptedKey1,
+						"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 					}},
 				},
 				{
 					Action: "agent-client.set-keys.install-key.response",
 					Data: []lager.Data{{
-						"key": encryptedKey1,
+						"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 					}},
 				},
 				{
 					Action: "agent-client.set-keys.install-key.request",
 					Data: []lager.Data{{
-						"key": encryptedKey2,
+						"fingerprint": keyring.KeyFingerprint(encryptedKey2),
 					}},
 				},
 				{
 					Action: "agent-client.set-keys.install-key.response",
 					Data: []lager.Data{{
-						"key": encryptedKey2,
+						"fingerprint": keyring.KeyFingerprint(encryptedKey2),
 					}},
 				},
 				{
 					Action: "agent-client.set-keys.install-key.request",
 					Data: []lager.Data{{
-						"key": encryptedKeyPercent,
+						"fingerprint": keyring.KeyFingerprint(encryptedKeyPercent),
 					}},
 				},
 				{
 					Action: "agent-client.set-keys.install-key.response",
 					Data: []lager.Data{{
-						"key": encryptedKeyPercent,
+						"fingerprint": keyring.KeyFingerprint(encryptedKeyPercent),
 					}},
 				},
 				{
 					Action: "agent-client.set-keys.use-key.request",
 					Data: []lager.Data{{
-						"key": encryptedKey1,
+						"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 					}},
 				},
 				{
 					Action: "agent-client.set-keys.use-key.response",
 					Data: []lager.Data{{
-						"key": encryptedKey1,
+						"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 					}},
 				},
 				{
@@ -521,67 +960,67 @@ var _ = Describe("Client", func() {
 					{
 						Action: "agent-client.set-keys.list-keys.response",
 						Data: []lager.Data{{
-							"keys": []string{"key3", "key4"},
+							"fingerprints": keyring.KeyFingerprints([]string{"key3", "key4"}),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.remove-key.request",
 						Data: []lager.Data{{
-							"key": "key3",
+							"fingerprint": keyring.KeyFingerprint("key3"),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.remove-key.response",
 						Data: []lager.Data{{
-							"key": "key3",
+							"fingerprint": keyring.KeyFingerprint("key3"),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.remove-key.request",
 						Data: []lager.Data{{
-							"key": "key4",
+							"fingerprint": keyring.KeyFingerprint("key4"),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.remove-key.response",
 						Data: []lager.Data{{
-							"key": "key4",
+							"fingerprint": keyring.KeyFingerprint("key4"),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.install-key.request",
 						Data: []lager.Data{{
-							"key": encryptedKey1,
+							"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.install-key.response",
 						Data: []lager.Data{{
-							"key": encryptedKey1,
+							"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.install-key.request",
 						Data: []lager.Data{{
-							"key": encryptedKey2,
+							"fingerprint": keyring.KeyFingerprint(encryptedKey2),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.install-key.response",
 						Data: []lager.Data{{
-							"key": encryptedKey2,
+							"fingerprint": keyring.KeyFingerprint(encryptedKey2),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.use-key.request",
 						Data: []lager.Data{{
-							"key": encryptedKey1,
+							"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 						}},
 					},
 					{
 						Action: "agent-client.set-keys.use-key.response",
 						Data: []lager.Data{{
-							"key": encryptedKey1,
+							"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 						}},
 					},
 					{
@@ -646,20 +1085,20 @@ var _ = Describe("Client", func() {
 						{
 							Action: "agent-client.set-keys.list-keys.response",
 							Data: []lager.Data{{
-								"keys": []string{"key2"},
+								"fingerprints": keyring.KeyFingerprints([]string{"key2"}),
 							}},
 						},
 						{
 							Action: "agent-client.set-keys.remove-key.request",
 							Data: []lager.Data{{
-								"key": "key2",
+								"fingerprint": keyring.KeyFingerprint("key2"),
 							}},
 						},
 						{
 							Action: "agent-client.set-keys.remove-key.request.failed",
 							Error:  errors.New("remove key error"),
 							Data: []lager.Data{{
-								"key": "key2",
+								"fingerprint": keyring.KeyFingerprint("key2"),
 							}},
 						},
 					}))
@@ -678,20 +1117,20 @@ var _ = Describe("Client", func() {
 						{
 							Action: "agent-client.set-keys.list-keys.response",
 							Data: []lager.Data{{
-								"keys": []string{},
+								"fingerprints": keyring.KeyFingerprints([]string{}),
 							}},
 						},
 						{
 							Action: "agent-client.set-keys.install-key.request",
 							Data: []lager.Data{{
-								"key": encryptedKey1,
+								"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 							}},
 						},
 						{
 							Action: "agent-client.set-keys.install-key.request.failed",
 							Error:  errors.New("install key error"),
 							Data: []lager.Data{{
-								"key": encryptedKey1,
+								"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 							}},
 						},
 					}))
@@ -710,32 +1149,32 @@ var _ = Describe("Client", func() {
 						{
 							Action: "agent-client.set-keys.list-keys.response",
 							Data: []lager.Data{{
-								"keys": []string{},
+								"fingerprints": keyring.KeyFingerprints([]string{}),
 							}},
 						},
 						{
 							Action: "agent-client.set-keys.install-key.request",
 							Data: []lager.Data{{
-								"key": encryptedKey1,
+								"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 							}},
 						},
 						{
 							Action: "agent-client.set-keys.install-key.response",
 							Data: []lager.Data{{
-								"key": encryptedKey1,
+								"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 							}},
 						},
 						{
 							Action: "agent-client.set-keys.use-key.request",
 							Data: []lager.Data{{
-								"key": encryptedKey1,
+								"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 							}},
 						},
 						{
 							Action: "agent-client.set-keys.use-key.request.failed",
 							Error:  errors.New("use key error"),
 							Data: []lager.Data{{
-								"key": encryptedKey1,
+								"fingerprint": keyring.KeyFingerprint(encryptedKey1),
 							}},
 						},
 					}))
@@ -744,6 +1183,76 @@ var _ = Describe("Client", func() {
 		})
 	})
 
+	Describe("BootstrapACLs", func() {
+		var policies []config.ACLPolicy
+
+		BeforeEach(func() {
+			policies = []config.ACLPolicy{
+				{Name: "agent", Token: "agent-token", Rules: "agent-rules"},
+				{Name: "service-router", Token: "router-token", Rules: "router-rules"},
+			}
+		})
+
+		It("creates or updates a client token for each policy", func() {
+			Expect(client.BootstrapACLs(policies)).To(Succeed())
+			Expect(consulACL.UpdateCallCount()).To(Equal(2))
+
+			entry, _ := consulACL.UpdateArgsForCall(0)
+			Expect(entry).To(Equal(&api.ACLEntry{
+				ID:    "agent-token",
+				Name:  "agent",
+				Type:  api.ACLClientType,
+				Rules: "agent-rules",
+			}))
+
+			entry, _ = consulACL.UpdateArgsForCall(1)
+			Expect(entry).To(Equal(&api.ACLEntry{
+				ID:    "router-token",
+				Name:  "service-router",
+				Type:  api.ACLClientType,
+				Rules: "router-rules",
+			}))
+
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "agent-client.bootstrap-acls.update.request",
+					Data:   []lager.Data{{"name": "agent"}},
+				},
+				{
+					Action: "agent-client.bootstrap-acls.update.response",
+					Data:   []lager.Data{{"name": "agent"}},
+				},
+				{
+					Action: "agent-client.bootstrap-acls.update.request",
+					Data:   []lager.Data{{"name": "service-router"}},
+				},
+				{
+					Action: "agent-client.bootstrap-acls.update.response",
+					Data:   []lager.Data{{"name": "service-router"}},
+				},
+				{
+					Action: "agent-client.bootstrap-acls.success",
+				},
+			}))
+		})
+
+		Context("when updating an acl fails", func() {
+			It("returns an error", func() {
+				consulACL.UpdateReturns(nil, errors.New("permission denied"))
+
+				Expect(client.BootstrapACLs(policies)).To(MatchError("permission denied"))
+				Expect(consulACL.UpdateCallCount()).To(Equal(1))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "agent-client.bootstrap-acls.update.request.failed",
+						Error:  errors.New("permission denied"),
+						Data:   []lager.Data{{"name": "agent"}},
+					},
+				}))
+			})
+		})
+	})
+
 	Describe("Leave", func() {
 		It("leaves the cluster", func() {
 			Expect(client.Leave()).To(Succeed())
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	agentSelfPath       = "/v1/agent/self"
+	agentLeavePath      = "/v1/agent/leave"
+	operatorKeyringPath = "/v1/operator/keyring"
+)
+
+// HTTPRPCClient performs the ConsulRPCClient operations through the HTTP API,
+// for consul 0.8.0 and later which no longer serve the agent RPC interface.
+type HTTPRPCClient struct {
+	Address    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+type keyringResponse struct {
+	WAN  bool
+	Keys map[string]int
+}
+
+type keyringRequest struct {
+	Key string
+}
+
+func (c HTTPRPCClient) Stats() (map[string]map[string]string, error) {
+	var self struct {
+		Stats map[string]map[string]string
+	}
+
+	if err := c.do("GET", agentSelfPath, nil, &self); err != nil {
+		return nil, err
+	}
+
+	return self.Stats, nil
+}
+
+func (c HTTPRPCClient) ListKeys() ([]string, error) {
+	var responses []keyringResponse
+	if err := c.do("GET", operatorKeyringPath, nil, &responses); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, response := range responses {
+		if response.WAN {
+			continue
+		}
+
+		for key := range response.Keys {
+			if !containsString(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+func (c HTTPRPCClient) InstallKey(key string) error {
+	return c.do("POST", operatorKeyringPath, keyringRequest{Key: key}, nil)
+}
+
+func (c HTTPRPCClient) UseKey(key string) error {
+	return c.do("PUT", operatorKeyringPath, keyringRequest{Key: key}, nil)
+}
+
+func (c HTTPRPCClient) RemoveKey(key string) error {
+	return c.do("DELETE", operatorKeyringPath, keyringRequest{Key: key}, nil)
+}
+
+func (c HTTPRPCClient) Leave() error {
+	return c.do("PUT", agentLeavePath, nil, nil)
+}
+
+func (c HTTPRPCClient) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return errors.New(err.Error())
+		}
+		body = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", c.Address, path), body)
+	if err != nil {
+		return err
+	}
+
+	if c.Token != "" {
+		request.Header.Set("X-Consul-Token", c.Token)
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("unexpected response from %s %s: %s %s", method, path, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return errors.New(err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package agent_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTPRPCClient", func() {
+	var (
+		server      *httptest.Server
+		status      int
+		body        string
+		request     *http.Request
+		requestBody string
+		client      agent.HTTPRPCClient
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		body = ""
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request = r
+			data, _ := ioutil.ReadAll(r.Body)
+			requestBody = string(data)
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+
+		client = agent.HTTPRPCClient{
+			Address:    strings.TrimPrefix(server.URL, "http://"),
+			Token:      "some-token",
+			HTTPClient: http.DefaultClient,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reads the raft stats from the agent self endpoint", func() {
+		body = `{"Config": {}, "Stats": {"raft": {"commit_index": "5", "last_log_index": "6"}}}`
+
+		stats, err := client.Stats()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(request.Method).To(Equal("GET"))
+		Expect(request.URL.Path).To(Equal("/v1/agent/self"))
+		Expect(request.Header.Get("X-Consul-Token")).To(Equal("some-token"))
+		Expect(stats["raft"]).To(Equal(map[string]string{
+			"commit_index":   "5",
+			"last_log_index": "6",
+		}))
+	})
+
+	It("lists the keys of the LAN pool", func() {
+		body = `[
+			{"WAN": true, "Datacenter": "dc1", "Keys": {"wan-key": 3}, "NumNodes": 3},
+			{"WAN": false, "Datacenter": "dc1", "Keys": {"lan-key": 5}, "NumNodes": 5}
+		]`
+
+		keys, err := client.ListKeys()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(request.Method).To(Equal("GET"))
+		Expect(request.URL.Path).To(Equal("/v1/operator/keyring"))
+		Expect(keys).To(Equal([]string{"lan-key"}))
+	})
+
+	It("installs, uses and removes keys", func() {
+		Expect(client.InstallKey("some-key")).To(Succeed())
+		Expect(request.Method).To(Equal("POST"))
+		Expect(request.URL.Path).To(Equal("/v1/operator/keyring"))
+		Expect(requestBody).To(MatchJSON(`{"Key": "some-key"}`))
+
+		Expect(client.UseKey("some-key")).To(Succeed())
+		Expect(request.Method).To(Equal("PUT"))
+		Expect(requestBody).To(MatchJSON(`{"Key": "some-key"}`))
+
+		Expect(client.RemoveKey("some-key")).To(Succeed())
+		Expect(request.Method).To(Equal("DELETE"))
+		Expect(requestBody).To(MatchJSON(`{"Key": "some-key"}`))
+	})
+
+	It("asks the agent to leave", func() {
+		Expect(client.Leave()).To(Succeed())
+		Expect(request.Method).To(Equal("PUT"))
+		Expect(request.URL.Path).To(Equal("/v1/agent/leave"))
+	})
+
+	It("returns the agent's error message", func() {
+		status = http.StatusInternalServerError
+		body = "1 error(s) occurred:\n\n* key not installed\n"
+
+		err := client.UseKey("some-key")
+		Expect(err).To(MatchError("unexpected response from PUT /v1/operator/keyring: 500 Internal Server Error 1 error(s) occurred:\n\n* key not installed"))
+	})
+})
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"errors"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pivotal-golang/lager"
+)
+
+// DrainReason is the maintenance reason confab sets while draining the node
+// before it stops the agent. Maintenance with any other reason was enabled by
+// an operator and is left in place when the agent starts again.
+const DrainReason = "confab: draining before the agent leaves"
+
+const nodeMaintenanceCheckID = "_node_maintenance"
+
+type consulHealth interface {
+	Service(service, tag string, passingOnly bool, q *api.QueryOptions) ([]*api.ServiceEntry, *api.QueryMeta, error)
+}
+
+func (c Client) EnableMaintenance(reason string) error {
+	c.Logger.Info("agent-client.enable-maintenance.request", lager.Data{
+		"reason": reason,
+	})
+
+	if err := c.ConsulAPIAgent.EnableNodeMaintenance(reason); err != nil {
+		c.Logger.Error("agent-client.enable-maintenance.request.failed", err)
+		return err
+	}
+
+	c.Logger.Info("agent-client.enable-maintenance.response")
+	return nil
+}
+
+func (c Client) DisableMaintenance() error {
+	c.Logger.Info("agent-client.disable-maintenance.request")
+
+	if err := c.ConsulAPIAgent.DisableNodeMaintenance(); err != nil {
+		c.Logger.Error("agent-client.disable-maintenance.request.failed", err)
+		return err
+	}
+
+	c.Logger.Info("agent-client.disable-maintenance.response")
+	return nil
+}
+
+func (c Client) EnableServiceMaintenance(serviceID, reason string) error {
+	c.Logger.Info("agent-client.enable-service-maintenance.request", lager.Data{
+		"service": serviceID,
+		"reason":  reason,
+	})
+
+	if err := c.ConsulAPIAgent.EnableServiceMaintenance(serviceID, reason); err != nil {
+		c.Logger.Error("agent-client.enable-service-maintenance.request.failed", err, lager.Data{
+			"service": serviceID,
+		})
+		return err
+	}
+
+	c.Logger.Info("agent-client.enable-service-maintenance.response", lager.Data{
+		"service": serviceID,
+	})
+	return nil
+}
+
+func (c Client) DisableServiceMaintenance(serviceID string) error {
+	c.Logger.Info("agent-client.disable-service-maintenance.request", lager.Data{
+		"service": serviceID,
+	})
+
+	if err := c.ConsulAPIAgent.DisableServiceMaintenance(serviceID); err != nil {
+		c.Logger.Error("agent-client.disable-service-maintenance.request.failed", err, lager.Data{
+			"service": serviceID,
+		})
+		return err
+	}
+
+	c.Logger.Info("agent-client.disable-service-maintenance.response", lager.Data{
+		"service": serviceID,
+	})
+	return nil
+}
+
+// EndDrain lifts the node maintenance left behind by a previous drain. The
+// agent persists maintenance across restarts, so without this a node would
+// stay out of DNS after it was stopped and started again.
+func (c Client) EndDrain() error {
+	c.Logger.Info("agent-client.end-drain.checks.request")
+
+	checks, err := c.ConsulAPIAgent.Checks()
+	if err != nil {
+		c.Logger.Error("agent-client.end-drain.checks.request.failed", err)
+		return err
+	}
+
+	check, ok := checks[nodeMaintenanceCheckID]
+	if !ok || check.Notes != DrainReason {
+		c.Logger.Info("agent-client.end-drain.not-draining")
+		return nil
+	}
+
+	c.Logger.Info("agent-client.end-drain.disable-maintenance.request")
+	if err := c.ConsulAPIAgent.DisableNodeMaintenance(); err != nil {
+		c.Logger.Error("agent-client.end-drain.disable-maintenance.request.failed", err)
+		return err
+	}
+
+	c.Logger.Info("agent-client.end-drain.success")
+	return nil
+}
+
+// IsDrained reports whether the catalog no longer returns the node as a
+// passing instance of any of the services, which is what the other members
+// see when they query the health endpoints or DNS.
+func (c Client) IsDrained(node string, services []string) (bool, error) {
+	if c.ConsulHealth == nil {
+		err := errors.New("consul health client is nil")
+		c.Logger.Error("agent-client.is-drained.nil-health-client", err)
+		return false, err
+	}
+
+	for _, service := range services {
+		c.Logger.Info("agent-client.is-drained.health.request", lager.Data{
+			"service": service,
+		})
+
+		entries, _, err := c.ConsulHealth.Service(service, "", true, nil)
+		if err != nil {
+			c.Logger.Error("agent-client.is-drained.health.request.failed", err, lager.Data{
+				"service": service,
+			})
+			return false, err
+		}
+
+		for _, entry := range entries {
+			if entry.Node != nil && entry.Node.Node == node {
+				c.Logger.Info("agent-client.is-drained.still-serving", lager.Data{
+					"service": service,
+					"node":    node,
+				})
+				return false, nil
+			}
+		}
+	}
+
+	c.Logger.Info("agent-client.is-drained.drained", lager.Data{
+		"node": node,
+	})
+	return true, nil
+}
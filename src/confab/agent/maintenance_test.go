@@ -0,0 +1,196 @@
+package agent_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+	"github.com/hashicorp/consul/api"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/pivotal-cf-experimental/gomegamatchers"
+)
+
+var _ = Describe("Maintenance", func() {
+	var (
+		consulAPIAgent *fakes.FakeconsulAPIAgent
+		consulHealth   *fakes.FakeconsulHealth
+		logger         *fakes.Logger
+		client         agent.Client
+	)
+
+	BeforeEach(func() {
+		consulAPIAgent = &fakes.FakeconsulAPIAgent{}
+		consulHealth = &fakes.FakeconsulHealth{}
+		logger = &fakes.Logger{}
+		client = agent.Client{
+			ConsulAPIAgent: consulAPIAgent,
+			ConsulHealth:   consulHealth,
+			Logger:         logger,
+		}
+	})
+
+	Describe("EnableMaintenance", func() {
+		It("puts the node into maintenance", func() {
+			Expect(client.EnableMaintenance("upgrading")).To(Succeed())
+			Expect(consulAPIAgent.EnableNodeMaintenanceCallCount()).To(Equal(1))
+			Expect(consulAPIAgent.EnableNodeMaintenanceArgsForCall(0)).To(Equal("upgrading"))
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "agent-client.enable-maintenance.request",
+					Data:   []lager.Data{{"reason": "upgrading"}},
+				},
+				{
+					Action: "agent-client.enable-maintenance.response",
+				},
+			}))
+		})
+
+		It("returns an error when the request fails", func() {
+			consulAPIAgent.EnableNodeMaintenanceReturns(errors.New("maintenance error"))
+
+			Expect(client.EnableMaintenance("upgrading")).To(MatchError("maintenance error"))
+			Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+				Action: "agent-client.enable-maintenance.request.failed",
+				Error:  errors.New("maintenance error"),
+			}))
+		})
+	})
+
+	Describe("DisableMaintenance", func() {
+		It("takes the node out of maintenance", func() {
+			Expect(client.DisableMaintenance()).To(Succeed())
+			Expect(consulAPIAgent.DisableNodeMaintenanceCallCount()).To(Equal(1))
+		})
+
+		It("returns an error when the request fails", func() {
+			consulAPIAgent.DisableNodeMaintenanceReturns(errors.New("maintenance error"))
+
+			Expect(client.DisableMaintenance()).To(MatchError("maintenance error"))
+		})
+	})
+
+	Describe("EnableServiceMaintenance and DisableServiceMaintenance", func() {
+		It("toggles maintenance of the service", func() {
+			Expect(client.EnableServiceMaintenance("router-0", "upgrading")).To(Succeed())
+			serviceID, reason := consulAPIAgent.EnableServiceMaintenanceArgsForCall(0)
+			Expect(serviceID).To(Equal("router-0"))
+			Expect(reason).To(Equal("upgrading"))
+
+			Expect(client.DisableServiceMaintenance("router-0")).To(Succeed())
+			Expect(consulAPIAgent.DisableServiceMaintenanceArgsForCall(0)).To(Equal("router-0"))
+		})
+
+		It("returns an error when a request fails", func() {
+			consulAPIAgent.EnableServiceMaintenanceReturns(errors.New("unknown service"))
+			consulAPIAgent.DisableServiceMaintenanceReturns(errors.New("unknown service"))
+
+			Expect(client.EnableServiceMaintenance("router-0", "upgrading")).To(MatchError("unknown service"))
+			Expect(client.DisableServiceMaintenance("router-0")).To(MatchError("unknown service"))
+		})
+	})
+
+	Describe("EndDrain", func() {
+		It("lifts the maintenance enabled by a drain", func() {
+			consulAPIAgent.ChecksReturns(map[string]*api.AgentCheck{
+				"_node_maintenance": {CheckID: "_node_maintenance", Notes: agent.DrainReason},
+			}, nil)
+
+			Expect(client.EndDrain()).To(Succeed())
+			Expect(consulAPIAgent.DisableNodeMaintenanceCallCount()).To(Equal(1))
+			Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+				Action: "agent-client.end-drain.success",
+			}))
+		})
+
+		It("leaves maintenance enabled by an operator in place", func() {
+			consulAPIAgent.ChecksReturns(map[string]*api.AgentCheck{
+				"_node_maintenance": {CheckID: "_node_maintenance", Notes: "replacing disks"},
+			}, nil)
+
+			Expect(client.EndDrain()).To(Succeed())
+			Expect(consulAPIAgent.DisableNodeMaintenanceCallCount()).To(Equal(0))
+			Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+				Action: "agent-client.end-drain.not-draining",
+			}))
+		})
+
+		It("does nothing when the node is not in maintenance", func() {
+			consulAPIAgent.ChecksReturns(map[string]*api.AgentCheck{}, nil)
+
+			Expect(client.EndDrain()).To(Succeed())
+			Expect(consulAPIAgent.DisableNodeMaintenanceCallCount()).To(Equal(0))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the checks cannot be listed", func() {
+				consulAPIAgent.ChecksReturns(nil, errors.New("checks error"))
+
+				Expect(client.EndDrain()).To(MatchError("checks error"))
+			})
+
+			It("returns an error when maintenance cannot be disabled", func() {
+				consulAPIAgent.ChecksReturns(map[string]*api.AgentCheck{
+					"_node_maintenance": {CheckID: "_node_maintenance", Notes: agent.DrainReason},
+				}, nil)
+				consulAPIAgent.DisableNodeMaintenanceReturns(errors.New("maintenance error"))
+
+				Expect(client.EndDrain()).To(MatchError("maintenance error"))
+			})
+		})
+	})
+
+	Describe("IsDrained", func() {
+		It("reports true when no service returns the node as passing", func() {
+			consulHealth.ServiceReturns([]*api.ServiceEntry{
+				{Node: &api.Node{Node: "router-1"}},
+			}, nil, nil)
+
+			drained, err := client.IsDrained("router-0", []string{"router", "gorouter"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(drained).To(BeTrue())
+
+			Expect(consulHealth.ServiceCallCount()).To(Equal(2))
+			service, tag, passingOnly, _ := consulHealth.ServiceArgsForCall(1)
+			Expect(service).To(Equal("gorouter"))
+			Expect(tag).To(BeEmpty())
+			Expect(passingOnly).To(BeTrue())
+		})
+
+		It("reports false while a service still returns the node", func() {
+			consulHealth.ServiceReturns([]*api.ServiceEntry{
+				{Node: &api.Node{Node: "router-1"}},
+				{Node: &api.Node{Node: "router-0"}},
+			}, nil, nil)
+
+			drained, err := client.IsDrained("router-0", []string{"router"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(drained).To(BeFalse())
+			Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+				Action: "agent-client.is-drained.still-serving",
+				Data: []lager.Data{{
+					"service": "router",
+					"node":    "router-0",
+				}},
+			}))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the health query fails", func() {
+				consulHealth.ServiceReturns(nil, nil, errors.New("health error"))
+
+				_, err := client.IsDrained("router-0", []string{"router"})
+				Expect(err).To(MatchError("health error"))
+			})
+
+			It("returns an error when the health client has never been set", func() {
+				client.ConsulHealth = nil
+
+				_, err := client.IsDrained("router-0", []string{"router"})
+				Expect(err).To(MatchError("consul health client is nil"))
+			})
+		})
+	})
+})
@@ -6,10 +6,11 @@ import (
 	"github.com/hashicorp/consul/command/agent"
 )
 
-const keyringToken = ""
-
 type RPCClient struct {
 	agent.RPCClient
+
+	// Token is presented on keyring operations when ACLs are enabled.
+	Token string
 }
 
 func HandleRPCErrors(info []agent.KeyringInfo) error {
@@ -22,7 +23,7 @@ func HandleRPCErrors(info []agent.KeyringInfo) error {
 }
 
 func (c RPCClient) ListKeys() ([]string, error) {
-	response, err := c.RPCClient.ListKeys("")
+	response, err := c.RPCClient.ListKeys(c.Token)
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +44,7 @@ func (c RPCClient) ListKeys() ([]string, error) {
 }
 
 func (c RPCClient) InstallKey(key string) error {
-	response, err := c.RPCClient.InstallKey(key, keyringToken)
+	response, err := c.RPCClient.InstallKey(key, c.Token)
 	if err != nil {
 		return err
 	}
@@ -57,7 +58,7 @@ func (c RPCClient) InstallKey(key string) error {
 }
 
 func (c RPCClient) UseKey(key string) error {
-	response, err := c.RPCClient.UseKey(key, keyringToken)
+	response, err := c.RPCClient.UseKey(key, c.Token)
 	if err != nil {
 		return err
 	}
@@ -71,7 +72,7 @@ func (c RPCClient) UseKey(key string) error {
 }
 
 func (c RPCClient) RemoveKey(key string) error {
-	response, err := c.RPCClient.RemoveKey(key, keyringToken)
+	response, err := c.RPCClient.RemoveKey(key, c.Token)
 	if err != nil {
 		return err
 	}
@@ -64,6 +64,24 @@ func (r *Runner) Run() error {
 	return nil
 }
 
+func (r *Runner) Version() (string, error) {
+	r.Logger.Info("agent-runner.version.run", lager.Data{
+		"cmd": r.Path,
+	})
+
+	output, err := exec.Command(r.Path, "version").Output()
+	if err != nil {
+		err = errors.New(err.Error())
+		r.Logger.Error("agent-runner.version.run.failed", err, lager.Data{
+			"cmd": r.Path,
+		})
+		return "", err
+	}
+
+	r.Logger.Info("agent-runner.version.success")
+	return string(output), nil
+}
+
 func (r *Runner) WritePID() error {
 	r.Logger.Info("agent-runner.run.write-pidfile", lager.Data{
 		"pid":  r.cmd.Process.Pid,
@@ -163,6 +181,30 @@ func (r *Runner) Stop() error {
 	return nil
 }
 
+// Reload asks the agent to reread its configuration, including its TLS
+// material on versions that support it.
+func (r *Runner) Reload() error {
+	r.Logger.Info("agent-runner.reload.get-process")
+
+	process, err := r.getProcess()
+	if err != nil {
+		r.Logger.Error("agent-runner.reload.get-process.failed", errors.New(err.Error()))
+		return err
+	}
+
+	r.Logger.Info("agent-runner.reload.signal", lager.Data{
+		"pid": process.Pid,
+	})
+
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		r.Logger.Error("agent-runner.reload.signal.failed", err)
+		return err
+	}
+
+	r.Logger.Info("agent-runner.reload.success")
+	return nil
+}
+
 func (r *Runner) Cleanup() error {
 	r.Logger.Info("agent-runner.cleanup.remove", lager.Data{
 		"pidfile": r.PIDFile,
@@ -52,6 +52,45 @@ var _ = Describe("Runner", func() {
 		os.RemoveAll(runner.ConfigDir)
 	})
 
+	Describe("Version", func() {
+		It("returns the output of the agent version command", func() {
+			output, err := runner.Version()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("Consul v0.6.4\nConsul Protocol: 3 (Understands back to: 1)\n"))
+
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "agent-runner.version.run",
+					Data: []lager.Data{{
+						"cmd": runner.Path,
+					}},
+				},
+				{
+					Action: "agent-runner.version.success",
+				},
+			}))
+		})
+
+		Context("when the version command fails", func() {
+			It("returns the error", func() {
+				runner.Path = "/tmp/path/that/does/not/exist"
+
+				_, err := runner.Version()
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "agent-runner.version.run.failed",
+						Error:  err,
+						Data: []lager.Data{{
+							"cmd": "/tmp/path/that/does/not/exist",
+						}},
+					},
+				}))
+			})
+		})
+	})
+
 	Describe("Cleanup", func() {
 		It("deletes the PID file for the consul agent", func() {
 			_, err := os.Stat(runner.PIDFile)
@@ -186,6 +225,57 @@ var _ = Describe("Runner", func() {
 		})
 	})
 
+	Describe("Reload", func() {
+		It("signals the process without stopping it", func() {
+			Expect(ioutil.WriteFile(filepath.Join(runner.ConfigDir, "options.json"), []byte(`{ "WaitForHUP": true }`), 0600)).To(Succeed())
+			Expect(runner.Run()).To(Succeed())
+			Expect(runner.WritePID()).To(Succeed())
+
+			Eventually(func() error {
+				_, err := os.Stat(filepath.Join(runner.ConfigDir, "fake-output.json"))
+				return err
+			}).Should(Succeed())
+
+			pid, err := getPID(runner)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(runner.Reload()).To(Succeed())
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "agent-runner.reload.get-process",
+				},
+				{
+					Action: "agent-runner.reload.signal",
+					Data: []lager.Data{{
+						"pid": pid,
+					}},
+				},
+				{
+					Action: "agent-runner.reload.success",
+				},
+			}))
+
+			Consistently(func() bool { return processIsRunning(runner) }, "100ms").Should(BeTrue())
+			Expect(runner.Stop()).To(Succeed())
+		})
+
+		Context("when the PID file cannot be read", func() {
+			It("returns an error", func() {
+				runner.PIDFile = "/tmp/nope-i-do-not-exist"
+				Expect(runner.Reload()).To(MatchError(ContainSubstring("no such file or directory")))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "agent-runner.reload.get-process",
+					},
+					{
+						Action: "agent-runner.reload.get-process.failed",
+						Error:  errors.New("open /tmp/nope-i-do-not-exist: no such file or directory"),
+					},
+				}))
+			})
+		})
+	})
+
 	Describe("stop & wait", func() {
 		It("stops the process / waits until it exits", func() {
 			By("launching the process, configured to spin", func() {
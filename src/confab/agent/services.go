@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pivotal-golang/lager"
+)
+
+// ServiceState is how the local agent sees one of the services confab
+// defined. Status is the worst status of the service's checks, and passing
+// when it has none.
+type ServiceState struct {
+	ID         string
+	Registered bool
+	Status     string
+}
+
+// Ready reports whether the service is registered and, when passing is set,
+// whether all of its checks are passing.
+func (s ServiceState) Ready(passing bool) bool {
+	if !s.Registered {
+		return false
+	}
+
+	return !passing || s.Status == api.HealthPassing
+}
+
+func (s ServiceState) String() string {
+	if !s.Registered {
+		return fmt.Sprintf("%s (not registered)", s.ID)
+	}
+
+	return fmt.Sprintf("%s (%s)", s.ID, s.Status)
+}
+
+// ServiceStates returns the state of each of the given service IDs on the
+// local agent, in the order they were given.
+func (c Client) ServiceStates(ids []string) ([]ServiceState, error) {
+	c.Logger.Info("agent-client.service-states.services.request")
+	services, err := c.ConsulAPIAgent.Services()
+	if err != nil {
+		c.Logger.Error("agent-client.service-states.services.request.failed", err)
+		return nil, err
+	}
+
+	c.Logger.Info("agent-client.service-states.checks.request")
+	checks, err := c.ConsulAPIAgent.Checks()
+	if err != nil {
+		c.Logger.Error("agent-client.service-states.checks.request.failed", err)
+		return nil, err
+	}
+
+	statuses := map[string]string{}
+	for _, check := range checks {
+		if check.ServiceID == "" {
+			continue
+		}
+
+		if healthSeverity(check.Status) > healthSeverity(statuses[check.ServiceID]) {
+			statuses[check.ServiceID] = check.Status
+		}
+	}
+
+	var states []ServiceState
+	for _, id := range ids {
+		state := ServiceState{ID: id}
+		if _, ok := services[id]; ok {
+			state.Registered = true
+			state.Status = api.HealthPassing
+			if status, ok := statuses[id]; ok {
+				state.Status = status
+			}
+		}
+
+		states = append(states, state)
+	}
+
+	c.Logger.Info("agent-client.service-states.success", lager.Data{
+		"services": states,
+	})
+	return states, nil
+}
+
+func healthSeverity(status string) int {
+	switch status {
+	case "":
+		return 0
+	case api.HealthPassing:
+		return 1
+	case api.HealthWarning:
+		return 2
+	default:
+		return 3
+	}
+}
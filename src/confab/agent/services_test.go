@@ -0,0 +1,90 @@
+package agent_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+	"github.com/hashicorp/consul/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Services", func() {
+	var (
+		consulAPIAgent *fakes.FakeconsulAPIAgent
+		logger         *fakes.Logger
+		client         agent.Client
+	)
+
+	BeforeEach(func() {
+		consulAPIAgent = &fakes.FakeconsulAPIAgent{}
+		logger = &fakes.Logger{}
+		client = agent.Client{
+			ConsulAPIAgent: consulAPIAgent,
+			Logger:         logger,
+		}
+	})
+
+	Describe("ServiceStates", func() {
+		BeforeEach(func() {
+			consulAPIAgent.ServicesReturns(map[string]*api.AgentService{
+				"router":           {ID: "router"},
+				"cloud-controller": {ID: "cloud-controller"},
+				"uaa":              {ID: "uaa"},
+			}, nil)
+			consulAPIAgent.ChecksReturns(map[string]*api.AgentCheck{
+				"serfHealth":               {CheckID: "serfHealth", Status: api.HealthPassing},
+				"service:router":           {CheckID: "service:router", ServiceID: "router", Status: api.HealthPassing},
+				"service:cloud-controller": {CheckID: "service:cloud-controller", ServiceID: "cloud-controller", Status: api.HealthPassing},
+				"other-check":              {CheckID: "other-check", ServiceID: "cloud-controller", Status: api.HealthWarning},
+			}, nil)
+		})
+
+		It("returns the worst check status of each service in the given order", func() {
+			states, err := client.ServiceStates([]string{"router", "cloud-controller", "uaa", "missing"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(states).To(Equal([]agent.ServiceState{
+				{ID: "router", Registered: true, Status: api.HealthPassing},
+				{ID: "cloud-controller", Registered: true, Status: api.HealthWarning},
+				{ID: "uaa", Registered: true, Status: api.HealthPassing},
+				{ID: "missing"},
+			}))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the services cannot be listed", func() {
+				consulAPIAgent.ServicesReturns(nil, errors.New("services error"))
+
+				_, err := client.ServiceStates([]string{"router"})
+				Expect(err).To(MatchError("services error"))
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "agent-client.service-states.services.request.failed",
+					Error:  errors.New("services error"),
+				}))
+			})
+
+			It("returns an error when the checks cannot be listed", func() {
+				consulAPIAgent.ChecksReturns(nil, errors.New("checks error"))
+
+				_, err := client.ServiceStates([]string{"router"})
+				Expect(err).To(MatchError("checks error"))
+			})
+		})
+	})
+
+	Describe("ServiceState", func() {
+		It("is ready once registered, or once passing when checks are required", func() {
+			Expect(agent.ServiceState{ID: "a"}.Ready(false)).To(BeFalse())
+			Expect(agent.ServiceState{ID: "a", Registered: true, Status: api.HealthCritical}.Ready(false)).To(BeTrue())
+			Expect(agent.ServiceState{ID: "a", Registered: true, Status: api.HealthCritical}.Ready(true)).To(BeFalse())
+			Expect(agent.ServiceState{ID: "a", Registered: true, Status: api.HealthPassing}.Ready(true)).To(BeTrue())
+		})
+
+		It("describes itself", func() {
+			Expect(agent.ServiceState{ID: "a"}.String()).To(Equal("a (not registered)"))
+			Expect(agent.ServiceState{ID: "a", Registered: true, Status: api.HealthCritical}.String()).To(Equal("a (critical)"))
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package certs
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Expiry describes when a certificate handed to the agent stops being valid.
+type Expiry struct {
+	File          string
+	CommonName    string
+	NotAfter      time.Time
+	DaysRemaining int
+	Expired       bool
+}
+
+// Expiries reports the expiry of every CA certificate in caFile and of the
+// leaf certificate in each of certFiles. DaysRemaining is rounded down, so it
+// is negative once a certificate has expired.
+func (v Verifier) Expiries(caFile string, certFiles []string) ([]Expiry, error) {
+	now := v.Clock.Now()
+
+	cas, err := LoadCertificates(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("ca_file %q: %s", caFile, err)
+	}
+
+	var expiries []Expiry
+	for _, ca := range cas {
+		expiries = append(expiries, newExpiry(caFile, ca.Subject.CommonName, ca.NotAfter, now))
+	}
+
+	for _, certFile := range certFiles {
+		certificates, err := LoadCertificates(certFile)
+		if err != nil {
+			return nil, fmt.Errorf("cert_file %q: %s", certFile, err)
+		}
+
+		leaf := certificates[0]
+		expiries = append(expiries, newExpiry(certFile, leaf.Subject.CommonName, leaf.NotAfter, now))
+	}
+
+	return expiries, nil
+}
+
+func newExpiry(file, commonName string, notAfter, now time.Time) Expiry {
+	return Expiry{
+		File:          file,
+		CommonName:    commonName,
+		NotAfter:      notAfter,
+		DaysRemaining: int(math.Floor(notAfter.Sub(now).Hours() / 24)),
+		Expired:       now.After(notAfter),
+	}
+}
+
+// WarningThreshold returns the smallest threshold, in days, that the expiry
+// falls within.
+func (e Expiry) WarningThreshold(thresholds []int) (int, bool) {
+	threshold, found := 0, false
+	for _, days := range thresholds {
+		if e.DaysRemaining < days && (!found || days < threshold) {
+			threshold, found = days, true
+		}
+	}
+
+	return threshold, found
+}
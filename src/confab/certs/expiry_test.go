@@ -0,0 +1,137 @@
+package certs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Expiries", func() {
+	var (
+		dir       string
+		now       time.Time
+		caFile    string
+		certFiles []string
+		verifier  certs.Verifier
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "certs")
+		Expect(err).NotTo(HaveOccurred())
+
+		now = time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+		ca := newKeyPair(certificateOptions{
+			commonName: "consul-ca",
+			notBefore:  now.Add(-24 * time.Hour),
+			notAfter:   now.Add(365 * 24 * time.Hour),
+			isCA:       true,
+		}, nil)
+
+		server := newKeyPair(certificateOptions{
+			commonName: "server",
+			notBefore:  now.Add(-24 * time.Hour),
+			notAfter:   now.Add(90 * 24 * time.Hour),
+		}, &ca)
+
+		agent := newKeyPair(certificateOptions{
+			commonName: "agent",
+			notBefore:  now.Add(-24 * time.Hour),
+			notAfter:   now.Add(6*24*time.Hour + time.Hour),
+		}, &ca)
+
+		caFile = writeCertificate(dir, "ca.crt", ca)
+		certFiles = []string{
+			writeCertificate(dir, "server.crt", server),
+			writeCertificate(dir, "agent.crt", agent),
+		}
+
+		clock := &fakes.Clock{}
+		clock.NowCall.Returns.Time = now
+		verifier = certs.Verifier{Clock: clock}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("reports the expiry of the CA and of each certificate", func() {
+		expiries, err := verifier.Expiries(caFile, certFiles)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(expiries).To(Equal([]certs.Expiry{
+			{
+				File:          caFile,
+				CommonName:    "consul-ca",
+				NotAfter:      now.Add(365 * 24 * time.Hour),
+				DaysRemaining: 365,
+			},
+			{
+				File:          certFiles[0],
+				CommonName:    "server",
+				NotAfter:      now.Add(90 * 24 * time.Hour),
+				DaysRemaining: 90,
+			},
+			{
+				File:          certFiles[1],
+				CommonName:    "agent",
+				NotAfter:      now.Add(6*24*time.Hour + time.Hour),
+				DaysRemaining: 6,
+			},
+		}))
+	})
+
+	It("reports expired certificates", func() {
+		clock := &fakes.Clock{}
+		clock.NowCall.Returns.Time = now.Add(8 * 24 * time.Hour)
+		verifier.Clock = clock
+
+		expiries, err := verifier.Expiries(caFile, certFiles)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(expiries[1].Expired).To(BeFalse())
+		Expect(expiries[2].Expired).To(BeTrue())
+		Expect(expiries[2].DaysRemaining).To(Equal(-2))
+	})
+
+	Context("failure cases", func() {
+		It("returns an error when the CA file cannot be read", func() {
+			caFile = filepath.Join(dir, "missing.crt")
+
+			_, err := verifier.Expiries(caFile, certFiles)
+			Expect(err).To(MatchError(ContainSubstring(`ca_file "` + caFile + `": could not be read`)))
+		})
+
+		It("returns an error when the cert file contains no certificate", func() {
+			Expect(ioutil.WriteFile(certFiles[1], []byte("banana"), 0600)).To(Succeed())
+
+			_, err := verifier.Expiries(caFile, certFiles)
+			Expect(err).To(MatchError(`cert_file "` + certFiles[1] + `": does not contain a PEM encoded certificate`))
+		})
+	})
+})
+
+var _ = Describe("Expiry", func() {
+	Describe("WarningThreshold", func() {
+		It("returns the smallest threshold the expiry falls within", func() {
+			threshold, ok := certs.Expiry{DaysRemaining: 5}.WarningThreshold([]int{30, 7})
+			Expect(ok).To(BeTrue())
+			Expect(threshold).To(Equal(7))
+
+			threshold, ok = certs.Expiry{DaysRemaining: 20}.WarningThreshold([]int{7, 30})
+			Expect(ok).To(BeTrue())
+			Expect(threshold).To(Equal(30))
+		})
+
+		It("returns false when no threshold has been reached", func() {
+			_, ok := certs.Expiry{DaysRemaining: 30}.WarningThreshold([]int{30, 7})
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
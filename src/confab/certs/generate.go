@@ -0,0 +1,193 @@
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultValidFor = 365 * 24 * time.Hour
+	defaultKeyBits  = 2048
+
+	// clockSkew backdates certificates so that nodes whose clocks lag
+	// slightly behind still accept them.
+	clockSkew = time.Hour
+)
+
+// GenerateOptions describe the TLS material to generate. Zero values fall
+// back to consul's dc1 datacenter and consul domain, a year of validity and
+// 2048 bit keys.
+type GenerateOptions struct {
+	Datacenter string
+	Domain     string
+	ValidFor   time.Duration
+	KeyBits    int
+}
+
+// Bundle is PEM-encoded TLS material for a consul cluster: a CA, a server
+// key pair shared by the servers and an agent key pair shared by the clients.
+type Bundle struct {
+	CACert     []byte
+	ServerCert []byte
+	ServerKey  []byte
+	AgentCert  []byte
+	AgentKey   []byte
+}
+
+// ServerName is the name consul expects server certificates to carry when
+// verify_server_hostname is enabled.
+func ServerName(datacenter, domain string) string {
+	if datacenter == "" {
+		datacenter = "dc1"
+	}
+
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" {
+		domain = "consul"
+	}
+
+	return fmt.Sprintf("server.%s.%s", datacenter, domain)
+}
+
+// Generate creates a new CA and uses it to sign the server and agent
+// certificates.
+func Generate(options GenerateOptions) (Bundle, error) {
+	if options.ValidFor == 0 {
+		options.ValidFor = defaultValidFor
+	}
+
+	if options.KeyBits == 0 {
+		options.KeyBits = defaultKeyBits
+	}
+
+	notBefore := time.Now().Add(-clockSkew)
+	notAfter := notBefore.Add(clockSkew + options.ValidFor)
+
+	caKey, err := rsa.GenerateKey(rand.Reader, options.KeyBits)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("ca key could not be generated: %s", err)
+	}
+
+	caTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "consulCA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := createCertificate(caTemplate, caTemplate, caKey, caKey)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("ca certificate could not be created: %s", err)
+	}
+
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("ca certificate could not be parsed: %s", err)
+	}
+
+	serverName := ServerName(options.Datacenter, options.Domain)
+	serverCert, serverKey, err := issue(ca, caKey, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: serverName},
+		DNSNames:    []string{serverName, "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+	}, options.KeyBits)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("server certificate could not be created: %s", err)
+	}
+
+	agentCert, agentKey, err := issue(ca, caKey, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "consul agent"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+	}, options.KeyBits)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("agent certificate could not be created: %s", err)
+	}
+
+	return Bundle{
+		CACert:     encodeCertificate(caDER),
+		ServerCert: serverCert,
+		ServerKey:  serverKey,
+		AgentCert:  agentCert,
+		AgentKey:   agentKey,
+	}, nil
+}
+
+// Write saves the bundle in the layout confab expects under certs_dir.
+func (b Bundle) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data []byte
+		mode os.FileMode
+	}{
+		{"ca.crt", b.CACert, 0644},
+		{"server.crt", b.ServerCert, 0644},
+		{"server.key", b.ServerKey, 0600},
+		{"agent.crt", b.AgentCert, 0644},
+		{"agent.key", b.AgentKey, 0600},
+	}
+
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file.name), file.data, file.mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// issue signs a key pair for both ends of a connection: consul servers dial
+// each other and agents serve their own API when verify_incoming is on.
+func issue(ca *x509.Certificate, caKey *rsa.PrivateKey, template *x509.Certificate, keyBits int) ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	der, err := createCertificate(template, ca, key, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	return encodeCertificate(der), keyPEM, nil
+}
+
+func createCertificate(template, parent *x509.Certificate, key, parentKey *rsa.PrivateKey) ([]byte, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serialNumber
+
+	return x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+}
+
+func encodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
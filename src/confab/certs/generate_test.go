@@ -0,0 +1,128 @@
+package certs_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Generate", func() {
+	var (
+		dir      string
+		bundle   certs.Bundle
+		verifier certs.Verifier
+	)
+
+	parseCertificate := func(data []byte) *x509.Certificate {
+		block, _ := pem.Decode(data)
+		Expect(block).NotTo(BeNil())
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+
+		return certificate
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "certs")
+		Expect(err).NotTo(HaveOccurred())
+
+		bundle, err = certs.Generate(certs.GenerateOptions{
+			Datacenter: "dc2",
+			Domain:     "cf.internal.",
+			ValidFor:   30 * 24 * time.Hour,
+			KeyBits:    1024,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		clock := &fakes.Clock{}
+		clock.NowCall.Returns.Time = time.Now()
+		verifier = certs.Verifier{Clock: clock}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("writes the bundle in the layout confab expects", func() {
+		Expect(bundle.Write(filepath.Join(dir, "certs"))).To(Succeed())
+
+		for _, name := range []string{"ca.crt", "server.crt", "agent.crt"} {
+			info, err := os.Stat(filepath.Join(dir, "certs", name))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+		}
+
+		for _, name := range []string{"server.key", "agent.key"} {
+			info, err := os.Stat(filepath.Join(dir, "certs", name))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		}
+	})
+
+	It("creates a server certificate consul accepts for the datacenter", func() {
+		Expect(bundle.Write(dir)).To(Succeed())
+
+		Expect(verifier.Verify(certs.Files{
+			CA:   filepath.Join(dir, "ca.crt"),
+			Cert: filepath.Join(dir, "server.crt"),
+			Key:  filepath.Join(dir, "server.key"),
+		}, "server.dc2.cf.internal")).To(Succeed())
+	})
+
+	It("creates an agent certificate signed by the same CA", func() {
+		Expect(bundle.Write(dir)).To(Succeed())
+
+		Expect(verifier.Verify(certs.Files{
+			CA:   filepath.Join(dir, "ca.crt"),
+			Cert: filepath.Join(dir, "agent.crt"),
+			Key:  filepath.Join(dir, "agent.key"),
+		}, "")).To(Succeed())
+
+		agent := parseCertificate(bundle.AgentCert)
+		Expect(agent.Subject.CommonName).To(Equal("consul agent"))
+		Expect(agent.ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth))
+	})
+
+	It("makes the certificates valid for the requested period", func() {
+		for _, data := range [][]byte{bundle.CACert, bundle.ServerCert, bundle.AgentCert} {
+			certificate := parseCertificate(data)
+			Expect(certificate.NotBefore).To(BeTemporally("<", time.Now()))
+			Expect(certificate.NotAfter).To(BeTemporally("~", time.Now().Add(30*24*time.Hour), time.Minute))
+		}
+	})
+
+	It("defaults to consul's datacenter and domain", func() {
+		var err error
+		bundle, err = certs.Generate(certs.GenerateOptions{KeyBits: 1024})
+		Expect(err).NotTo(HaveOccurred())
+
+		server := parseCertificate(bundle.ServerCert)
+		Expect(server.DNSNames).To(ContainElement("server.dc1.consul"))
+		Expect(parseCertificate(bundle.CACert).NotAfter).To(BeTemporally("~", time.Now().Add(365*24*time.Hour), time.Minute))
+	})
+
+	Context("failure cases", func() {
+		It("returns an error when the directory cannot be created", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "file"), []byte{}, 0600)).To(Succeed())
+			Expect(bundle.Write(filepath.Join(dir, "file", "certs"))).To(MatchError(ContainSubstring("not a directory")))
+		})
+	})
+})
+
+var _ = Describe("ServerName", func() {
+	It("is the name consul requires of server certificates", func() {
+		Expect(certs.ServerName("dc2", "cf.internal.")).To(Equal("server.dc2.cf.internal"))
+		Expect(certs.ServerName("", "")).To(Equal("server.dc1.consul"))
+	})
+})
@@ -0,0 +1,89 @@
+package certs_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCerts(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "certs")
+}
+
+type certificateOptions struct {
+	commonName string
+	dnsNames   []string
+	notBefore  time.Time
+	notAfter   time.Time
+	isCA       bool
+}
+
+type keyPair struct {
+	certificate *x509.Certificate
+	key         *rsa.PrivateKey
+}
+
+var serialNumber int64
+
+func newKeyPair(options certificateOptions, parent *keyPair) keyPair {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	Expect(err).NotTo(HaveOccurred())
+
+	serialNumber++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serialNumber),
+		Subject:               pkix.Name{CommonName: options.commonName},
+		DNSNames:              options.dnsNames,
+		NotBefore:             options.notBefore,
+		NotAfter:              options.notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	if options.isCA {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		template.ExtKeyUsage = nil
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.certificate, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	certificate, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+
+	return keyPair{certificate: certificate, key: key}
+}
+
+func writeCertificate(dir, name string, pair keyPair) string {
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.certificate.Raw})
+	Expect(ioutil.WriteFile(path, data, 0600)).To(Succeed())
+
+	return path
+}
+
+func writeKey(dir, name string, pair keyPair) string {
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pair.key)})
+	Expect(ioutil.WriteFile(path, data, 0600)).To(Succeed())
+
+	return path
+}
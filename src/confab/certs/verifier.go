@@ -0,0 +1,162 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+const timeFormat = time.RFC3339
+
+// Files are the paths of the TLS material handed to the consul agent.
+type Files struct {
+	CA   string
+	Cert string
+	Key  string
+}
+
+type clock interface {
+	Now() time.Time
+}
+
+// Verifier checks TLS material. AllowExpired accepts certificates past their
+// expiry, checking the chain as of the earliest expiry instead.
+type Verifier struct {
+	Clock        clock
+	AllowExpired bool
+}
+
+// Verify checks that the key matches the certificate, the certificate chains
+// to the CA and that both are currently valid. When serverName is not empty
+// the certificate must also be valid for that name, which is how consul's
+// verify_server_hostname identifies servers.
+func (v Verifier) Verify(files Files, serverName string) error {
+	now := v.Clock.Now()
+
+	cas, err := LoadCertificates(files.CA)
+	if err != nil {
+		return fmt.Errorf("ca_file %q: %s", files.CA, err)
+	}
+
+	for _, ca := range cas {
+		if err := v.checkValidity(ca, now); err != nil {
+			return fmt.Errorf("ca_file %q: %s", files.CA, err)
+		}
+	}
+
+	certPEM, err := ioutil.ReadFile(files.Cert)
+	if err != nil {
+		return fmt.Errorf("cert_file %q could not be read: %s", files.Cert, err)
+	}
+
+	keyPEM, err := ioutil.ReadFile(files.Key)
+	if err != nil {
+		return fmt.Errorf("key_file %q could not be read: %s", files.Key, err)
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("cert_file %q and key_file %q do not form a key pair: %s", files.Cert, files.Key, err)
+	}
+
+	chain := make([]*x509.Certificate, len(pair.Certificate))
+	for i, der := range pair.Certificate {
+		chain[i], err = x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("cert_file %q could not be parsed: %s", files.Cert, err)
+		}
+	}
+	leaf := chain[0]
+
+	if err := v.checkValidity(leaf, now); err != nil {
+		return fmt.Errorf("cert_file %q: %s", files.Cert, err)
+	}
+
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	verifyAt := now
+	if v.AllowExpired {
+		for _, cert := range append(cas, chain...) {
+			if cert.NotAfter.Before(verifyAt) {
+				verifyAt = cert.NotAfter
+			}
+		}
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   verifyAt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("cert_file %q is not signed by ca_file %q: %s", files.Cert, files.CA, err)
+	}
+
+	if serverName != "" {
+		if err := leaf.VerifyHostname(serverName); err != nil {
+			return fmt.Errorf("cert_file %q is not valid for %q, which consul requires of servers: %s", files.Cert, serverName, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadCertificates reads every PEM encoded certificate in path.
+func LoadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not be read: %s", err)
+	}
+
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not be parsed: %s", err)
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("does not contain a PEM encoded certificate")
+	}
+
+	return certificates, nil
+}
+
+func (v Verifier) checkValidity(certificate *x509.Certificate, now time.Time) error {
+	if now.Before(certificate.NotBefore) {
+		return fmt.Errorf("certificate %q is not valid until %s", certificate.Subject.CommonName,
+			certificate.NotBefore.UTC().Format(timeFormat))
+	}
+
+	if now.After(certificate.NotAfter) && !v.AllowExpired {
+		return fmt.Errorf("certificate %q expired at %s", certificate.Subject.CommonName,
+			certificate.NotAfter.UTC().Format(timeFormat))
+	}
+
+	return nil
+}
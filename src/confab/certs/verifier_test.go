@@ -0,0 +1,196 @@
+package certs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verifier", func() {
+	var (
+		dir      string
+		now      time.Time
+		ca       keyPair
+		server   keyPair
+		files    certs.Files
+		verifier certs.Verifier
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "certs")
+		Expect(err).NotTo(HaveOccurred())
+
+		now = time.Date(2016, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+		ca = newKeyPair(certificateOptions{
+			commonName: "consul-ca",
+			notBefore:  now.Add(-24 * time.Hour),
+			notAfter:   now.Add(365 * 24 * time.Hour),
+			isCA:       true,
+		}, nil)
+
+		server = newKeyPair(certificateOptions{
+			commonName: "server.dc1.cf.internal",
+			dnsNames:   []string{"server.dc1.cf.internal"},
+			notBefore:  now.Add(-24 * time.Hour),
+			notAfter:   now.Add(30 * 24 * time.Hour),
+		}, &ca)
+
+		files = certs.Files{
+			CA:   writeCertificate(dir, "ca.crt", ca),
+			Cert: writeCertificate(dir, "server.crt", server),
+			Key:  writeKey(dir, "server.key", server),
+		}
+
+		clock := &fakes.Clock{}
+		clock.NowCall.Returns.Time = now
+		verifier = certs.Verifier{Clock: clock}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("accepts a matching key pair signed by the CA", func() {
+		Expect(verifier.Verify(files, "")).To(Succeed())
+	})
+
+	It("accepts a server certificate carrying the server name", func() {
+		Expect(verifier.Verify(files, "server.dc1.cf.internal")).To(Succeed())
+	})
+
+	It("accepts a certificate signed by an intermediate included in the cert file", func() {
+		intermediate := newKeyPair(certificateOptions{
+			commonName: "consul-intermediate",
+			notBefore:  now.Add(-24 * time.Hour),
+			notAfter:   now.Add(365 * 24 * time.Hour),
+			isCA:       true,
+		}, &ca)
+		agent := newKeyPair(certificateOptions{
+			commonName: "agent",
+			notBefore:  now.Add(-24 * time.Hour),
+			notAfter:   now.Add(30 * 24 * time.Hour),
+		}, &intermediate)
+
+		leaf, err := ioutil.ReadFile(writeCertificate(dir, "leaf.crt", agent))
+		Expect(err).NotTo(HaveOccurred())
+		chain, err := ioutil.ReadFile(writeCertificate(dir, "intermediate.crt", intermediate))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "agent.crt"), append(leaf, chain...), 0600)).To(Succeed())
+
+		files.Cert = filepath.Join(dir, "agent.crt")
+		files.Key = writeKey(dir, "agent.key", agent)
+		Expect(verifier.Verify(files, "")).To(Succeed())
+	})
+
+	Context("when expired certificates are allowed", func() {
+		It("accepts an expired certificate that is otherwise valid", func() {
+			expired := newKeyPair(certificateOptions{
+				commonName: "expired",
+				notBefore:  now.Add(-48 * time.Hour),
+				notAfter:   now.Add(-24 * time.Hour),
+			}, &ca)
+			files.Cert = writeCertificate(dir, "expired.crt", expired)
+			files.Key = writeKey(dir, "expired.key", expired)
+
+			verifier.AllowExpired = true
+			Expect(verifier.Verify(files, "")).To(Succeed())
+		})
+
+		It("still rejects a certificate signed by another CA", func() {
+			otherCA := newKeyPair(certificateOptions{
+				commonName: "other-ca",
+				notBefore:  now.Add(-48 * time.Hour),
+				notAfter:   now.Add(-time.Hour),
+				isCA:       true,
+			}, nil)
+			files.CA = writeCertificate(dir, "other-ca.crt", otherCA)
+
+			verifier.AllowExpired = true
+			Expect(verifier.Verify(files, "")).To(MatchError(ContainSubstring("is not signed by ca_file")))
+		})
+	})
+
+	Context("failure cases", func() {
+		It("returns an error when the CA file is missing", func() {
+			files.CA = filepath.Join(dir, "missing.crt")
+			Expect(verifier.Verify(files, "")).To(MatchError(ContainSubstring(`ca_file "` + files.CA + `": could not be read`)))
+		})
+
+		It("returns an error when the CA file contains no certificate", func() {
+			Expect(ioutil.WriteFile(files.CA, []byte("not a certificate"), 0600)).To(Succeed())
+			Expect(verifier.Verify(files, "")).To(MatchError(`ca_file "` + files.CA + `": does not contain a PEM encoded certificate`))
+		})
+
+		It("returns an error when the CA has expired", func() {
+			expired := newKeyPair(certificateOptions{
+				commonName: "consul-ca",
+				notBefore:  now.Add(-48 * time.Hour),
+				notAfter:   now.Add(-time.Hour),
+				isCA:       true,
+			}, nil)
+			files.CA = writeCertificate(dir, "ca.crt", expired)
+
+			Expect(verifier.Verify(files, "")).To(MatchError(`ca_file "` + files.CA + `": certificate "consul-ca" expired at 2016-05-31T23:00:00Z`))
+		})
+
+		It("returns an error when the key does not match the certificate", func() {
+			other := newKeyPair(certificateOptions{
+				commonName: "other",
+				notBefore:  now.Add(-24 * time.Hour),
+				notAfter:   now.Add(24 * time.Hour),
+			}, &ca)
+			files.Key = writeKey(dir, "other.key", other)
+
+			Expect(verifier.Verify(files, "")).To(MatchError(ContainSubstring(`cert_file "` + files.Cert + `" and key_file "` + files.Key + `" do not form a key pair`)))
+		})
+
+		It("returns an error when the certificate is not yet valid", func() {
+			future := newKeyPair(certificateOptions{
+				commonName: "future",
+				notBefore:  now.Add(time.Hour),
+				notAfter:   now.Add(24 * time.Hour),
+			}, &ca)
+			files.Cert = writeCertificate(dir, "future.crt", future)
+			files.Key = writeKey(dir, "future.key", future)
+
+			Expect(verifier.Verify(files, "")).To(MatchError(`cert_file "` + files.Cert + `": certificate "future" is not valid until 2016-06-01T01:00:00Z`))
+		})
+
+		It("returns an error when the certificate has expired", func() {
+			expired := newKeyPair(certificateOptions{
+				commonName: "expired",
+				notBefore:  now.Add(-48 * time.Hour),
+				notAfter:   now.Add(-24 * time.Hour),
+			}, &ca)
+			files.Cert = writeCertificate(dir, "expired.crt", expired)
+			files.Key = writeKey(dir, "expired.key", expired)
+
+			Expect(verifier.Verify(files, "")).To(MatchError(`cert_file "` + files.Cert + `": certificate "expired" expired at 2016-05-31T00:00:00Z`))
+		})
+
+		It("returns an error when the certificate is signed by another CA", func() {
+			otherCA := newKeyPair(certificateOptions{
+				commonName: "other-ca",
+				notBefore:  now.Add(-24 * time.Hour),
+				notAfter:   now.Add(365 * 24 * time.Hour),
+				isCA:       true,
+			}, nil)
+			files.CA = writeCertificate(dir, "other-ca.crt", otherCA)
+
+			Expect(verifier.Verify(files, "")).To(MatchError(ContainSubstring(`cert_file "` + files.Cert + `" is not signed by ca_file "` + files.CA + `"`)))
+		})
+
+		It("returns an error when a server certificate lacks the server name", func() {
+			Expect(verifier.Verify(files, "server.dc2.cf.internal")).To(MatchError(ContainSubstring(`cert_file "` + files.Cert + `" is not valid for "server.dc2.cf.internal", which consul requires of servers`)))
+		})
+	})
+})
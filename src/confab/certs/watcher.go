@@ -0,0 +1,61 @@
+package certs
+
+import (
+	"os"
+	"time"
+)
+
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// Watcher notices when any of the TLS files is replaced, modified or removed
+// by polling their modification times and sizes.
+type Watcher struct {
+	paths  []string
+	states map[string]fileState
+}
+
+// NewWatcher records the current state of the files so that only later
+// changes are reported.
+func NewWatcher(files Files) *Watcher {
+	w := &Watcher{
+		paths:  []string{files.CA, files.Cert, files.Key},
+		states: map[string]fileState{},
+	}
+
+	for _, path := range w.paths {
+		w.states[path] = stat(path)
+	}
+
+	return w
+}
+
+// Changed reports whether any file differs from when it was last looked at.
+func (w *Watcher) Changed() bool {
+	var changed bool
+	for _, path := range w.paths {
+		state := stat(path)
+		if state != w.states[path] {
+			w.states[path] = state
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func stat(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+
+	return fileState{
+		exists:  true,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+}
@@ -0,0 +1,73 @@
+package certs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Watcher", func() {
+	var (
+		dir     string
+		files   certs.Files
+		watcher *certs.Watcher
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "certs")
+		Expect(err).NotTo(HaveOccurred())
+
+		files = certs.Files{
+			CA:   filepath.Join(dir, "ca.crt"),
+			Cert: filepath.Join(dir, "agent.crt"),
+			Key:  filepath.Join(dir, "agent.key"),
+		}
+
+		for _, path := range []string{files.CA, files.Cert, files.Key} {
+			Expect(ioutil.WriteFile(path, []byte("original"), 0600)).To(Succeed())
+		}
+
+		watcher = certs.NewWatcher(files)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("does not report files that have not changed", func() {
+		Expect(watcher.Changed()).To(BeFalse())
+	})
+
+	It("reports a file that has been modified once", func() {
+		later := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(files.Cert, later, later)).To(Succeed())
+
+		Expect(watcher.Changed()).To(BeTrue())
+		Expect(watcher.Changed()).To(BeFalse())
+	})
+
+	It("reports a file whose size has changed", func() {
+		info, err := os.Stat(files.Key)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.WriteFile(files.Key, []byte("rotated key"), 0600)).To(Succeed())
+		Expect(os.Chtimes(files.Key, info.ModTime(), info.ModTime())).To(Succeed())
+
+		Expect(watcher.Changed()).To(BeTrue())
+	})
+
+	It("reports a file that has been removed or created", func() {
+		Expect(os.Remove(files.CA)).To(Succeed())
+		Expect(watcher.Changed()).To(BeTrue())
+
+		Expect(ioutil.WriteFile(files.CA, []byte("replaced"), 0600)).To(Succeed())
+		Expect(watcher.Changed()).To(BeTrue())
+	})
+})
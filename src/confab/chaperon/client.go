@@ -26,6 +26,14 @@ func NewClient(controller controller, newRPCClient consulRPCClientConstructor, k
 }
 
 func (c Client) Start(cfg config.Config, timeout confab.Timeout) error {
+	if err := c.controller.VerifyConsulVersion(); err != nil {
+		return err
+	}
+
+	if err := c.controller.VerifyTLS(); err != nil {
+		return err
+	}
+
 	if err := c.configWriter.Write(cfg); err != nil {
 		return err
 	}
@@ -42,7 +50,7 @@ func (c Client) Start(cfg config.Config, timeout confab.Timeout) error {
 		return err
 	}
 
-	if err := c.controller.ConfigureClient(); err != nil {
+	if err := c.controller.ConfigureClient(timeout); err != nil {
 		return err
 	}
 
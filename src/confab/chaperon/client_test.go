@@ -3,10 +3,10 @@ package chaperon_test
 import (
 	"errors"
 
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/chaperon"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
-	consulagent "github.com/hashicorp/consul/command/agent"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -21,7 +21,7 @@ var _ = Describe("Client", func() {
 		configWriter   *fakes.ConfigWriter
 		cfg            config.Config
 
-		rpcClient   *consulagent.RPCClient
+		rpcClient   *fakes.FakeconsulRPCClient
 		rpcEndpoint string
 	)
 
@@ -37,8 +37,8 @@ var _ = Describe("Client", func() {
 			},
 		}
 
-		rpcClient = &consulagent.RPCClient{}
-		rpcClientConstructor := func(endpoint string) (*consulagent.RPCClient, error) {
+		rpcClient = &fakes.FakeconsulRPCClient{}
+		rpcClientConstructor := func(endpoint string) (agent.ConsulRPCClient, error) {
 			rpcEndpoint = endpoint
 			return rpcClient, nil
 		}
@@ -46,6 +46,18 @@ var _ = Describe("Client", func() {
 		client = chaperon.NewClient(controller, rpcClientConstructor, keyringRemover, configWriter)
 	})
 
+	It("verifies the installed consul version", func() {
+		err := client.Start(cfg, timeout)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controller.VerifyConsulVersionCall.CallCount).To(Equal(1))
+	})
+
+	It("verifies the tls material", func() {
+		err := client.Start(cfg, timeout)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controller.VerifyTLSCall.CallCount).To(Equal(1))
+	})
+
 	It("writes the consul configuration file", func() {
 		err := client.Start(cfg, timeout)
 		Expect(err).NotTo(HaveOccurred())
@@ -75,9 +87,31 @@ var _ = Describe("Client", func() {
 		err := client.Start(cfg, timeout)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(controller.ConfigureClientCall.CallCount).To(Equal(1))
+		Expect(controller.ConfigureClientCall.Receives.Timeout).To(Equal(timeout))
 	})
 
 	Context("failure cases", func() {
+		Context("when the consul version is not supported", func() {
+			It("returns an error", func() {
+				controller.VerifyConsulVersionCall.Returns.Error = errors.New("unsupported version")
+
+				err := client.Start(cfg, timeout)
+				Expect(err).To(MatchError(errors.New("unsupported version")))
+				Expect(controller.BootAgentCall.CallCount).To(Equal(0))
+			})
+		})
+
+		Context("when the tls material is invalid", func() {
+			It("returns an error", func() {
+				controller.VerifyTLSCall.Returns.Error = errors.New("invalid certificate")
+
+				err := client.Start(cfg, timeout)
+				Expect(err).To(MatchError(errors.New("invalid certificate")))
+				Expect(configWriter.WriteCall.CallCount).To(Equal(0))
+				Expect(controller.BootAgentCall.CallCount).To(Equal(0))
+			})
+		})
+
 		Context("when writing the consul config file fails", func() {
 			It("returns an error", func() {
 				configWriter.WriteCall.Returns.Error = errors.New("failed to write config")
@@ -136,7 +170,7 @@ var _ = Describe("Client", func() {
 		Context("failure cases", func() {
 			Context("when constructing an RPC client fails", func() {
 				It("returns an error", func() {
-					client = chaperon.NewClient(controller, func(string) (*consulagent.RPCClient, error) {
+					client = chaperon.NewClient(controller, func(string) (agent.ConsulRPCClient, error) {
 						return nil, errors.New("failed to create rpc client")
 					}, keyringRemover, configWriter)
 
@@ -6,34 +6,95 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
 	"github.com/pivotal-golang/lager"
 )
 
+type clusterDetector interface {
+	HasRaftState() bool
+	Leader(servers []string) string
+}
+
 type ConfigWriter struct {
-	dir    string
-	logger logger
+	dir             string
+	resolver        config.Resolver
+	clusterDetector clusterDetector
+	logger          logger
 }
 
-func NewConfigWriter(dir string, logger logger) ConfigWriter {
+func NewConfigWriter(dir string, resolver config.Resolver, clusterDetector clusterDetector, logger logger) ConfigWriter {
 	return ConfigWriter{
-		dir:    dir,
-		logger: logger,
+		dir:             dir,
+		resolver:        resolver,
+		clusterDetector: clusterDetector,
+		logger:          logger,
 	}
 }
 
 func (w ConfigWriter) Write(cfg config.Config) error {
+	if w.resolver != nil {
+		w.logger.Info("config-writer.write.resolve-servers", lager.Data{
+			"servers": cfg.Consul.Agent.Servers.LAN,
+		})
+
+		servers, err := config.ResolveServers(w.resolver, cfg.Consul.Agent.Servers.LAN)
+		if err != nil {
+			w.logger.Error("config-writer.write.resolve-servers.failed", err)
+			return err
+		}
+
+		cfg.Consul.Agent.Servers.LAN = servers
+	}
+
 	w.logger.Info("config-writer.write.generate-configuration")
 	consulConfig := config.GenerateConfiguration(cfg)
 
-	data, err := json.Marshal(&consulConfig)
+	if consulConfig.BootstrapExpect != nil && w.clusterDetector != nil {
+		w.logger.Info("config-writer.write.detect-cluster")
+		if w.clusterDetector.HasRaftState() {
+			w.logger.Info("config-writer.write.detect-cluster.skip-bootstrap", lager.Data{
+				"reason": "the data dir holds raft state",
+			})
+			consulConfig.BootstrapExpect = nil
+		} else if !cfg.Consul.Agent.ServesRemoteHTTP() {
+			// consul's HTTP API listens on loopback by default, so the other
+			// servers cannot be asked for a leader.
+			w.logger.Info("config-writer.write.detect-cluster.skip-probe", lager.Data{
+				"reason": "the http api only listens on loopback, set consul.agent.client_addr or consul.agent.addresses.http to probe the other servers",
+			})
+		} else if leader := w.clusterDetector.Leader(cfg.Consul.Agent.Servers.LAN); leader != "" {
+			w.logger.Info("config-writer.write.detect-cluster.skip-bootstrap", lager.Data{
+				"reason": "a cluster with a leader is reachable",
+				"leader": leader,
+			})
+			consulConfig.BootstrapExpect = nil
+		}
+	}
+
+	var rendered interface{} = &consulConfig
+	if extra := cfg.Consul.Agent.ExtraConfig; len(extra) > 0 {
+		w.logger.Info("config-writer.write.merge-extra-config", lager.Data{
+			"keys": extraConfigKeys(extra),
+		})
+
+		merged, err := config.MergeExtraConfig(consulConfig, extra)
+		if err != nil {
+			w.logger.Error("config-writer.write.merge-extra-config.failed", err)
+			return err
+		}
+
+		rendered = merged
+	}
+
+	data, err := json.Marshal(rendered)
 	if err != nil {
 		return err
 	}
 
 	w.logger.Info("config-writer.write.write-file", lager.Data{
-		"config": consulConfig,
+		"config": consulConfig.Redacted(),
 	})
 	err = ioutil.WriteFile(filepath.Join(w.dir, "config.json"), data, os.ModePerm)
 	if err != nil {
@@ -44,3 +105,13 @@ func (w ConfigWriter) Write(cfg config.Config) error {
 	w.logger.Info("config-writer.write.success")
 	return nil
 }
+
+func extraConfigKeys(extra map[string]interface{}) []string {
+	var keys []string
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -1,6 +1,8 @@
 package chaperon_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -37,7 +39,7 @@ var _ = Describe("ConfigWriter", func() {
 			cfg.Node = config.ConfigNode{Name: "node", Index: 0}
 			cfg.Path.ConsulConfigDir = configDir
 
-			writer = chaperon.NewConfigWriter(configDir, logger)
+			writer = chaperon.NewConfigWriter(configDir, nil, nil, logger)
 		})
 
 		It("writes a config file to the consul_config dir", func() {
@@ -78,7 +80,7 @@ var _ = Describe("ConfigWriter", func() {
 				{
 					Action: "config-writer.write.write-file",
 					Data: []lager.Data{{
-						"config": config.GenerateConfiguration(cfg),
+						"config": config.GenerateConfiguration(cfg).Redacted(),
 					}},
 				},
 				{
@@ -87,6 +89,190 @@ var _ = Describe("ConfigWriter", func() {
 			}))
 		})
 
+		It("does not log acl tokens", func() {
+			cfg.Consul.Agent.Mode = "server"
+			cfg.Consul.Agent.ACL.MasterToken = "some-master-token"
+			cfg.Consul.Agent.ACL.AgentToken = "some-agent-token"
+
+			err := writer.Write(cfg)
+			Expect(err).NotTo(HaveOccurred())
+
+			buf, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf)).To(ContainSubstring(`"acl_master_token":"some-master-token"`))
+			Expect(string(buf)).To(ContainSubstring(`"acl_agent_token":"some-agent-token"`))
+			Expect(string(buf)).NotTo(ContainSubstring(`"acl_token"`))
+
+			messages, err := json.Marshal(logger.Messages)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(messages)).To(ContainSubstring(`"acl_master_token":"[redacted]"`))
+			Expect(string(messages)).NotTo(ContainSubstring("some-master-token"))
+			Expect(string(messages)).NotTo(ContainSubstring("some-agent-token"))
+		})
+
+		It("deep-merges extra_config into the generated configuration", func() {
+			cfg.Consul.Agent.ExtraConfig = map[string]interface{}{
+				"ports": map[string]interface{}{
+					"http": 8501,
+				},
+				"log_level": "trace",
+				"ui":        true,
+			}
+
+			err := writer.Write(cfg)
+			Expect(err).NotTo(HaveOccurred())
+
+			buf, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var written map[string]interface{}
+			Expect(json.Unmarshal(buf, &written)).To(Succeed())
+			Expect(written["ports"]).To(Equal(map[string]interface{}{
+				"dns":  float64(53),
+				"http": float64(8501),
+			}))
+			Expect(written["log_level"]).To(Equal("trace"))
+			Expect(written["ui"]).To(BeTrue())
+			Expect(written["node_name"]).To(Equal("node-0"))
+
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "config-writer.write.merge-extra-config",
+					Data: []lager.Data{{
+						"keys": []string{"log_level", "ports", "ui"},
+					}},
+				},
+			}))
+		})
+
+		Context("when servers are listed by name", func() {
+			var resolver *fakes.Resolver
+
+			BeforeEach(func() {
+				resolver = &fakes.Resolver{}
+				resolver.LookupHostCall.Returns.Addresses = map[string][]string{
+					"consul.service.internal": {"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+				}
+
+				cfg.Consul.Agent.Mode = "server"
+				cfg.Consul.Agent.Servers.LAN = []string{"consul.service.internal"}
+				writer = chaperon.NewConfigWriter(configDir, resolver, nil, logger)
+			})
+
+			It("joins and expects the resolved servers", func() {
+				Expect(writer.Write(cfg)).To(Succeed())
+
+				buf, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+				Expect(err).NotTo(HaveOccurred())
+
+				var written map[string]interface{}
+				Expect(json.Unmarshal(buf, &written)).To(Succeed())
+				Expect(written["retry_join"]).To(Equal([]interface{}{"10.0.0.1", "10.0.0.2", "10.0.0.3"}))
+				Expect(written["bootstrap_expect"]).To(Equal(float64(3)))
+
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "config-writer.write.resolve-servers",
+						Data: []lager.Data{{
+							"servers": []string{"consul.service.internal"},
+						}},
+					},
+					{
+						Action: "config-writer.write.generate-configuration",
+					},
+				}))
+			})
+
+			It("returns an error when the servers cannot be resolved", func() {
+				resolver.LookupHostCall.Returns.Error = errors.New("lookup failed")
+
+				err := writer.Write(cfg)
+				Expect(err).To(MatchError(`resolving server "consul.service.internal": lookup failed`))
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "config-writer.write.resolve-servers.failed",
+					Error:  err,
+				}))
+			})
+		})
+
+		Context("when a server checks for an existing cluster", func() {
+			var clusterDetector *fakes.ClusterDetector
+
+			readBootstrapExpect := func() interface{} {
+				buf, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+				Expect(err).NotTo(HaveOccurred())
+
+				var written map[string]interface{}
+				Expect(json.Unmarshal(buf, &written)).To(Succeed())
+				return written["bootstrap_expect"]
+			}
+
+			BeforeEach(func() {
+				clusterDetector = &fakes.ClusterDetector{}
+
+				cfg.Consul.Agent.Mode = "server"
+				cfg.Consul.Agent.ClientAddr = "0.0.0.0"
+				cfg.Consul.Agent.Servers.LAN = []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+				writer = chaperon.NewConfigWriter(configDir, nil, clusterDetector, logger)
+			})
+
+			It("bootstraps when no cluster exists yet", func() {
+				Expect(writer.Write(cfg)).To(Succeed())
+				Expect(readBootstrapExpect()).To(Equal(float64(3)))
+				Expect(clusterDetector.LeaderCall.Receives.Servers).To(Equal([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}))
+			})
+
+			It("does not bootstrap with raft state from an earlier run", func() {
+				clusterDetector.HasRaftStateCall.Returns.HasRaftState = true
+
+				Expect(writer.Write(cfg)).To(Succeed())
+				Expect(readBootstrapExpect()).To(BeNil())
+				Expect(clusterDetector.LeaderCall.CallCount).To(Equal(0))
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "config-writer.write.detect-cluster.skip-bootstrap",
+					Data: []lager.Data{{
+						"reason": "the data dir holds raft state",
+					}},
+				}))
+			})
+
+			It("does not bootstrap a second cluster when one with a leader is reachable", func() {
+				clusterDetector.LeaderCall.Returns.Leader = "10.0.0.2:8300"
+
+				Expect(writer.Write(cfg)).To(Succeed())
+				Expect(readBootstrapExpect()).To(BeNil())
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "config-writer.write.detect-cluster.skip-bootstrap",
+					Data: []lager.Data{{
+						"reason": "a cluster with a leader is reachable",
+						"leader": "10.0.0.2:8300",
+					}},
+				}))
+			})
+
+			It("does not probe the servers when their http api only listens on loopback", func() {
+				cfg.Consul.Agent.ClientAddr = ""
+
+				Expect(writer.Write(cfg)).To(Succeed())
+				Expect(readBootstrapExpect()).To(Equal(float64(3)))
+				Expect(clusterDetector.LeaderCall.CallCount).To(Equal(0))
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "config-writer.write.detect-cluster.skip-probe",
+					Data: []lager.Data{{
+						"reason": "the http api only listens on loopback, set consul.agent.client_addr or consul.agent.addresses.http to probe the other servers",
+					}},
+				}))
+			})
+
+			It("does not look for a cluster on clients", func() {
+				cfg.Consul.Agent.Mode = "client"
+
+				Expect(writer.Write(cfg)).To(Succeed())
+				Expect(clusterDetector.HasRaftStateCall.CallCount).To(Equal(0))
+				Expect(clusterDetector.LeaderCall.CallCount).To(Equal(0))
+			})
+		})
+
 		Context("failure cases", func() {
 			It("returns an error when the config file can't be written to", func() {
 				err := os.Chmod(configDir, 0000)
@@ -102,7 +288,7 @@ var _ = Describe("ConfigWriter", func() {
 					{
 						Action: "config-writer.write.write-file",
 						Data: []lager.Data{{
-							"config": config.GenerateConfiguration(cfg),
+							"config": config.GenerateConfiguration(cfg).Redacted(),
 						}},
 					},
 					{
@@ -2,12 +2,17 @@ package chaperon
 
 import (
 	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/cloudfoundry-incubator/consul-release/src/confab"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
-	consulagent "github.com/hashicorp/consul/command/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/keyring"
 	"github.com/pivotal-golang/lager"
 )
 
@@ -21,14 +26,22 @@ type agentRunner interface {
 	Wait() error
 	Cleanup() error
 	WritePID() error
+	Version() (string, error)
+	Reload() error
 }
 
 type agentClient interface {
 	VerifyJoined() error
 	VerifySynced() error
 	IsLastNode() (bool, error)
+	Version() (string, error)
 	SetKeys([]string) error
+	BootstrapACLs([]config.ACLPolicy) error
 	Leave() error
+	EnableMaintenance(reason string) error
+	EndDrain() error
+	IsDrained(node string, services []string) (bool, error)
+	ServiceStates(ids []string) ([]agent.ServiceState, error)
 	SetConsulRPCClient(agent.ConsulRPCClient)
 }
 
@@ -37,10 +50,21 @@ type serviceDefiner interface {
 	WriteDefinitions(string, []config.ServiceDefinition) error
 }
 
+type tlsVerifier interface {
+	Verify(files certs.Files, serverName string) error
+	Expiries(caFile string, certFiles []string) ([]certs.Expiry, error)
+}
+
 type clock interface {
 	Sleep(time.Duration)
 }
 
+type metrics interface {
+	IncrCounter(key []string, val float32)
+	SetGauge(key []string, val float32)
+	MeasureSince(key []string, start time.Time)
+}
+
 type logger interface {
 	Info(action string, data ...lager.Data)
 	Error(action string, err error, data ...lager.Data)
@@ -51,29 +75,235 @@ type Controller struct {
 	AgentClient    agentClient
 	SyncRetryDelay time.Duration
 	SyncRetryClock clock
+	DrainTimeout   time.Duration
 	EncryptKeys    []string
 	SSLDisabled    bool
 	Logger         logger
+	Metrics        metrics
 	ConfigDir      string
 	ServiceDefiner serviceDefiner
+	TLSVerifier    tlsVerifier
 	Config         config.Config
 }
 
+func (c Controller) VerifyConsulVersion() error {
+	c.Logger.Info("controller.verify-consul-version.version")
+	output, err := c.AgentRunner.Version()
+	if err != nil {
+		c.Logger.Error("controller.verify-consul-version.version.failed", err)
+		return err
+	}
+
+	version, err := config.ParseConsulVersion(output)
+	if err != nil {
+		c.Logger.Error("controller.verify-consul-version.parse.failed", err)
+		return err
+	}
+
+	c.Logger.Info("controller.verify-consul-version.detected", lager.Data{
+		"version":      version.String(),
+		"protocol_min": version.ProtocolMin,
+		"protocol_max": version.ProtocolMax,
+	})
+
+	if err := version.CheckMinimum(); err != nil {
+		c.Logger.Error("controller.verify-consul-version.unsupported", err, lager.Data{
+			"version": version.String(),
+		})
+		return err
+	}
+
+	if err := version.Validate(config.GenerateConfiguration(c.Config)); err != nil {
+		c.Logger.Error("controller.verify-consul-version.unsupported", err, lager.Data{
+			"version": version.String(),
+		})
+		return err
+	}
+
+	if err := version.ValidateServices(c.ServiceDefiner.GenerateDefinitions(c.Config)); err != nil {
+		c.Logger.Error("controller.verify-consul-version.unsupported", err, lager.Data{
+			"version": version.String(),
+		})
+		return err
+	}
+
+	c.Logger.Info("controller.verify-consul-version.success")
+	return nil
+}
+
+func (c Controller) VerifyTLS() error {
+	if c.SSLDisabled {
+		c.Logger.Info("controller.verify-tls.disabled")
+		return nil
+	}
+
+	consulConfig := config.GenerateConfiguration(c.Config)
+	files := tlsFiles(consulConfig)
+
+	var serverName string
+	if consulConfig.Server && *consulConfig.VerifyServerHostname {
+		serverName = certs.ServerName(consulConfig.Datacenter, consulConfig.Domain)
+	}
+
+	c.Logger.Info("controller.verify-tls.verify", lager.Data{
+		"ca_file":     files.CA,
+		"cert_file":   files.Cert,
+		"key_file":    files.Key,
+		"server_name": serverName,
+	})
+
+	if err := c.TLSVerifier.Verify(files, serverName); err != nil {
+		c.Logger.Error("controller.verify-tls.verify.failed", err)
+		return err
+	}
+
+	if _, err := c.CheckCertExpiry(); err != nil {
+		return err
+	}
+
+	c.Logger.Info("controller.verify-tls.success")
+	return nil
+}
+
+// ReloadTLS verifies the TLS material on disk and asks the running agent to
+// pick it up. It returns false without error when the installed consul cannot
+// reload TLS and has to be restarted instead.
+func (c Controller) ReloadTLS() (bool, error) {
+	c.Logger.Info("controller.reload-tls.verify-tls")
+	if err := c.VerifyTLS(); err != nil {
+		c.Logger.Error("controller.reload-tls.verify-tls.failed", err)
+		return false, err
+	}
+
+	output, err := c.AgentRunner.Version()
+	if err != nil {
+		c.Logger.Error("controller.reload-tls.version.failed", err)
+		return false, err
+	}
+
+	version, err := config.ParseConsulVersion(output)
+	if err != nil {
+		c.Logger.Error("controller.reload-tls.parse.failed", err)
+		return false, err
+	}
+
+	if !version.Supports(config.FeatureTLSReload) {
+		c.Logger.Info("controller.reload-tls.unsupported", lager.Data{
+			"version": version.String(),
+		})
+		return false, nil
+	}
+
+	c.Logger.Info("controller.reload-tls.reload")
+	if err := c.AgentRunner.Reload(); err != nil {
+		c.Logger.Error("controller.reload-tls.reload.failed", err)
+		return false, err
+	}
+	c.Metrics.IncrCounter([]string{"certs", "reloads"}, 1)
+
+	c.Logger.Info("controller.reload-tls.success")
+	return true, nil
+}
+
+// CheckCertExpiry logs certificates that have expired or fall within one of
+// the configured warning thresholds and records the days left on each.
+func (c Controller) CheckCertExpiry() ([]certs.Expiry, error) {
+	if c.SSLDisabled {
+		return nil, nil
+	}
+
+	expiries, err := c.TLSVerifier.Expiries(config.TLSCertFiles(c.Config))
+	if err != nil {
+		c.Logger.Error("controller.check-cert-expiry.failed", err)
+		return nil, err
+	}
+
+	daysRemaining := map[string]int{}
+	for _, expiry := range expiries {
+		data := lager.Data{
+			"file":           expiry.File,
+			"common_name":    expiry.CommonName,
+			"not_after":      expiry.NotAfter.UTC().Format(time.RFC3339),
+			"days_remaining": expiry.DaysRemaining,
+		}
+
+		if expiry.Expired {
+			c.Logger.Error("controller.check-cert-expiry.expired", errors.New("certificate has expired"), data)
+		} else if threshold, ok := expiry.WarningThreshold(c.Config.Confab.CertExpiryWarningDays); ok {
+			data["threshold_days"] = threshold
+			c.Logger.Error("controller.check-cert-expiry.expiring", fmt.Errorf("certificate expires in %d days", expiry.DaysRemaining), data)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(expiry.File), filepath.Ext(expiry.File))
+		if days, ok := daysRemaining[name]; !ok || expiry.DaysRemaining < days {
+			daysRemaining[name] = expiry.DaysRemaining
+		}
+	}
+
+	for name, days := range daysRemaining {
+		c.Metrics.SetGauge([]string{"certs", name, "days_remaining"}, float32(days))
+	}
+
+	return expiries, nil
+}
+
+func tlsFiles(consulConfig config.ConsulConfig) certs.Files {
+	return certs.Files{
+		CA:   *consulConfig.CAFile,
+		Cert: *consulConfig.CertFile,
+		Key:  *consulConfig.KeyFile,
+	}
+}
+
 func (c Controller) BootAgent(timeout confab.Timeout) error {
+	start := time.Now()
+
 	c.Logger.Info("controller.boot-agent.run")
 	err := c.AgentRunner.Run()
 	if err != nil {
 		c.Logger.Error("controller.boot-agent.run.failed", err)
 		return err
 	}
+	c.Metrics.IncrCounter([]string{"agent", "runs"}, 1)
 
 	c.Logger.Info("controller.boot-agent.verify-joined")
 
-	if err := c.callWithTimeout(timeout, c.AgentClient.VerifyJoined); err != nil {
+	var foreignErr error
+	verifyJoined := func() error {
+		c.Metrics.IncrCounter([]string{"agent", "join", "attempts"}, 1)
+		err := c.AgentClient.VerifyJoined()
+		if _, ok := err.(agent.ForeignServersError); ok {
+			foreignErr = err
+			return nil
+		}
+		return err
+	}
+
+	if err := c.callWithTimeout(timeout, verifyJoined); err != nil {
 		c.Logger.Error("controller.boot-agent.verify-joined.failed", err)
 		return err
 	}
 
+	if foreignErr != nil {
+		c.Logger.Error("controller.boot-agent.verify-joined.failed", foreignErr)
+		return foreignErr
+	}
+
+	c.Logger.Info("controller.boot-agent.running-version")
+	if version, err := c.AgentClient.Version(); err != nil {
+		c.Logger.Error("controller.boot-agent.running-version.failed", err)
+	} else {
+		c.Logger.Info("controller.boot-agent.running-version.result", lager.Data{
+			"version": version,
+		})
+	}
+
+	c.Logger.Info("controller.boot-agent.end-drain")
+	if err := c.AgentClient.EndDrain(); err != nil {
+		c.Logger.Error("controller.boot-agent.end-drain.failed", err)
+	}
+
+	c.Metrics.MeasureSince([]string{"agent", "boot"}, start)
 	c.Logger.Info("controller.boot-agent.success")
 	return nil
 }
@@ -95,9 +325,9 @@ func (c Controller) callWithTimeout(timeout confab.Timeout, f func() error) erro
 	}
 }
 
-func (c Controller) ConfigureServer(timeout confab.Timeout, rpcClient *consulagent.RPCClient) error {
+func (c Controller) ConfigureServer(timeout confab.Timeout, rpcClient agent.ConsulRPCClient) error {
 	if rpcClient != nil {
-		c.AgentClient.SetConsulRPCClient(&agent.RPCClient{*rpcClient})
+		c.AgentClient.SetConsulRPCClient(rpcClient)
 	}
 
 	c.Logger.Info("controller.configure-server.is-last-node")
@@ -109,28 +339,48 @@ func (c Controller) ConfigureServer(timeout confab.Timeout, rpcClient *consulage
 
 	if lastNode {
 		c.Logger.Info("controller.configure-server.verify-synced")
-		if err := c.callWithTimeout(timeout, c.AgentClient.VerifySynced); err != nil {
+		verifySynced := func() error {
+			err := c.AgentClient.VerifySynced()
+			if err != nil {
+				c.Metrics.IncrCounter([]string{"agent", "sync", "retries"}, 1)
+			}
+			return err
+		}
+
+		if err := c.callWithTimeout(timeout, verifySynced); err != nil {
 			c.Logger.Error("controller.configure-server.verify-synced.failed", err)
 			return err
 		}
-	}
 
-	if len(c.EncryptKeys) == 0 {
-		err := errors.New("encrypt keys cannot be empty if ssl is enabled")
-		c.Logger.Error("controller.configure-server.no-encrypt-keys", err)
-		return err
+		if c.Config.Consul.Agent.ACL.Bootstrap {
+			c.Logger.Info("controller.configure-server.bootstrap-acls")
+			if err := c.AgentClient.BootstrapACLs(c.Config.Consul.Agent.ACL.Policies()); err != nil {
+				c.Logger.Error("controller.configure-server.bootstrap-acls.failed", err)
+				return err
+			}
+		}
 	}
 
-	c.Logger.Info("controller.configure-server.set-keys", lager.Data{
-		"keys": c.EncryptKeys,
-	})
+	if len(c.EncryptKeys) == 0 {
+		if !c.SSLDisabled {
+			err := errors.New("encrypt keys cannot be empty if ssl is enabled")
+			c.Logger.Error("controller.configure-server.no-encrypt-keys", err)
+			return err
+		}
 
-	err = c.AgentClient.SetKeys(c.EncryptKeys)
-	if err != nil {
-		c.Logger.Error("controller.configure-server.set-keys.failed", err, lager.Data{
-			"keys": c.EncryptKeys,
+		c.Logger.Info("controller.configure-server.skip-set-keys")
+	} else {
+		c.Logger.Info("controller.configure-server.set-keys", lager.Data{
+			"fingerprints": keyring.Fingerprints(c.EncryptKeys),
 		})
-		return err
+
+		err = c.AgentClient.SetKeys(c.EncryptKeys)
+		if err != nil {
+			c.Logger.Error("controller.configure-server.set-keys.failed", err, lager.Data{
+				"fingerprints": keyring.Fingerprints(c.EncryptKeys),
+			})
+			return err
+		}
 	}
 
 	if err := c.AgentRunner.WritePID(); err != nil {
@@ -142,20 +392,70 @@ func (c Controller) ConfigureServer(timeout confab.Timeout, rpcClient *consulage
 	return nil
 }
 
-func (c Controller) ConfigureClient() error {
+func (c Controller) ConfigureClient(timeout confab.Timeout) error {
 	err := c.AgentRunner.WritePID()
 	if err != nil {
 		return err
 	}
 
+	readiness := c.Config.Confab.ServiceReadiness
+	if readiness == "" || readiness == config.ServiceReadinessNone {
+		return nil
+	}
+
+	ids := c.serviceIDs()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	c.Logger.Info("controller.configure-client.verify-services", lager.Data{
+		"services":  ids,
+		"readiness": readiness,
+	})
+
+	var pending []string
+	verifyServices := func() error {
+		states, err := c.AgentClient.ServiceStates(ids)
+		if err != nil {
+			return err
+		}
+
+		pending = nil
+		for _, state := range states {
+			if !state.Ready(readiness == config.ServiceReadinessPassing) {
+				pending = append(pending, state.String())
+			}
+		}
+
+		if len(pending) > 0 {
+			return errors.New("services are not ready")
+		}
+
+		return nil
+	}
+
+	if err := c.callWithTimeout(timeout, verifyServices); err != nil {
+		c.Logger.Error("controller.configure-client.verify-services.failed", err, lager.Data{
+			"pending": pending,
+		})
+
+		if len(pending) > 0 {
+			return fmt.Errorf("services are not %s: %s", readiness, strings.Join(pending, ", "))
+		}
+		return err
+	}
+
+	c.Logger.Info("controller.configure-client.verify-services.success")
 	return nil
 }
 
-func (c Controller) StopAgent(rpcClient *consulagent.RPCClient) {
+func (c Controller) StopAgent(rpcClient agent.ConsulRPCClient) {
 	if rpcClient != nil {
-		c.AgentClient.SetConsulRPCClient(&agent.RPCClient{*rpcClient})
+		c.AgentClient.SetConsulRPCClient(rpcClient)
 	}
 
+	c.drain()
+
 	c.Logger.Info("controller.stop-agent.leave")
 	if err := c.AgentClient.Leave(); err != nil {
 		c.Logger.Error("controller.stop-agent.leave.failed", err)
@@ -179,6 +479,82 @@ func (c Controller) StopAgent(rpcClient *consulagent.RPCClient) {
 	c.Logger.Info("controller.stop-agent.success")
 }
 
+// drain puts the node into maintenance and waits until the catalog no longer
+// returns it for its services, so that DNS stops handing out its addresses
+// before the agent leaves. It never fails the stop; once DrainTimeout has
+// passed the agent leaves regardless.
+func (c Controller) drain() {
+	services := c.serviceNames()
+	if c.DrainTimeout <= 0 || len(services) == 0 {
+		return
+	}
+
+	node, err := config.NodeName(c.Config.Node)
+	if err != nil {
+		c.Logger.Error("controller.stop-agent.drain.node-name.failed", err)
+		return
+	}
+
+	c.Logger.Info("controller.stop-agent.drain", lager.Data{
+		"node":     node,
+		"services": services,
+	})
+	if err := c.AgentClient.EnableMaintenance(agent.DrainReason); err != nil {
+		c.Logger.Error("controller.stop-agent.drain.failed", err)
+		return
+	}
+
+	delay := c.SyncRetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	for waited := time.Duration(0); ; waited += delay {
+		drained, err := c.AgentClient.IsDrained(node, services)
+		if err == nil && drained {
+			c.Logger.Info("controller.stop-agent.drain.success")
+			return
+		}
+
+		if waited >= c.DrainTimeout {
+			c.Logger.Error("controller.stop-agent.drain.timeout", errors.New("node is still being served"), lager.Data{
+				"timeout": c.DrainTimeout.String(),
+			})
+			return
+		}
+
+		c.SyncRetryClock.Sleep(delay)
+	}
+}
+
+func (c Controller) serviceNames() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, definition := range c.ServiceDefiner.GenerateDefinitions(c.Config) {
+		if !seen[definition.Name] {
+			seen[definition.Name] = true
+			names = append(names, definition.Name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// serviceIDs returns the IDs the agent registers the defined services under.
+func (c Controller) serviceIDs() []string {
+	var ids []string
+	for _, definition := range c.ServiceDefiner.GenerateDefinitions(c.Config) {
+		if definition.ID != "" {
+			ids = append(ids, definition.ID)
+		} else {
+			ids = append(ids, definition.Name)
+		}
+	}
+
+	return ids
+}
+
 func (c Controller) WriteServiceDefinitions() error {
 	c.Logger.Info("controller.write-service-definitions.generate-definitions")
 	definitions := c.ServiceDefiner.GenerateDefinitions(c.Config)
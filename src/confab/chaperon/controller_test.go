@@ -6,10 +6,11 @@ import (
 
 	"github.com/cloudfoundry-incubator/consul-release/src/confab"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/chaperon"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
-	consulagent "github.com/hashicorp/consul/command/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/keyring"
 	"github.com/pivotal-golang/lager"
 
 	. "github.com/onsi/ginkgo"
@@ -23,13 +24,16 @@ var _ = Describe("Controller", func() {
 		agentRunner    *fakes.AgentRunner
 		agentClient    *fakes.AgentClient
 		logger         *fakes.Logger
+		metrics        *fakes.Metrics
 		serviceDefiner *fakes.ServiceDefiner
+		tlsVerifier    *fakes.TLSVerifier
 		controller     chaperon.Controller
 	)
 
 	BeforeEach(func() {
 		clock = &fakes.Clock{}
 		logger = &fakes.Logger{}
+		metrics = &fakes.Metrics{}
 
 		agentClient = &fakes.AgentClient{}
 		agentClient.VerifyJoinedCalls.Returns.Errors = []error{nil}
@@ -39,6 +43,7 @@ var _ = Describe("Controller", func() {
 		agentRunner.RunCalls.Returns.Errors = []error{nil}
 
 		serviceDefiner = &fakes.ServiceDefiner{}
+		tlsVerifier = &fakes.TLSVerifier{}
 
 		confabConfig := config.Default()
 		confabConfig.Node = config.ConfigNode{Name: "node", Index: 0}
@@ -50,25 +55,96 @@ var _ = Describe("Controller", func() {
 			SyncRetryClock: clock,
 			EncryptKeys:    []string{"key 1", "key 2", "key 3"},
 			Logger:         logger,
+			Metrics:        metrics,
 			ConfigDir:      "/tmp/config",
 			ServiceDefiner: serviceDefiner,
+			TLSVerifier:    tlsVerifier,
 			Config:         confabConfig,
 		}
 	})
 
 	Describe("ConfigureClient", func() {
 		It("writes the pid file", func() {
-			err := controller.ConfigureClient()
+			err := controller.ConfigureClient(confab.NewTimeout(make(chan time.Time)))
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(agentRunner.WritePIDCall.CallCount).To(Equal(1))
+			Expect(agentClient.ServiceStatesCalls.CallCount).To(Equal(0))
+		})
+
+		Context("when services must be ready", func() {
+			BeforeEach(func() {
+				serviceDefiner.GenerateDefinitionsCall.Returns.Definitions = []config.ServiceDefinition{
+					{Name: "router"},
+					{Name: "router", ID: "router-1"},
+				}
+				controller.Config.Confab.ServiceReadiness = "passing"
+			})
+
+			It("waits until every service is registered and passing", func() {
+				agentClient.ServiceStatesCalls.Returns.States = [][]agent.ServiceState{
+					{{ID: "router"}, {ID: "router-1"}},
+					{{ID: "router", Registered: true, Status: "critical"}, {ID: "router-1", Registered: true, Status: "passing"}},
+					{{ID: "router", Registered: true, Status: "passing"}, {ID: "router-1", Registered: true, Status: "passing"}},
+				}
+
+				Expect(controller.ConfigureClient(confab.NewTimeout(make(chan time.Time)))).To(Succeed())
+				Expect(agentClient.ServiceStatesCalls.CallCount).To(Equal(3))
+				Expect(agentClient.ServiceStatesCalls.Receives.IDs).To(Equal([]string{"router", "router-1"}))
+				Expect(clock.SleepCall.CallCount).To(Equal(2))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.configure-client.verify-services",
+						Data: []lager.Data{{
+							"services":  []string{"router", "router-1"},
+							"readiness": "passing",
+						}},
+					},
+					{
+						Action: "controller.configure-client.verify-services.success",
+					},
+				}))
+			})
+
+			It("only waits for registration when checks need not pass", func() {
+				controller.Config.Confab.ServiceReadiness = "registered"
+				agentClient.ServiceStatesCalls.Returns.States = [][]agent.ServiceState{
+					{{ID: "router", Registered: true, Status: "critical"}, {ID: "router-1", Registered: true, Status: "critical"}},
+				}
+
+				Expect(controller.ConfigureClient(confab.NewTimeout(make(chan time.Time)))).To(Succeed())
+				Expect(agentClient.ServiceStatesCalls.CallCount).To(Equal(1))
+			})
+
+			It("reports the state of the services that are not ready within the timeout", func() {
+				agentClient.ServiceStatesCalls.Returns.States = [][]agent.ServiceState{
+					{{ID: "router"}, {ID: "router-1", Registered: true, Status: "critical"}},
+				}
+
+				err := controller.ConfigureClient(confab.NewTimeout(time.After(20 * time.Millisecond)))
+				Expect(err).To(MatchError("services are not passing: router (not registered), router-1 (critical)"))
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "controller.configure-client.verify-services.failed",
+					Error:  errors.New("timeout exceeded"),
+					Data: []lager.Data{{
+						"pending": []string{"router (not registered)", "router-1 (critical)"},
+					}},
+				}))
+			})
+
+			It("skips the check when no services are defined", func() {
+				serviceDefiner.GenerateDefinitionsCall.Returns.Definitions = nil
+
+				Expect(controller.ConfigureClient(confab.NewTimeout(make(chan time.Time)))).To(Succeed())
+				Expect(agentClient.ServiceStatesCalls.CallCount).To(Equal(0))
+			})
 		})
 
 		Context("failure cases", func() {
 			It("returns an error when the pid file can not be written", func() {
 				agentRunner.WritePIDCall.Returns.Error = errors.New("something bad happened")
 
-				err := controller.ConfigureClient()
+				err := controller.ConfigureClient(confab.NewTimeout(make(chan time.Time)))
 				Expect(err).To(MatchError("something bad happened"))
 			})
 		})
@@ -122,11 +198,415 @@ var _ = Describe("Controller", func() {
 		})
 	})
 
+	Describe("VerifyTLS", func() {
+		It("verifies the agent's tls material", func() {
+			Expect(controller.VerifyTLS()).To(Succeed())
+			Expect(tlsVerifier.VerifyCall.Receives.Files).To(Equal(certs.Files{
+				CA:   "/var/vcap/jobs/consul_agent/config/certs/ca.crt",
+				Cert: "/var/vcap/jobs/consul_agent/config/certs/agent.crt",
+				Key:  "/var/vcap/jobs/consul_agent/config/certs/agent.key",
+			}))
+			Expect(tlsVerifier.VerifyCall.Receives.ServerName).To(Equal(""))
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "controller.verify-tls.verify",
+					Data: []lager.Data{{
+						"ca_file":     "/var/vcap/jobs/consul_agent/config/certs/ca.crt",
+						"cert_file":   "/var/vcap/jobs/consul_agent/config/certs/agent.crt",
+						"key_file":    "/var/vcap/jobs/consul_agent/config/certs/agent.key",
+						"server_name": "",
+					}},
+				},
+				{
+					Action: "controller.verify-tls.success",
+				},
+			}))
+		})
+
+		Context("when the agent is a server", func() {
+			BeforeEach(func() {
+				controller.Config.Consul.Agent.Mode = "server"
+			})
+
+			It("requires the certificate to carry the server name", func() {
+				controller.Config.Consul.Agent.Datacenter = "dc2"
+				controller.Config.Consul.Agent.Domain = "cf.internal."
+
+				Expect(controller.VerifyTLS()).To(Succeed())
+				Expect(tlsVerifier.VerifyCall.Receives.Files.Cert).To(Equal("/var/vcap/jobs/consul_agent/config/certs/server.crt"))
+				Expect(tlsVerifier.VerifyCall.Receives.Files.Key).To(Equal("/var/vcap/jobs/consul_agent/config/certs/server.key"))
+				Expect(tlsVerifier.VerifyCall.Receives.ServerName).To(Equal("server.dc2.cf.internal"))
+			})
+
+			It("uses consul's default datacenter and domain", func() {
+				Expect(controller.VerifyTLS()).To(Succeed())
+				Expect(tlsVerifier.VerifyCall.Receives.ServerName).To(Equal("server.dc1.consul"))
+			})
+
+			It("does not require the server name when verify_server_hostname is off", func() {
+				verifyServerHostname := false
+				controller.Config.Consul.Agent.TLS.VerifyServerHostname = &verifyServerHostname
+
+				Expect(controller.VerifyTLS()).To(Succeed())
+				Expect(tlsVerifier.VerifyCall.Receives.ServerName).To(Equal(""))
+			})
+		})
+
+		It("checks certificate expiry", func() {
+			Expect(controller.VerifyTLS()).To(Succeed())
+			Expect(tlsVerifier.ExpiriesCall.CallCount).To(Equal(1))
+		})
+
+		Context("when ssl is disabled", func() {
+			It("skips the checks", func() {
+				controller.SSLDisabled = true
+
+				Expect(controller.VerifyTLS()).To(Succeed())
+				Expect(tlsVerifier.VerifyCall.CallCount).To(Equal(0))
+				Expect(tlsVerifier.ExpiriesCall.CallCount).To(Equal(0))
+				Expect(logger.Messages).To(Equal([]fakes.LoggerMessage{
+					{
+						Action: "controller.verify-tls.disabled",
+					},
+				}))
+			})
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the tls material is invalid", func() {
+				tlsVerifier.VerifyCall.Returns.Error = errors.New("cert_file does not match key_file")
+
+				Expect(controller.VerifyTLS()).To(MatchError("cert_file does not match key_file"))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.verify-tls.verify.failed",
+						Error:  errors.New("cert_file does not match key_file"),
+					},
+				}))
+			})
+		})
+	})
+
+	Describe("ReloadTLS", func() {
+		BeforeEach(func() {
+			agentRunner.VersionCall.Returns.Output = "Consul v1.4.0\nConsul Protocol: 2 (Understands back to: 2)\n"
+		})
+
+		It("verifies the tls material and reloads the agent", func() {
+			reloaded, err := controller.ReloadTLS()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reloaded).To(BeTrue())
+
+			Expect(tlsVerifier.VerifyCall.CallCount).To(Equal(1))
+			Expect(agentRunner.ReloadCall.CallCount).To(Equal(1))
+			Expect(metrics.Counters["certs.reloads"]).To(Equal(float32(1)))
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "controller.verify-tls.success",
+				},
+				{
+					Action: "controller.reload-tls.reload",
+				},
+				{
+					Action: "controller.reload-tls.success",
+				},
+			}))
+		})
+
+		It("reloads an agent that passes the version check", func() {
+			Expect(controller.VerifyConsulVersion()).To(Succeed())
+
+			reloaded, err := controller.ReloadTLS()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reloaded).To(BeTrue())
+			Expect(agentRunner.ReloadCall.CallCount).To(Equal(1))
+		})
+
+		Context("when the installed consul cannot reload tls", func() {
+			It("reports that the agent has to be restarted", func() {
+				agentRunner.VersionCall.Returns.Output = "Consul v0.6.4\nConsul Protocol: 3 (Understands back to: 1)\n"
+
+				reloaded, err := controller.ReloadTLS()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reloaded).To(BeFalse())
+
+				Expect(agentRunner.ReloadCall.CallCount).To(Equal(0))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.reload-tls.unsupported",
+						Data:   []lager.Data{{"version": "0.6.4"}},
+					},
+				}))
+			})
+		})
+
+		Context("failure cases", func() {
+			It("does not reload invalid tls material", func() {
+				tlsVerifier.VerifyCall.Returns.Error = errors.New("cert_file does not match key_file")
+
+				_, err := controller.ReloadTLS()
+				Expect(err).To(MatchError("cert_file does not match key_file"))
+				Expect(agentRunner.VersionCall.CallCount).To(Equal(0))
+				Expect(agentRunner.ReloadCall.CallCount).To(Equal(0))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.reload-tls.verify-tls.failed",
+						Error:  errors.New("cert_file does not match key_file"),
+					},
+				}))
+			})
+
+			It("returns an error when the version cannot be determined", func() {
+				agentRunner.VersionCall.Returns.Error = errors.New("exec failed")
+
+				_, err := controller.ReloadTLS()
+				Expect(err).To(MatchError("exec failed"))
+				Expect(agentRunner.ReloadCall.CallCount).To(Equal(0))
+			})
+
+			It("returns an error when the agent cannot be signalled", func() {
+				agentRunner.ReloadCall.Returns.Error = errors.New("no such process")
+
+				_, err := controller.ReloadTLS()
+				Expect(err).To(MatchError("no such process"))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.reload-tls.reload.failed",
+						Error:  errors.New("no such process"),
+					},
+				}))
+			})
+		})
+	})
+
+	Describe("CheckCertExpiry", func() {
+		var notAfter time.Time
+
+		BeforeEach(func() {
+			notAfter = time.Date(2016, time.June, 1, 0, 0, 0, 0, time.UTC)
+			controller.Config.Confab.CertExpiryWarningDays = []int{30, 7}
+			tlsVerifier.ExpiriesCall.Returns.Expiries = []certs.Expiry{
+				{File: "/certs/ca.crt", CommonName: "ca-1", NotAfter: notAfter, DaysRemaining: 300},
+				{File: "/certs/ca.crt", CommonName: "ca-2", NotAfter: notAfter, DaysRemaining: 20},
+				{File: "/certs/agent.crt", CommonName: "agent", NotAfter: notAfter, DaysRemaining: 5},
+			}
+		})
+
+		It("returns the expiry of each certificate", func() {
+			expiries, err := controller.CheckCertExpiry()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expiries).To(Equal(tlsVerifier.ExpiriesCall.Returns.Expiries))
+			Expect(tlsVerifier.ExpiriesCall.Receives.CAFile).To(Equal("/var/vcap/jobs/consul_agent/config/certs/ca.crt"))
+			Expect(tlsVerifier.ExpiriesCall.Receives.CertFiles).To(Equal([]string{
+				"/var/vcap/jobs/consul_agent/config/certs/server.crt",
+				"/var/vcap/jobs/consul_agent/config/certs/agent.crt",
+			}))
+		})
+
+		It("checks nothing when ssl is disabled", func() {
+			controller.SSLDisabled = true
+
+			expiries, err := controller.CheckCertExpiry()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expiries).To(BeEmpty())
+			Expect(tlsVerifier.ExpiriesCall.CallCount).To(Equal(0))
+		})
+
+		It("logs certificates within a warning threshold as errors", func() {
+			_, err := controller.CheckCertExpiry()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logger.Messages).To(Equal([]fakes.LoggerMessage{
+				{
+					Action: "controller.check-cert-expiry.expiring",
+					Error:  errors.New("certificate expires in 20 days"),
+					Data: []lager.Data{{
+						"file":           "/certs/ca.crt",
+						"common_name":    "ca-2",
+						"not_after":      "2016-06-01T00:00:00Z",
+						"days_remaining": 20,
+						"threshold_days": 30,
+					}},
+				},
+				{
+					Action: "controller.check-cert-expiry.expiring",
+					Error:  errors.New("certificate expires in 5 days"),
+					Data: []lager.Data{{
+						"file":           "/certs/agent.crt",
+						"common_name":    "agent",
+						"not_after":      "2016-06-01T00:00:00Z",
+						"days_remaining": 5,
+						"threshold_days": 7,
+					}},
+				},
+			}))
+		})
+
+		It("logs expired certificates as errors", func() {
+			tlsVerifier.ExpiriesCall.Returns.Expiries[2].DaysRemaining = -1
+			tlsVerifier.ExpiriesCall.Returns.Expiries[2].Expired = true
+
+			_, err := controller.CheckCertExpiry()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "controller.check-cert-expiry.expired",
+					Error:  errors.New("certificate has expired"),
+					Data: []lager.Data{{
+						"file":           "/certs/agent.crt",
+						"common_name":    "agent",
+						"not_after":      "2016-06-01T00:00:00Z",
+						"days_remaining": -1,
+					}},
+				},
+			}))
+		})
+
+		It("records the fewest days remaining for each file", func() {
+			_, err := controller.CheckCertExpiry()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metrics.Gauges).To(Equal(map[string]float32{
+				"certs.ca.days_remaining":    20,
+				"certs.agent.days_remaining": 5,
+			}))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the certificates cannot be read", func() {
+				tlsVerifier.ExpiriesCall.Returns.Error = errors.New("cannot read ca_file")
+
+				_, err := controller.CheckCertExpiry()
+				Expect(err).To(MatchError("cannot read ca_file"))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.check-cert-expiry.failed",
+						Error:  errors.New("cannot read ca_file"),
+					},
+				}))
+			})
+		})
+	})
+
+	Describe("VerifyConsulVersion", func() {
+		BeforeEach(func() {
+			agentRunner.VersionCall.Returns.Output = "Consul v0.6.4\nConsul Protocol: 3 (Understands back to: 1)\n"
+		})
+
+		It("detects the installed consul version and logs it", func() {
+			Expect(controller.VerifyConsulVersion()).To(Succeed())
+			Expect(agentRunner.VersionCall.CallCount).To(Equal(1))
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "controller.verify-consul-version.version",
+				},
+				{
+					Action: "controller.verify-consul-version.detected",
+					Data: []lager.Data{{
+						"version":      "0.6.4",
+						"protocol_min": 1,
+						"protocol_max": 3,
+					}},
+				},
+				{
+					Action: "controller.verify-consul-version.success",
+				},
+			}))
+		})
+
+		It("accepts staged gossip encryption on a version that supports it", func() {
+			agentRunner.VersionCall.Returns.Output = "Consul v0.8.4\nConsul Protocol: 2 (Understands back to: 2)\n"
+			controller.Config.Consul.EncryptKeys = []string{"some-key"}
+
+			controller.Config.Consul.EncryptStage = config.EncryptStageAccept
+			Expect(controller.VerifyConsulVersion()).To(Succeed())
+
+			controller.Config.Consul.EncryptStage = config.EncryptStageSend
+			Expect(controller.VerifyConsulVersion()).To(Succeed())
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the version command fails", func() {
+				agentRunner.VersionCall.Returns.Error = errors.New("exec error")
+
+				Expect(controller.VerifyConsulVersion()).To(MatchError("exec error"))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.verify-consul-version.version.failed",
+						Error:  errors.New("exec error"),
+					},
+				}))
+			})
+
+			It("refuses service checks the version does not understand", func() {
+				serviceDefiner.GenerateDefinitionsCall.Returns.Definitions = []config.ServiceDefinition{
+					{
+						Name: "router",
+						Checks: []config.ServiceDefinitionCheck{
+							{Name: "router-grpc", GRPC: "127.0.0.1:9000", Interval: "10s"},
+						},
+					},
+				}
+
+				err := controller.VerifyConsulVersion()
+				Expect(err).To(MatchError(`consul 0.6.4 is not supported: check "router-grpc" of service "router" uses "grpc", which is only available in consul >= 1.0.5`))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.verify-consul-version.unsupported",
+						Error:  err,
+						Data: []lager.Data{{
+							"version": "0.6.4",
+						}},
+					},
+				}))
+			})
+
+			It("refuses configuration the version does not understand", func() {
+				controller.Config.Consul.Agent.Performance.RaftMultiplier = 5
+
+				err := controller.VerifyConsulVersion()
+				Expect(err).To(MatchError(`consul 0.6.4 is not supported: configuration "performance" is only available in consul >= 0.7.0`))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.verify-consul-version.unsupported",
+						Error:  err,
+						Data: []lager.Data{{
+							"version": "0.6.4",
+						}},
+					},
+				}))
+			})
+
+			It("returns an error when the version output cannot be parsed", func() {
+				agentRunner.VersionCall.Returns.Output = "banana"
+
+				Expect(controller.VerifyConsulVersion()).To(MatchError(`could not parse consul version: "banana"`))
+			})
+
+			It("refuses to start an unsupported version", func() {
+				agentRunner.VersionCall.Returns.Output = "Consul v0.5.0\nConsul Protocol: 2 (Understands back to: 1)\n"
+
+				err := controller.VerifyConsulVersion()
+				Expect(err).To(MatchError("consul 0.5.0 is not supported: confab requires consul >= 0.6.4"))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.verify-consul-version.unsupported",
+						Error:  err,
+						Data: []lager.Data{{
+							"version": "0.5.0",
+						}},
+					},
+				}))
+			})
+		})
+	})
+
 	Describe("BootAgent", func() {
 		It("launches the consul agent and confirms that it joined the cluster", func() {
+			agentClient.VersionCall.Returns.Version = "0.6.4"
+
 			Expect(controller.BootAgent(confab.NewTimeout(make(chan time.Time)))).To(Succeed())
 			Expect(agentRunner.RunCalls.CallCount).To(Equal(1))
 			Expect(agentClient.VerifyJoinedCalls.CallCount).To(Equal(1))
+			Expect(agentClient.VersionCall.CallCount).To(Equal(1))
 			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
 				{
 					Action: "controller.boot-agent.run",
@@ -134,12 +614,79 @@ var _ = Describe("Controller", func() {
 				{
 					Action: "controller.boot-agent.verify-joined",
 				},
+				{
+					Action: "controller.boot-agent.running-version",
+				},
+				{
+					Action: "controller.boot-agent.running-version.result",
+					Data: []lager.Data{{
+						"version": "0.6.4",
+					}},
+				},
+				{
+					Action: "controller.boot-agent.end-drain",
+				},
 				{
 					Action: "controller.boot-agent.success",
 				},
 			}))
 		})
 
+		It("records the agent run and boot duration", func() {
+			Expect(controller.BootAgent(confab.NewTimeout(make(chan time.Time)))).To(Succeed())
+			Expect(metrics.Counters["agent.runs"]).To(Equal(float32(1)))
+			Expect(metrics.Counters["agent.join.attempts"]).To(Equal(float32(1)))
+			Expect(metrics.Measurements["agent.boot"]).To(Equal(1))
+		})
+
+		It("lifts the maintenance left behind by a drain", func() {
+			Expect(controller.BootAgent(confab.NewTimeout(make(chan time.Time)))).To(Succeed())
+			Expect(agentClient.EndDrainCall.CallCount).To(Equal(1))
+		})
+
+		Context("when the drain cannot be ended", func() {
+			It("logs the error and succeeds", func() {
+				agentClient.EndDrainCall.Returns.Error = errors.New("checks error")
+
+				Expect(controller.BootAgent(confab.NewTimeout(make(chan time.Time)))).To(Succeed())
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.boot-agent.end-drain",
+					},
+					{
+						Action: "controller.boot-agent.end-drain.failed",
+						Error:  errors.New("checks error"),
+					},
+					{
+						Action: "controller.boot-agent.success",
+					},
+				}))
+			})
+		})
+
+		Context("when the running version cannot be determined", func() {
+			It("logs the error and succeeds", func() {
+				agentClient.VersionCall.Returns.Error = errors.New("self error")
+
+				Expect(controller.BootAgent(confab.NewTimeout(make(chan time.Time)))).To(Succeed())
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.boot-agent.running-version",
+					},
+					{
+						Action: "controller.boot-agent.running-version.failed",
+						Error:  errors.New("self error"),
+					},
+					{
+						Action: "controller.boot-agent.end-drain",
+					},
+					{
+						Action: "controller.boot-agent.success",
+					},
+				}))
+			})
+		})
+
 		Context("when starting the agent fails", func() {
 			It("immediately returns an error", func() {
 				agentRunner.RunCalls.Returns.Errors = []error{errors.New("some error")}
@@ -170,6 +717,7 @@ var _ = Describe("Controller", func() {
 				Expect(agentClient.VerifyJoinedCalls.CallCount).To(Equal(10))
 				Expect(clock.SleepCall.CallCount).To(Equal(9))
 				Expect(clock.SleepCall.Receives.Duration).To(Equal(10 * time.Millisecond))
+				Expect(metrics.Counters["agent.join.attempts"]).To(Equal(float32(10)))
 				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
 					{
 						Action: "controller.boot-agent.run",
@@ -177,6 +725,18 @@ var _ = Describe("Controller", func() {
 					{
 						Action: "controller.boot-agent.verify-joined",
 					},
+					{
+						Action: "controller.boot-agent.running-version",
+					},
+					{
+						Action: "controller.boot-agent.running-version.result",
+						Data: []lager.Data{{
+							"version": "",
+						}},
+					},
+					{
+						Action: "controller.boot-agent.end-drain",
+					},
 					{
 						Action: "controller.boot-agent.success",
 					},
@@ -184,6 +744,24 @@ var _ = Describe("Controller", func() {
 			})
 		})
 
+		Context("when the agent joined a foreign cluster", func() {
+			It("returns the error without retrying", func() {
+				foreignErr := agent.ForeignServersError{Servers: []string{`10.1.0.9 (datacenter "dc2")`}}
+				agentClient.VerifyJoinedCalls.Returns.Errors = []error{errors.New("some error"), foreignErr}
+
+				err := controller.BootAgent(confab.NewTimeout(make(chan time.Time)))
+				Expect(err).To(MatchError(`joined a foreign cluster, unexpected servers: 10.1.0.9 (datacenter "dc2")`))
+				Expect(agentClient.VerifyJoinedCalls.CallCount).To(Equal(2))
+				Expect(logger.Messages).To(ContainElement(fakes.LoggerMessage{
+					Action: "controller.boot-agent.verify-joined.failed",
+					Error:  foreignErr,
+				}))
+				Expect(logger.Messages).NotTo(ContainElement(fakes.LoggerMessage{
+					Action: "controller.boot-agent.success",
+				}))
+			})
+		})
+
 		Context("joining never succeeds within timeout period", func() {
 			It("immediately returns an error", func() {
 				agentClient.VerifyJoinedCalls.Returns.Errors = make([]error, 10)
@@ -218,17 +796,17 @@ var _ = Describe("Controller", func() {
 	})
 
 	Describe("StopAgent", func() {
-		var rpcClient *consulagent.RPCClient
+		var rpcClient *fakes.FakeconsulRPCClient
 
 		BeforeEach(func() {
-			rpcClient = &consulagent.RPCClient{}
+			rpcClient = &fakes.FakeconsulRPCClient{}
 		})
 
 		It("tells client to leave the cluster and waits for the agent to stop", func() {
 			controller.StopAgent(rpcClient)
 			Expect(agentClient.LeaveCall.CallCount).To(Equal(1))
 			Expect(agentClient.SetConsulRPCClientCall.CallCount).To(Equal(1))
-			Expect(agentClient.SetConsulRPCClientCall.Receives.ConsulRPCClient).To(Equal(&agent.RPCClient{*rpcClient}))
+			Expect(agentClient.SetConsulRPCClientCall.Receives.ConsulRPCClient).To(Equal(rpcClient))
 			Expect(agentRunner.WaitCall.CallCount).To(Equal(1))
 			Expect(agentRunner.CleanupCall.CallCount).To(Equal(1))
 			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
@@ -247,6 +825,96 @@ var _ = Describe("Controller", func() {
 			}))
 		})
 
+		It("does not drain when draining is disabled", func() {
+			serviceDefiner.GenerateDefinitionsCall.Returns.Definitions = []config.ServiceDefinition{{Name: "router"}}
+
+			controller.StopAgent(rpcClient)
+			Expect(agentClient.EnableMaintenanceCall.CallCount).To(Equal(0))
+			Expect(agentClient.LeaveCall.CallCount).To(Equal(1))
+		})
+
+		Context("when draining is enabled", func() {
+			BeforeEach(func() {
+				controller.DrainTimeout = 30 * time.Millisecond
+				serviceDefiner.GenerateDefinitionsCall.Returns.Definitions = []config.ServiceDefinition{
+					{Name: "router", ID: "router-0"},
+					{Name: "router", ID: "router-1"},
+					{Name: "gorouter"},
+				}
+			})
+
+			It("puts the node into maintenance and waits until it is drained before leaving", func() {
+				agentClient.IsDrainedCalls.Returns.Drained = []bool{false, false, true}
+
+				controller.StopAgent(rpcClient)
+				Expect(agentClient.EnableMaintenanceCall.CallCount).To(Equal(1))
+				Expect(agentClient.EnableMaintenanceCall.Receives.Reason).To(Equal(agent.DrainReason))
+				Expect(agentClient.IsDrainedCalls.CallCount).To(Equal(3))
+				Expect(agentClient.IsDrainedCalls.Receives.Node).To(Equal("node-0"))
+				Expect(agentClient.IsDrainedCalls.Receives.Services).To(Equal([]string{"gorouter", "router"}))
+				Expect(clock.SleepCall.CallCount).To(Equal(2))
+				Expect(agentClient.LeaveCall.CallCount).To(Equal(1))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.stop-agent.drain",
+						Data: []lager.Data{{
+							"node":     "node-0",
+							"services": []string{"gorouter", "router"},
+						}},
+					},
+					{
+						Action: "controller.stop-agent.drain.success",
+					},
+					{
+						Action: "controller.stop-agent.leave",
+					},
+				}))
+			})
+
+			It("leaves once the drain timeout has passed", func() {
+				controller.StopAgent(rpcClient)
+				Expect(agentClient.IsDrainedCalls.CallCount).To(Equal(4))
+				Expect(agentClient.LeaveCall.CallCount).To(Equal(1))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.stop-agent.drain.timeout",
+						Error:  errors.New("node is still being served"),
+						Data: []lager.Data{{
+							"timeout": "30ms",
+						}},
+					},
+					{
+						Action: "controller.stop-agent.leave",
+					},
+				}))
+			})
+
+			It("leaves without waiting when maintenance cannot be enabled", func() {
+				agentClient.EnableMaintenanceCall.Returns.Error = errors.New("maintenance error")
+
+				controller.StopAgent(rpcClient)
+				Expect(agentClient.IsDrainedCalls.CallCount).To(Equal(0))
+				Expect(agentClient.LeaveCall.CallCount).To(Equal(1))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "controller.stop-agent.drain.failed",
+						Error:  errors.New("maintenance error"),
+					},
+					{
+						Action: "controller.stop-agent.leave",
+					},
+				}))
+			})
+
+			It("does not drain a node without services", func() {
+				serviceDefiner.GenerateDefinitionsCall.Returns.Definitions = nil
+
+				controller.StopAgent(rpcClient)
+				Expect(agentClient.EnableMaintenanceCall.CallCount).To(Equal(0))
+				Expect(agentClient.LeaveCall.CallCount).To(Equal(1))
+			})
+		})
+
 		Context("when the agent client Leave() returns an error", func() {
 			BeforeEach(func() {
 				agentClient.LeaveCall.Returns.Error = errors.New("leave error")
@@ -376,12 +1044,12 @@ var _ = Describe("Controller", func() {
 	Describe("ConfigureServer", func() {
 		var (
 			timeout   confab.Timeout
-			rpcClient *consulagent.RPCClient
+			rpcClient *fakes.FakeconsulRPCClient
 		)
 
 		BeforeEach(func() {
 			timeout = confab.NewTimeout(make(chan time.Time))
-			rpcClient = &consulagent.RPCClient{}
+			rpcClient = &fakes.FakeconsulRPCClient{}
 		})
 
 		Context("when it is not the last node in the cluster", func() {
@@ -390,7 +1058,7 @@ var _ = Describe("Controller", func() {
 
 				Expect(agentClient.VerifySyncedCalls.CallCount).To(Equal(0))
 				Expect(agentClient.SetConsulRPCClientCall.CallCount).To(Equal(1))
-				Expect(agentClient.SetConsulRPCClientCall.Receives.ConsulRPCClient).To(Equal(&agent.RPCClient{*rpcClient}))
+				Expect(agentClient.SetConsulRPCClientCall.Receives.ConsulRPCClient).To(Equal(rpcClient))
 				Expect(agentRunner.WritePIDCall.CallCount).To(Equal(1))
 				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
 					{
@@ -399,7 +1067,7 @@ var _ = Describe("Controller", func() {
 					{
 						Action: "controller.configure-server.set-keys",
 						Data: []lager.Data{{
-							"keys": []string{"key 1", "key 2", "key 3"},
+							"fingerprints": keyring.Fingerprints([]string{"key 1", "key 2", "key 3"}),
 						}},
 					},
 					{
@@ -409,6 +1077,15 @@ var _ = Describe("Controller", func() {
 			})
 		})
 
+		Context("when acl bootstrapping is enabled on a node that is not the last", func() {
+			It("does not bootstrap the acls", func() {
+				controller.Config.Consul.Agent.ACL.Bootstrap = true
+
+				Expect(controller.ConfigureServer(timeout, rpcClient)).To(Succeed())
+				Expect(agentClient.BootstrapACLsCall.CallCount).To(Equal(0))
+			})
+		})
+
 		Context("setting keys", func() {
 			It("sets the encryption keys used by the agent", func() {
 				Expect(controller.ConfigureServer(timeout, rpcClient)).To(Succeed())
@@ -424,7 +1101,7 @@ var _ = Describe("Controller", func() {
 					{
 						Action: "controller.configure-server.set-keys",
 						Data: []lager.Data{{
-							"keys": []string{"key 1", "key 2", "key 3"},
+							"fingerprints": keyring.Fingerprints([]string{"key 1", "key 2", "key 3"}),
 						}},
 					},
 					{
@@ -451,20 +1128,39 @@ var _ = Describe("Controller", func() {
 						{
 							Action: "controller.configure-server.set-keys",
 							Data: []lager.Data{{
-								"keys": []string{"key 1", "key 2", "key 3"},
+								"fingerprints": keyring.Fingerprints([]string{"key 1", "key 2", "key 3"}),
 							}},
 						},
 						{
 							Action: "controller.configure-server.set-keys.failed",
 							Error:  errors.New("oh noes"),
 							Data: []lager.Data{{
-								"keys": []string{"key 1", "key 2", "key 3"},
+								"fingerprints": keyring.Fingerprints([]string{"key 1", "key 2", "key 3"}),
 							}},
 						},
 					}))
 				})
 			})
 
+			Context("when ssl is disabled and no keys are provided", func() {
+				BeforeEach(func() {
+					controller.SSLDisabled = true
+					controller.EncryptKeys = []string{}
+				})
+
+				It("does not set any keys", func() {
+					Expect(controller.ConfigureServer(timeout, rpcClient)).To(Succeed())
+					Expect(agentClient.SetKeysCall.Receives.Keys).To(BeNil())
+					Expect(agentRunner.WritePIDCall.CallCount).To(Equal(1))
+
+					Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+						{
+							Action: "controller.configure-server.skip-set-keys",
+						},
+					}))
+				})
+			})
+
 			Context("when ssl is enabled but no keys are provided", func() {
 				BeforeEach(func() {
 					controller.EncryptKeys = []string{}
@@ -508,7 +1204,7 @@ var _ = Describe("Controller", func() {
 					{
 						Action: "controller.configure-server.set-keys",
 						Data: []lager.Data{{
-							"keys": []string{"key 1", "key 2", "key 3"},
+							"fingerprints": keyring.Fingerprints([]string{"key 1", "key 2", "key 3"}),
 						}},
 					},
 					{
@@ -517,6 +1213,55 @@ var _ = Describe("Controller", func() {
 				}))
 			})
 
+			Context("when acl bootstrapping is enabled", func() {
+				BeforeEach(func() {
+					controller.Config.Consul.Agent.ACL = config.ConfigConsulAgentACL{
+						Bootstrap:   true,
+						MasterToken: "some-master-token",
+						AgentToken:  "some-agent-token",
+						AgentPolicy: "some-agent-rules",
+					}
+				})
+
+				It("creates the configured acl policies", func() {
+					Expect(controller.ConfigureServer(timeout, rpcClient)).To(Succeed())
+					Expect(agentClient.BootstrapACLsCall.CallCount).To(Equal(1))
+					Expect(agentClient.BootstrapACLsCall.Receives.Policies).To(Equal([]config.ACLPolicy{
+						{Name: "agent", Token: "some-agent-token", Rules: "some-agent-rules"},
+					}))
+
+					Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+						{
+							Action: "controller.configure-server.verify-synced",
+						},
+						{
+							Action: "controller.configure-server.bootstrap-acls",
+						},
+						{
+							Action: "controller.configure-server.set-keys",
+							Data: []lager.Data{{
+								"fingerprints": keyring.Fingerprints([]string{"key 1", "key 2", "key 3"}),
+							}},
+						},
+					}))
+				})
+
+				Context("when bootstrapping fails", func() {
+					It("returns an error", func() {
+						agentClient.BootstrapACLsCall.Returns.Error = errors.New("acl update failed")
+
+						Expect(controller.ConfigureServer(timeout, rpcClient)).To(MatchError("acl update failed"))
+						Expect(agentRunner.WritePIDCall.CallCount).To(Equal(0))
+						Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+							{
+								Action: "controller.configure-server.bootstrap-acls.failed",
+								Error:  errors.New("acl update failed"),
+							},
+						}))
+					})
+				})
+			})
+
 			Context("verifying sync fails at first but later succeeds", func() {
 				It("retries until it verifies sync successfully", func() {
 					agentClient.VerifySyncedCalls.Returns.Errors = make([]error, 10)
@@ -526,6 +1271,7 @@ var _ = Describe("Controller", func() {
 
 					Expect(controller.ConfigureServer(timeout, rpcClient)).To(Succeed())
 					Expect(agentClient.VerifySyncedCalls.CallCount).To(Equal(10))
+					Expect(metrics.Counters["agent.sync.retries"]).To(Equal(float32(9)))
 					Expect(clock.SleepCall.CallCount).To(Equal(9))
 					Expect(clock.SleepCall.Receives.Duration).To(Equal(10 * time.Millisecond))
 					Expect(agentRunner.WritePIDCall.CallCount).To(Equal(1))
@@ -540,7 +1286,7 @@ var _ = Describe("Controller", func() {
 						{
 							Action: "controller.configure-server.set-keys",
 							Data: []lager.Data{{
-								"keys": []string{"key 1", "key 2", "key 3"},
+								"fingerprints": keyring.Fingerprints([]string{"key 1", "key 2", "key 3"}),
 							}},
 						},
 						{
@@ -620,7 +1366,7 @@ var _ = Describe("Controller", func() {
 						Error:  nil,
 						Data: []lager.Data{
 							{
-								"keys": []string{"key 1", "key 2", "key 3"},
+								"fingerprints": keyring.Fingerprints([]string{"key 1", "key 2", "key 3"}),
 							},
 						},
 					},
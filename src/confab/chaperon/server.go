@@ -2,23 +2,25 @@ package chaperon
 
 import (
 	"github.com/cloudfoundry-incubator/consul-release/src/confab"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
-	"github.com/hashicorp/consul/command/agent"
 )
 
 type controller interface {
+	VerifyConsulVersion() error
+	VerifyTLS() error
 	WriteServiceDefinitions() error
 	BootAgent(confab.Timeout) error
-	ConfigureServer(confab.Timeout, *agent.RPCClient) error
-	ConfigureClient() error
-	StopAgent(*agent.RPCClient)
+	ConfigureServer(confab.Timeout, agent.ConsulRPCClient) error
+	ConfigureClient(confab.Timeout) error
+	StopAgent(agent.ConsulRPCClient)
 }
 
 type configWriter interface {
 	Write(config.Config) error
 }
 
-type consulRPCClientConstructor func(url string) (*agent.RPCClient, error)
+type consulRPCClientConstructor func(url string) (agent.ConsulRPCClient, error)
 
 type Server struct {
 	controller   controller
@@ -35,6 +37,14 @@ func NewServer(controller controller, configWriter configWriter, newRPCClient co
 }
 
 func (s Server) Start(cfg config.Config, timeout confab.Timeout) error {
+	if err := s.controller.VerifyConsulVersion(); err != nil {
+		return err
+	}
+
+	if err := s.controller.VerifyTLS(); err != nil {
+		return err
+	}
+
 	if err := s.configWriter.Write(cfg); err != nil {
 		return err
 	}
@@ -7,7 +7,6 @@ import (
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/chaperon"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
-	consulagent "github.com/hashicorp/consul/command/agent"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -23,7 +22,7 @@ var _ = Describe("Server", func() {
 		configWriter *fakes.ConfigWriter
 
 		agentClient *agent.Client
-		rpcClient   *consulagent.RPCClient
+		rpcClient   *fakes.FakeconsulRPCClient
 		rpcEndpoint string
 	)
 
@@ -37,8 +36,8 @@ var _ = Describe("Server", func() {
 		controller = &fakes.Controller{}
 		configWriter = &fakes.ConfigWriter{}
 
-		rpcClient = &consulagent.RPCClient{}
-		rpcClientConstructor := func(endpoint string) (*consulagent.RPCClient, error) {
+		rpcClient = &fakes.FakeconsulRPCClient{}
+		rpcClientConstructor := func(endpoint string) (agent.ConsulRPCClient, error) {
 			rpcEndpoint = endpoint
 			return rpcClient, nil
 		}
@@ -50,6 +49,18 @@ var _ = Describe("Server", func() {
 	})
 
 	Describe("Start", func() {
+		It("verifies the installed consul version", func() {
+			err := server.Start(cfg, timeout)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(controller.VerifyConsulVersionCall.CallCount).To(Equal(1))
+		})
+
+		It("verifies the tls material", func() {
+			err := server.Start(cfg, timeout)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(controller.VerifyTLSCall.CallCount).To(Equal(1))
+		})
+
 		It("writes the consul configuration file", func() {
 			err := server.Start(cfg, timeout)
 			Expect(err).NotTo(HaveOccurred())
@@ -85,6 +96,27 @@ var _ = Describe("Server", func() {
 		})
 
 		Context("failure cases", func() {
+			Context("when the consul version is not supported", func() {
+				It("returns an error", func() {
+					controller.VerifyConsulVersionCall.Returns.Error = errors.New("unsupported version")
+
+					err := server.Start(cfg, timeout)
+					Expect(err).To(MatchError(errors.New("unsupported version")))
+					Expect(controller.BootAgentCall.CallCount).To(Equal(0))
+				})
+			})
+
+			Context("when the tls material is invalid", func() {
+				It("returns an error", func() {
+					controller.VerifyTLSCall.Returns.Error = errors.New("invalid certificate")
+
+					err := server.Start(cfg, timeout)
+					Expect(err).To(MatchError(errors.New("invalid certificate")))
+					Expect(configWriter.WriteCall.CallCount).To(Equal(0))
+					Expect(controller.BootAgentCall.CallCount).To(Equal(0))
+				})
+			})
+
 			Context("when writing the consul config file fails", func() {
 				It("returns an error", func() {
 					configWriter.WriteCall.Returns.Error = errors.New("failed to write config")
@@ -114,7 +146,7 @@ var _ = Describe("Server", func() {
 
 			Context("when constructing an RPC client fails", func() {
 				It("returns an error", func() {
-					server = chaperon.NewServer(controller, configWriter, func(string) (*consulagent.RPCClient, error) {
+					server = chaperon.NewServer(controller, configWriter, func(string) (agent.ConsulRPCClient, error) {
 						return nil, errors.New("failed to create rpc client")
 					})
 
@@ -146,7 +178,7 @@ var _ = Describe("Server", func() {
 		Context("failure cases", func() {
 			Context("when constructing an RPC client fails", func() {
 				It("returns an error", func() {
-					server = chaperon.NewServer(controller, configWriter, func(string) (*consulagent.RPCClient, error) {
+					server = chaperon.NewServer(controller, configWriter, func(string) (agent.ConsulRPCClient, error) {
 						return nil, errors.New("failed to create rpc client")
 					})
 
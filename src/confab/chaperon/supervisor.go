@@ -0,0 +1,288 @@
+package chaperon
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/status"
+	"github.com/pivotal-golang/lager"
+)
+
+type runner interface {
+	Start(config.Config, confab.Timeout) error
+	Stop() error
+}
+
+type statusCollector interface {
+	Status() (agent.Status, error)
+	SetConsulRPCClient(agent.ConsulRPCClient)
+}
+
+type certChecker interface {
+	CheckCertExpiry() ([]certs.Expiry, error)
+}
+
+type certWatcher interface {
+	Changed() bool
+}
+
+type tlsReloader interface {
+	ReloadTLS() (bool, error)
+}
+
+type counter interface {
+	IncrCounter(key []string, val float32)
+}
+
+// Supervisor keeps the agent running for as long as confab runs, restarting
+// it when the process exits and recording the state of the node.
+type Supervisor struct {
+	Runner       runner
+	AgentClient  statusCollector
+	NewRPCClient consulRPCClientConstructor
+	IsRunning    func() bool
+	NewTimeout   func() confab.Timeout
+	Tracker      *status.Tracker
+	Metrics      counter
+	Config       config.Config
+	Interval     time.Duration
+	Logger       logger
+
+	CertChecker       certChecker
+	CertCheckInterval time.Duration
+
+	// CertWatcher and TLSReloader pick up rotated TLS material. When the
+	// agent cannot reload it, servers restart no sooner than their node
+	// index times RestartStagger after the change, and only while every
+	// expected server is alive, so that the cluster keeps its quorum.
+	CertWatcher    certWatcher
+	TLSReloader    tlsReloader
+	RestartStagger time.Duration
+
+	rpcClient         agent.ConsulRPCClient
+	certRestart       bool
+	certRestartAfter  time.Time
+	certRestartLogged bool
+}
+
+func (s *Supervisor) Run(signals <-chan os.Signal) error {
+	s.Logger.Info("supervisor.run.start")
+	if err := s.start(); err != nil {
+		s.Logger.Error("supervisor.run.start.failed", err)
+		return err
+	}
+	s.collect()
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	var certTicks <-chan time.Time
+	if s.CertChecker != nil {
+		s.checkCerts()
+
+		certTicker := time.NewTicker(s.CertCheckInterval)
+		defer certTicker.Stop()
+		certTicks = certTicker.C
+	}
+
+	for {
+		select {
+		case sig := <-signals:
+			s.Logger.Info("supervisor.run.signal", lager.Data{
+				"signal": sig.String(),
+			})
+
+			s.Tracker.Update(func(st *status.Status) {
+				st.AgentUp = false
+			})
+
+			if err := s.Runner.Stop(); err != nil {
+				s.Logger.Error("supervisor.run.stop.failed", err)
+				return err
+			}
+
+			s.Logger.Info("supervisor.run.success")
+			return nil
+		case <-ticker.C:
+			s.check()
+		case <-certTicks:
+			s.checkCerts()
+		}
+	}
+}
+
+func (s *Supervisor) check() {
+	if !s.IsRunning() {
+		s.Logger.Error("supervisor.check.agent-not-running", errors.New("agent process is not running"))
+
+		s.Tracker.Update(func(st *status.Status) {
+			st.AgentUp = false
+			st.AgentRestarts++
+		})
+		s.Metrics.IncrCounter([]string{"agent", "restarts"}, 1)
+		s.rpcClient = nil
+
+		s.Logger.Info("supervisor.check.restart")
+		if err := s.start(); err != nil {
+			s.Logger.Error("supervisor.check.restart.failed", err)
+			s.Runner.Stop()
+			return
+		}
+	}
+
+	s.collect()
+
+	if s.CertWatcher != nil {
+		if s.CertWatcher.Changed() {
+			s.rotateCerts()
+		} else if s.certRestart {
+			s.restartForCerts()
+		}
+	}
+}
+
+func (s *Supervisor) start() error {
+	if err := s.Runner.Start(s.Config, s.NewTimeout()); err != nil {
+		return err
+	}
+
+	s.Tracker.Update(func(st *status.Status) {
+		st.AgentUp = true
+		st.LastStart = time.Now()
+	})
+
+	return nil
+}
+
+func (s *Supervisor) collect() {
+	if s.rpcClient == nil {
+		rpcClient, err := s.NewRPCClient("localhost:8400")
+		if err != nil {
+			s.Logger.Error("supervisor.collect.rpc-client.failed", err)
+		} else {
+			s.rpcClient = rpcClient
+		}
+	}
+
+	s.AgentClient.SetConsulRPCClient(s.rpcClient)
+
+	agentStatus, err := s.AgentClient.Status()
+	if err != nil {
+		s.Logger.Error("supervisor.collect.status.failed", err)
+		s.rpcClient = nil
+		s.Tracker.Update(func(st *status.Status) {
+			st.CollectError = err.Error()
+		})
+		return
+	}
+
+	s.Tracker.Update(func(st *status.Status) {
+		st.CollectError = ""
+		st.LANMembers = agentStatus.LANMembers
+		st.LANServers = agentStatus.LANServers
+		st.ExpectedServers = agentStatus.ExpectedServers
+		st.Raft = agentStatus.Raft
+		st.CommitIndex = agentStatus.CommitIndex
+		st.LastLogIndex = agentStatus.LastLogIndex
+		st.KeyringKeys = agentStatus.KeyringKeys
+		st.EncryptStage = agentStatus.EncryptStage
+	})
+}
+
+func (s *Supervisor) checkCerts() {
+	expiries, err := s.CertChecker.CheckCertExpiry()
+	if err != nil {
+		s.Logger.Error("supervisor.check-certs.failed", err)
+		return
+	}
+
+	var certificates []status.Certificate
+	for _, expiry := range expiries {
+		certificates = append(certificates, status.Certificate{
+			File:          expiry.File,
+			CommonName:    expiry.CommonName,
+			DaysRemaining: expiry.DaysRemaining,
+			Expired:       expiry.Expired,
+		})
+	}
+
+	s.Tracker.Update(func(st *status.Status) {
+		st.Certificates = certificates
+	})
+}
+
+func (s *Supervisor) rotateCerts() {
+	s.Logger.Info("supervisor.rotate-certs.changed")
+	s.certRestart = false
+
+	reloaded, err := s.TLSReloader.ReloadTLS()
+	if err != nil {
+		s.Logger.Error("supervisor.rotate-certs.reload.failed", err)
+		return
+	}
+
+	if !reloaded {
+		s.certRestart = true
+		s.certRestartAfter = time.Now()
+		s.certRestartLogged = false
+		if s.Config.Consul.Agent.Mode == "server" {
+			s.certRestartAfter = s.certRestartAfter.Add(time.Duration(s.Config.Node.Index) * s.RestartStagger)
+		}
+
+		s.restartForCerts()
+		return
+	}
+
+	if s.CertChecker != nil {
+		s.checkCerts()
+	}
+
+	s.Logger.Info("supervisor.rotate-certs.success")
+}
+
+func (s *Supervisor) restartForCerts() {
+	if s.Config.Consul.Agent.Mode == "server" {
+		st := s.Tracker.Status()
+		if time.Now().Before(s.certRestartAfter) || st.CollectError != "" || st.LANServers < st.ExpectedServers {
+			if !s.certRestartLogged {
+				s.Logger.Info("supervisor.rotate-certs.restart.postponed", lager.Data{
+					"not_before":       s.certRestartAfter.UTC().Format(time.RFC3339),
+					"lan_servers":      st.LANServers,
+					"expected_servers": st.ExpectedServers,
+				})
+				s.certRestartLogged = true
+			}
+			return
+		}
+	}
+
+	s.certRestart = false
+
+	s.Logger.Info("supervisor.rotate-certs.restart")
+	s.Tracker.Update(func(st *status.Status) {
+		st.AgentUp = false
+	})
+	s.rpcClient = nil
+
+	if err := s.Runner.Stop(); err != nil {
+		s.Logger.Error("supervisor.rotate-certs.restart.stop.failed", err)
+	}
+
+	if err := s.start(); err != nil {
+		s.Logger.Error("supervisor.rotate-certs.restart.failed", err)
+		s.Runner.Stop()
+		return
+	}
+	s.Metrics.IncrCounter([]string{"certs", "restarts"}, 1)
+
+	if s.CertChecker != nil {
+		s.checkCerts()
+	}
+
+	s.Logger.Info("supervisor.rotate-certs.success")
+}
@@ -0,0 +1,382 @@
+package chaperon_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/chaperon"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/status"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/pivotal-cf-experimental/gomegamatchers"
+)
+
+var _ = Describe("Supervisor", func() {
+	var (
+		runner      *fakes.Runner
+		agentClient *fakes.AgentClient
+		tracker     *status.Tracker
+		metrics     *fakes.Metrics
+		logger      *fakes.Logger
+		supervisor  *chaperon.Supervisor
+		rpcClient   *fakes.FakeconsulRPCClient
+		signals     chan os.Signal
+
+		runningLock sync.Mutex
+		running     bool
+	)
+
+	setRunning := func(r bool) {
+		runningLock.Lock()
+		defer runningLock.Unlock()
+		running = r
+	}
+
+	run := func() chan error {
+		done := make(chan error)
+		go func() {
+			done <- supervisor.Run(signals)
+		}()
+		return done
+	}
+
+	BeforeEach(func() {
+		runner = &fakes.Runner{}
+		agentClient = &fakes.AgentClient{}
+		agentClient.StatusCall.Returns.Status = agent.Status{
+			LANMembers:      4,
+			LANServers:      3,
+			ExpectedServers: 3,
+			Raft:            true,
+			CommitIndex:     10,
+			LastLogIndex:    11,
+			KeyringKeys:     2,
+			EncryptStage:    "enforce",
+		}
+		tracker = status.NewTracker()
+		metrics = &fakes.Metrics{}
+		logger = &fakes.Logger{}
+		rpcClient = &fakes.FakeconsulRPCClient{}
+		signals = make(chan os.Signal, 1)
+		setRunning(true)
+
+		cfg := config.Default()
+		cfg.Consul.Agent.ACL.AgentToken = "some-agent-token"
+
+		supervisor = &chaperon.Supervisor{
+			Runner:      runner,
+			AgentClient: agentClient,
+			NewRPCClient: func(string) (agent.ConsulRPCClient, error) {
+				return rpcClient, nil
+			},
+			IsRunning: func() bool {
+				runningLock.Lock()
+				defer runningLock.Unlock()
+				return running
+			},
+			NewTimeout: func() confab.Timeout {
+				return confab.NewTimeout(make(chan time.Time))
+			},
+			Tracker:  tracker,
+			Metrics:  metrics,
+			Config:   cfg,
+			Interval: 10 * time.Millisecond,
+			Logger:   logger,
+		}
+	})
+
+	It("starts the agent, records its status and stops it when signalled", func() {
+		done := run()
+
+		Eventually(func() bool {
+			return tracker.Status().AgentUp
+		}).Should(BeTrue())
+
+		st := tracker.Status()
+		Expect(st.LastStart).NotTo(BeZero())
+		Expect(st.LANMembers).To(Equal(4))
+		Expect(st.LANServers).To(Equal(3))
+		Expect(st.ExpectedServers).To(Equal(3))
+		Expect(st.Raft).To(BeTrue())
+		Expect(st.CommitIndex).To(Equal(int64(10)))
+		Expect(st.LastLogIndex).To(Equal(int64(11)))
+		Expect(st.KeyringKeys).To(Equal(2))
+		Expect(st.EncryptStage).To(Equal("enforce"))
+
+		signals <- syscall.SIGTERM
+		Eventually(done).Should(Receive(BeNil()))
+
+		Expect(runner.StartCallCount()).To(Equal(1))
+		Expect(runner.StopCallCount()).To(Equal(1))
+		Expect(tracker.Status().AgentUp).To(BeFalse())
+		Expect(agentClient.SetConsulRPCClientCall.Receives.ConsulRPCClient).To(Equal(rpcClient))
+		Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+			{
+				Action: "supervisor.run.start",
+			},
+			{
+				Action: "supervisor.run.signal",
+				Data:   []lager.Data{{"signal": "terminated"}},
+			},
+			{
+				Action: "supervisor.run.success",
+			},
+		}))
+	})
+
+	It("restarts the agent when its process exits", func() {
+		setRunning(false)
+		done := run()
+
+		Eventually(func() int {
+			return tracker.Status().AgentRestarts
+		}).Should(BeNumerically(">=", 1))
+		setRunning(true)
+
+		signals <- syscall.SIGTERM
+		Eventually(done).Should(Receive(BeNil()))
+
+		restarts := tracker.Status().AgentRestarts
+		Expect(runner.StartCallCount()).To(Equal(restarts + 1))
+		Expect(metrics.Counters["agent.restarts"]).To(Equal(float32(restarts)))
+		Expect(tracker.Status().LastStart).NotTo(BeZero())
+	})
+
+	Context("when certificate expiry is checked", func() {
+		var certChecker *fakes.CertChecker
+
+		BeforeEach(func() {
+			certChecker = &fakes.CertChecker{}
+			certChecker.CheckCertExpiryCall.Returns.Expiries = []certs.Expiry{
+				{File: "/certs/ca.crt", CommonName: "consul-ca", DaysRemaining: 300},
+				{File: "/certs/agent.crt", CommonName: "agent", DaysRemaining: 5},
+			}
+			supervisor.CertChecker = certChecker
+			supervisor.CertCheckInterval = 10 * time.Millisecond
+		})
+
+		It("records the days until each certificate expires, periodically", func() {
+			done := run()
+
+			Eventually(certChecker.CheckCertExpiryCallCount).Should(BeNumerically(">=", 2))
+			Expect(tracker.Status().Certificates).To(Equal([]status.Certificate{
+				{File: "/certs/ca.crt", CommonName: "consul-ca", DaysRemaining: 300},
+				{File: "/certs/agent.crt", CommonName: "agent", DaysRemaining: 5},
+			}))
+
+			signals <- syscall.SIGTERM
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		It("logs failures to check the certificates", func() {
+			certChecker.CheckCertExpiryCall.Returns.Error = errors.New("cannot read ca_file")
+			done := run()
+
+			Eventually(certChecker.CheckCertExpiryCallCount).Should(BeNumerically(">=", 1))
+
+			signals <- syscall.SIGTERM
+			Eventually(done).Should(Receive(BeNil()))
+
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "supervisor.check-certs.failed",
+					Error:  errors.New("cannot read ca_file"),
+				},
+			}))
+		})
+	})
+
+	Context("when the tls material is rotated", func() {
+		var (
+			certWatcher *fakes.CertWatcher
+			tlsReloader *fakes.TLSReloader
+		)
+
+		hasLogged := func(action string) func() bool {
+			return func() bool {
+				logger.Lock()
+				defer logger.Unlock()
+
+				for _, message := range logger.Messages {
+					if message.Action == action {
+						return true
+					}
+				}
+				return false
+			}
+		}
+
+		BeforeEach(func() {
+			certWatcher = &fakes.CertWatcher{}
+			certWatcher.ChangedCall.Returns.Changed = []bool{true}
+			tlsReloader = &fakes.TLSReloader{}
+			tlsReloader.ReloadTLSCall.Returns.Reloaded = true
+
+			supervisor.CertWatcher = certWatcher
+			supervisor.TLSReloader = tlsReloader
+			supervisor.RestartStagger = time.Hour
+		})
+
+		It("reloads the agent without restarting it", func() {
+			done := run()
+
+			Eventually(hasLogged("supervisor.rotate-certs.success")).Should(BeTrue())
+
+			signals <- syscall.SIGTERM
+			Eventually(done).Should(Receive(BeNil()))
+
+			Expect(tlsReloader.ReloadTLSCallCount()).To(Equal(1))
+			Expect(runner.StartCallCount()).To(Equal(1))
+			Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+				{
+					Action: "supervisor.rotate-certs.changed",
+				},
+				{
+					Action: "supervisor.rotate-certs.success",
+				},
+			}))
+		})
+
+		It("keeps the agent running when the new tls material is invalid", func() {
+			tlsReloader.ReloadTLSCall.Returns.Error = errors.New("cert_file does not match key_file")
+			done := run()
+
+			Eventually(hasLogged("supervisor.rotate-certs.reload.failed")).Should(BeTrue())
+			Consistently(runner.StartCallCount, "50ms").Should(Equal(1))
+
+			signals <- syscall.SIGTERM
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		Context("when the agent cannot reload tls", func() {
+			BeforeEach(func() {
+				tlsReloader.ReloadTLSCall.Returns.Reloaded = false
+			})
+
+			It("restarts a client straight away", func() {
+				done := run()
+
+				Eventually(hasLogged("supervisor.rotate-certs.success")).Should(BeTrue())
+
+				signals <- syscall.SIGTERM
+				Eventually(done).Should(Receive(BeNil()))
+
+				Expect(runner.StartCallCount()).To(Equal(2))
+				Expect(runner.StopCallCount()).To(Equal(2))
+				Expect(metrics.Counters["certs.restarts"]).To(Equal(float32(1)))
+				Expect(logger.Messages).To(ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "supervisor.rotate-certs.changed",
+					},
+					{
+						Action: "supervisor.rotate-certs.restart",
+					},
+					{
+						Action: "supervisor.rotate-certs.success",
+					},
+				}))
+			})
+
+			Context("when the agent is a server", func() {
+				BeforeEach(func() {
+					supervisor.Config.Consul.Agent.Mode = "server"
+				})
+
+				It("restarts the first node once every expected server is alive", func() {
+					done := run()
+
+					Eventually(hasLogged("supervisor.rotate-certs.success")).Should(BeTrue())
+
+					signals <- syscall.SIGTERM
+					Eventually(done).Should(Receive(BeNil()))
+
+					Expect(runner.StartCallCount()).To(Equal(2))
+				})
+
+				It("postpones the restart while a server is missing", func() {
+					agentClient.StatusCall.Returns.Status.LANServers = 2
+					done := run()
+
+					Eventually(hasLogged("supervisor.rotate-certs.restart.postponed")).Should(BeTrue())
+					Consistently(runner.StartCallCount, "50ms").Should(Equal(1))
+
+					signals <- syscall.SIGTERM
+					Eventually(done).Should(Receive(BeNil()))
+				})
+
+				It("staggers the restart by node index", func() {
+					supervisor.Config.Node.Index = 2
+					done := run()
+
+					Eventually(hasLogged("supervisor.rotate-certs.restart.postponed")).Should(BeTrue())
+					Consistently(runner.StartCallCount, "50ms").Should(Equal(1))
+
+					signals <- syscall.SIGTERM
+					Eventually(done).Should(Receive(BeNil()))
+				})
+			})
+		})
+	})
+
+	Context("when the rpc client cannot be created", func() {
+		It("collects the status without it", func() {
+			supervisor.NewRPCClient = func(string) (agent.ConsulRPCClient, error) {
+				return nil, errors.New("rpc error")
+			}
+			done := run()
+
+			Eventually(func() int {
+				return tracker.Status().LANServers
+			}).Should(Equal(3))
+
+			signals <- syscall.SIGTERM
+			Eventually(done).Should(Receive(BeNil()))
+
+			Expect(agentClient.SetConsulRPCClientCall.Receives.ConsulRPCClient).To(BeNil())
+		})
+	})
+
+	Context("failure cases", func() {
+		It("returns an error when the agent cannot be started", func() {
+			runner.StartCall.Returns.Errors = []error{errors.New("start error")}
+
+			Expect(supervisor.Run(signals)).To(MatchError("start error"))
+			Expect(tracker.Status().AgentUp).To(BeFalse())
+		})
+
+		It("records status collection errors", func() {
+			agentClient.StatusCall.Returns.Error = errors.New("members error")
+			done := run()
+
+			Eventually(func() string {
+				return tracker.Status().CollectError
+			}).Should(Equal("members error"))
+
+			signals <- syscall.SIGTERM
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		It("keeps retrying when restarting the agent fails", func() {
+			runner.StartCall.Returns.Errors = []error{nil, errors.New("restart error")}
+			setRunning(false)
+			done := run()
+
+			Eventually(runner.StopCallCount).Should(BeNumerically(">=", 1))
+			Eventually(runner.StartCallCount).Should(BeNumerically(">=", 3))
+
+			signals <- syscall.SIGTERM
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(tracker.Status().AgentUp).To(BeFalse())
+		})
+	})
+})
@@ -2,14 +2,21 @@ package main_test
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/keyring"
+	"github.com/pivotal-golang/clock"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -46,7 +53,7 @@ var _ = Describe("confab", func() {
 
 		writeConfigurationFile(configFile.Name(), map[string]interface{}{})
 
-		options := []byte(`{"Members": ["member-1", "member-2", "member-3"]}`)
+		options := []byte(`{"Members": ["10.0.0.1", "10.0.0.2", "10.0.0.3"]}`)
 		err = ioutil.WriteFile(filepath.Join(consulConfigDir, "options.json"), options, 0600)
 		Expect(err).NotTo(HaveOccurred())
 	})
@@ -82,7 +89,7 @@ var _ = Describe("confab", func() {
 						"datacenter": "dc1",
 						"log_level":  "debug",
 						"servers": map[string]interface{}{
-							"lan": []string{"member-1", "member-2", "member-3"},
+							"lan": []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
 							"wan": []string{"wan-member-1", "wan-member-2", "wan-member-3"},
 						},
 						"services": map[string]interface{}{
@@ -136,7 +143,8 @@ var _ = Describe("confab", func() {
 					"-recursor=8.8.8.8",
 					"-recursor=10.0.2.3",
 				},
-				LeaveCallCount: 1,
+				LeaveCallCount:             1,
+				EnableMaintenanceCallCount: 1,
 			}))
 
 			serviceConfig, err := ioutil.ReadFile(filepath.Join(consulConfigDir, "service-cloud_controller.json"))
@@ -188,9 +196,9 @@ var _ = Describe("confab", func() {
 				},
 				"rejoin_after_leave": true,
 				"retry_join": [
-					"member-1",
-					"member-2",
-					"member-3"
+					"10.0.0.1",
+					"10.0.0.2",
+					"10.0.0.3"
 				],
 				"retry_join_wan": [
 					"wan-member-1",
@@ -223,7 +231,7 @@ var _ = Describe("confab", func() {
 				"consul": map[string]interface{}{
 					"agent": map[string]interface{}{
 						"servers": map[string]interface{}{
-							"lan": []string{"member-1", "member-2", "member-3"},
+							"lan": []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
 						},
 					},
 				},
@@ -259,9 +267,27 @@ var _ = Describe("confab", func() {
 			})
 		})
 
+		Context("when the agent sees servers of another cluster", func() {
+			BeforeEach(func() {
+				options := []byte(`{"Members": ["10.0.0.1", "10.0.0.2", "10.0.1.9"]}`)
+				Expect(ioutil.WriteFile(filepath.Join(consulConfigDir, "options.json"), options, 0600)).To(Succeed())
+			})
+
+			It("fails to start and lists the foreign servers", func() {
+				cmd := exec.Command(pathToConfab,
+					"start",
+					"--config-file", configFile.Name(),
+				)
+				buffer := bytes.NewBuffer([]byte{})
+				cmd.Stderr = buffer
+				Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
+				Expect(buffer).To(ContainSubstring("error during start: joined a foreign cluster, unexpected servers: 10.0.1.9 (not an expected server)"))
+			})
+		})
+
 		Context("for a server", func() {
 			BeforeEach(func() {
-				options := []byte(`{"Members": ["member-1", "member-2", "member-3"]}`)
+				options := []byte(`{"Members": ["10.0.0.1", "10.0.0.2", "10.0.0.3"]}`)
 				Expect(ioutil.WriteFile(filepath.Join(consulConfigDir, "options.json"), options, 0600)).To(Succeed())
 				writeConfigurationFile(configFile.Name(), map[string]interface{}{
 					"path": map[string]interface{}{
@@ -273,7 +299,7 @@ var _ = Describe("confab", func() {
 						"agent": map[string]interface{}{
 							"mode": "server",
 							"servers": map[string]interface{}{
-								"lan": []string{"member-1", "member-2", "member-3"},
+								"lan": []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
 							},
 						},
 						"encrypt_keys": []string{"key-1", "key-2"},
@@ -321,7 +347,7 @@ var _ = Describe("confab", func() {
 						"agent": map[string]interface{}{
 							"mode": "server",
 							"servers": map[string]interface{}{
-								"lan": []string{"member-1", "member-2", "member-3"},
+								"lan": []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
 							},
 						},
 						"encrypt_keys": []string{"key-1", "key-2"},
@@ -331,7 +357,7 @@ var _ = Describe("confab", func() {
 					},
 				})
 
-				options := []byte(`{"Members": ["member-1", "member-2", "member-3"], "FailStatsEndpoint": true}`)
+				options := []byte(`{"Members": ["10.0.0.1", "10.0.0.2", "10.0.0.3"], "FailStatsEndpoint": true}`)
 				Expect(ioutil.WriteFile(filepath.Join(consulConfigDir, "options.json"), options, 0600)).To(Succeed())
 
 				cmd := exec.Command(pathToConfab,
@@ -353,7 +379,7 @@ var _ = Describe("confab", func() {
 
 	Context("when stopping", func() {
 		BeforeEach(func() {
-			options := []byte(`{"Members": ["member-1", "member-2", "member-3"]}`)
+			options := []byte(`{"Members": ["10.0.0.1", "10.0.0.2", "10.0.0.3"]}`)
 			Expect(ioutil.WriteFile(filepath.Join(consulConfigDir, "options.json"), options, 0600)).To(Succeed())
 
 			writeConfigurationFile(configFile.Name(), map[string]interface{}{
@@ -366,7 +392,7 @@ var _ = Describe("confab", func() {
 					"agent": map[string]interface{}{
 						"mode": "server",
 						"servers": map[string]interface{}{
-							"lan": []string{"member-1", "member-2", "member-3"},
+							"lan": []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
 						},
 					},
 					"encrypt_keys": []string{"key-1", "key-2"},
@@ -415,6 +441,240 @@ var _ = Describe("confab", func() {
 		})
 	})
 
+	Context("when toggling maintenance", func() {
+		BeforeEach(func() {
+			writeConfigurationFile(configFile.Name(), map[string]interface{}{
+				"path": map[string]interface{}{
+					"agent_path":        pathToFakeAgent,
+					"consul_config_dir": consulConfigDir,
+					"pid_file":          pidFile.Name(),
+				},
+				"consul": map[string]interface{}{
+					"agent": map[string]interface{}{
+						"servers": map[string]interface{}{
+							"lan": []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+						},
+					},
+				},
+			})
+		})
+
+		AfterEach(func() {
+			Expect(os.Remove(configFile.Name())).To(Succeed())
+
+			killProcessWithPIDFile(pidFile.Name())
+		})
+
+		It("enables and disables maintenance on the running agent", func() {
+			start := exec.Command(pathToConfab,
+				"start",
+				"--config-file", configFile.Name(),
+			)
+			Eventually(start.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).Should(Succeed())
+
+			enable := exec.Command(pathToConfab,
+				"maint", "enable",
+				"--config-file", configFile.Name(),
+				"--reason", "upgrading",
+			)
+			Eventually(enable.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).Should(Succeed())
+
+			disable := exec.Command(pathToConfab,
+				"maint", "disable",
+				"--config-file", configFile.Name(),
+			)
+			Eventually(disable.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).Should(Succeed())
+
+			output, err := fakeAgentOutput(consulConfigDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.EnableMaintenanceCallCount).To(Equal(1))
+			Expect(output.DisableMaintenanceCallCount).To(Equal(1))
+		})
+
+		It("requires an action", func() {
+			cmd := exec.Command(pathToConfab, "maint", "--config-file", configFile.Name())
+			buffer := bytes.NewBuffer([]byte{})
+			cmd.Stderr = buffer
+			Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
+			Expect(buffer).To(ContainSubstring(`maint requires "enable" or "disable"`))
+		})
+	})
+
+	Context("when rendering the consul configuration", func() {
+		It("prints the generated configuration with extra_config merged in", func() {
+			tokenFile := filepath.Join(tempDir, "agent.token")
+			Expect(ioutil.WriteFile(tokenFile, []byte("some-agent-token"), 0600)).To(Succeed())
+
+			writeConfigurationFile(configFile.Name(), map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":  "my-node",
+					"index": 3,
+				},
+				"consul": map[string]interface{}{
+					"agent": map[string]interface{}{
+						"acl": map[string]interface{}{
+							"agent_token_file": tokenFile,
+						},
+						"extra_config": map[string]interface{}{
+							"ui":        true,
+							"acl_token": "some-default-token",
+							"ports": map[string]interface{}{
+								"http": 8501,
+							},
+						},
+					},
+				},
+			})
+
+			cmd := exec.Command(pathToConfab,
+				"render",
+				"--config-file", configFile.Name(),
+			)
+			output, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+
+			var rendered map[string]interface{}
+			Expect(json.Unmarshal(output, &rendered)).To(Succeed())
+			Expect(rendered["node_name"]).To(Equal("my-node-3"))
+			Expect(rendered["ui"]).To(BeTrue())
+			Expect(rendered["ports"]).To(Equal(map[string]interface{}{
+				"dns":  float64(53),
+				"http": float64(8501),
+			}))
+			Expect(rendered["acl_token"]).To(Equal("[redacted]"))
+			Expect(rendered["acl_agent_token"]).To(Equal("[redacted]"))
+		})
+	})
+
+	Context("when layering configuration", func() {
+		It("merges the files and environment and shows where each setting came from", func() {
+			writeConfigurationFile(configFile.Name(), map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":  "my-node",
+					"index": 3,
+				},
+				"consul": map[string]interface{}{
+					"agent": map[string]interface{}{
+						"log_level": "info",
+					},
+				},
+			})
+
+			overrideFile := filepath.Join(tempDir, "override.yml")
+			Expect(ioutil.WriteFile(overrideFile, []byte("consul:\n  agent:\n    log_level: debug\n"), 0600)).To(Succeed())
+
+			cmd := exec.Command(pathToConfab,
+				"config", "show",
+				"--config-file", configFile.Name(),
+				"--config-file", overrideFile,
+			)
+			cmd.Env = append(os.Environ(), "CONFAB_NODE__INDEX=4")
+			output, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(string(output)).To(ContainSubstring(fmt.Sprintf("node.name = \"my-node\"  # %s\n", configFile.Name())))
+			Expect(string(output)).To(ContainSubstring("node.index = 4  # env:CONFAB_NODE__INDEX\n"))
+			Expect(string(output)).To(ContainSubstring(fmt.Sprintf("consul.agent.log_level = \"debug\"  # %s\n", overrideFile)))
+			Expect(string(output)).To(ContainSubstring("confab.timeout_in_seconds = 55  # default\n"))
+		})
+	})
+
+	Context("when migrating configuration", func() {
+		It("rewrites an unversioned file in the current schema", func() {
+			Expect(ioutil.WriteFile(configFile.Name(), []byte(`{"Consul": {"Agent": {"Mode": "server"}}}`), 0600)).To(Succeed())
+
+			output, err := exec.Command(pathToConfab, "config", "migrate", "--config-file", configFile.Name()).Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(ContainSubstring(fmt.Sprintf("migrated %s from schema_version 1 to 2", configFile.Name())))
+
+			contents, err := ioutil.ReadFile(configFile.Name())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(contents).To(MatchJSON(`{"schema_version": 2, "consul": {"agent": {"mode": "server"}}}`))
+		})
+
+		It("rejects unknown settings unless lenient", func() {
+			writeConfigurationFile(configFile.Name(), map[string]interface{}{
+				"consul": map[string]interface{}{
+					"agent": map[string]interface{}{
+						"mdoe": "server",
+					},
+				},
+			})
+
+			cmd := exec.Command(pathToConfab, "config", "show", "--config-file", configFile.Name())
+			buffer := bytes.NewBuffer([]byte{})
+			cmd.Stderr = buffer
+			Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
+			Expect(buffer).To(ContainSubstring("unknown settings: consul.agent.mdoe"))
+
+			cmd = exec.Command(pathToConfab, "config", "show", "--lenient-config", "--config-file", configFile.Name())
+			Expect(cmd.Run()).To(Succeed())
+		})
+	})
+
+	Context("when generating certificates", func() {
+		It("writes a CA with server and agent key pairs", func() {
+			certsDir := filepath.Join(tempDir, "generated-certs")
+
+			cmd := exec.Command(pathToConfab,
+				"certs", "generate",
+				"-dir", certsDir,
+				"-datacenter", "dc2",
+				"-domain", "cf.internal",
+				"-valid-for-days", "10",
+			)
+			output, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(ContainSubstring("server.dc2.cf.internal"))
+
+			verifier := certs.Verifier{Clock: clock.NewClock()}
+			Expect(verifier.Verify(certs.Files{
+				CA:   filepath.Join(certsDir, "ca.crt"),
+				Cert: filepath.Join(certsDir, "server.crt"),
+				Key:  filepath.Join(certsDir, "server.key"),
+			}, "server.dc2.cf.internal")).To(Succeed())
+			Expect(verifier.Verify(certs.Files{
+				CA:   filepath.Join(certsDir, "ca.crt"),
+				Cert: filepath.Join(certsDir, "agent.crt"),
+				Key:  filepath.Join(certsDir, "agent.key"),
+			}, "")).To(Succeed())
+		})
+
+		It("requires a directory", func() {
+			cmd := exec.Command(pathToConfab, "certs", "generate")
+			buffer := bytes.NewBuffer([]byte{})
+			cmd.Stderr = buffer
+			Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
+			Expect(buffer).To(ContainSubstring(`error generating certificates: "dir" cannot be empty`))
+		})
+	})
+
+	Context("when generating a gossip key", func() {
+		It("prints a random key and its fingerprint", func() {
+			output, err := exec.Command(pathToConfab, "keygen", "-size", "32").Output()
+			Expect(err).NotTo(HaveOccurred())
+
+			lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+			Expect(lines).To(HaveLen(2))
+
+			key := strings.TrimSpace(strings.TrimPrefix(lines[0], "key:"))
+			Expect(key).To(HavePrefix(keyring.KeyPrefix))
+
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(key, keyring.KeyPrefix))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded).To(HaveLen(32))
+			Expect(lines[1]).To(Equal("fingerprint: " + keyring.Fingerprint(key)))
+		})
+
+		It("rejects key sizes consul does not accept", func() {
+			cmd := exec.Command(pathToConfab, "keygen", "-size", "20")
+			buffer := bytes.NewBuffer([]byte{})
+			cmd.Stderr = buffer
+			Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
+			Expect(buffer).To(ContainSubstring("error generating key: key size must be one of 16, 24 or 32 bytes, got 20"))
+		})
+	})
+
 	Context("failure cases", func() {
 		BeforeEach(func() {
 			writeConfigurationFile(configFile.Name(), map[string]interface{}{
@@ -436,7 +696,7 @@ var _ = Describe("confab", func() {
 
 				usageLines := []string{
 					"usage: confab COMMAND OPTIONS",
-					"COMMAND: \"start\" or \"stop\"",
+					"COMMAND: \"start\", \"supervise\", \"stop\", \"render\", \"maint enable|disable\" or \"certs generate\"",
 					"-config-file",
 					"specifies the config file",
 				}
@@ -495,7 +755,7 @@ var _ = Describe("confab", func() {
 					"consul": map[string]interface{}{
 						"agent": map[string]interface{}{
 							"servers": map[string]interface{}{
-								"lan": []string{"member-1"},
+								"lan": []string{"10.0.0.1"},
 							},
 						},
 					},
@@ -524,7 +784,7 @@ var _ = Describe("confab", func() {
 					"consul": map[string]interface{}{
 						"agent": map[string]interface{}{
 							"servers": map[string]interface{}{
-								"lan": []string{"member-1"},
+								"lan": []string{"10.0.0.1"},
 							},
 						},
 					},
@@ -553,7 +813,7 @@ var _ = Describe("confab", func() {
 					"consul": map[string]interface{}{
 						"agent": map[string]interface{}{
 							"servers": map[string]interface{}{
-								"lan": []string{"member-1"},
+								"lan": []string{"10.0.0.1"},
 							},
 						},
 					},
@@ -582,7 +842,7 @@ var _ = Describe("confab", func() {
 					"consul": map[string]interface{}{
 						"agent": map[string]interface{}{
 							"servers": map[string]interface{}{
-								"lan": []string{"member-1", "member-2", "member-3"},
+								"lan": []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
 							},
 						},
 					},
@@ -627,7 +887,7 @@ var _ = Describe("confab", func() {
 						"agent": map[string]interface{}{
 							"mode": "server",
 							"servers": map[string]interface{}{
-								"lan": []string{"member-1", "member-2", "member-3"},
+								"lan": []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
 							},
 						},
 					},
@@ -640,7 +900,7 @@ var _ = Describe("confab", func() {
 			})
 
 			It("returns an error and exits with status 1", func() {
-				options := []byte(`{ "Members": ["member-1", "member-2", "member-3"], "FailRPCServer": true }`)
+				options := []byte(`{ "Members": ["10.0.0.1", "10.0.0.2", "10.0.0.3"], "FailRPCServer": true }`)
 				Expect(ioutil.WriteFile(filepath.Join(consulConfigDir, "options.json"), options, 0600)).To(Succeed())
 
 				cmd := exec.Command(pathToConfab,
@@ -699,6 +959,61 @@ var _ = Describe("confab", func() {
 			})
 		})
 
+		Context("when an acl token file cannot be read", func() {
+			It("returns an error and exits with status 1", func() {
+				tmpFile, err := ioutil.TempFile(tempDir, "config")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = tmpFile.Write([]byte(`{"consul": {"agent": {"acl": {"agent_token_file": "/some-missing-token"}}}}`))
+				Expect(err).NotTo(HaveOccurred())
+
+				cmd := exec.Command(pathToConfab,
+					"start",
+					"--config-file", tmpFile.Name(),
+				)
+				buffer := bytes.NewBuffer([]byte{})
+				cmd.Stderr = buffer
+				Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
+				Expect(buffer).To(ContainSubstring("error reading secrets: could not read acl token file"))
+			})
+		})
+
+		Context("when the configuration is invalid", func() {
+			It("returns an error and exits with status 1", func() {
+				tmpFile, err := ioutil.TempFile(tempDir, "config")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = tmpFile.Write([]byte(`{"consul": {"agent": {"performance": {"raft_multiplier": 20}}}}`))
+				Expect(err).NotTo(HaveOccurred())
+
+				cmd := exec.Command(pathToConfab,
+					"start",
+					"--config-file", tmpFile.Name(),
+				)
+				buffer := bytes.NewBuffer([]byte{})
+				cmd.Stderr = buffer
+				Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
+				Expect(buffer).To(ContainSubstring(`invalid configuration: "raft_multiplier" must be between 1 and 10, got 20`))
+			})
+
+			It("rejects extra_config that overrides settings confab manages", func() {
+				tmpFile, err := ioutil.TempFile(tempDir, "config")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = tmpFile.Write([]byte(`{"consul": {"agent": {"extra_config": {"data_dir": "/tmp"}}}}`))
+				Expect(err).NotTo(HaveOccurred())
+
+				cmd := exec.Command(pathToConfab,
+					"render",
+					"--config-file", tmpFile.Name(),
+				)
+				buffer := bytes.NewBuffer([]byte{})
+				cmd.Stderr = buffer
+				Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
+				Expect(buffer).To(ContainSubstring(`invalid configuration: "extra_config" cannot override "data_dir", it is managed by confab`))
+			})
+		})
+
 		Context("when the consul config dir is not writeable", func() {
 			BeforeEach(func() {
 				writeConfigurationFile(configFile.Name(), map[string]interface{}{
@@ -715,7 +1030,7 @@ var _ = Describe("confab", func() {
 								},
 							},
 							"servers": map[string]interface{}{
-								"lan": []string{"member-1"},
+								"lan": []string{"10.0.0.1"},
 							},
 						},
 					},
@@ -2,9 +2,15 @@ package main_test
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,6 +18,7 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/onsi/gomega/gexec"
 
@@ -27,6 +34,7 @@ func TestMain(t *testing.T) {
 var (
 	pathToFakeAgent string
 	pathToConfab    string
+	certsDir        string
 )
 
 var _ = BeforeSuite(func() {
@@ -39,12 +47,68 @@ var _ = BeforeSuite(func() {
 
 	cmd := exec.Command("which", "lsof")
 	Expect(cmd.Run()).To(Succeed())
+
+	certsDir, err = ioutil.TempDir("", "certs")
+	Expect(err).NotTo(HaveOccurred())
+	writeCerts(certsDir)
 })
 
 var _ = AfterSuite(func() {
 	gexec.CleanupBuildArtifacts()
+	Expect(os.RemoveAll(certsDir)).To(Succeed())
 })
 
+// writeCerts writes a CA with server and agent key pairs signed by it, in
+// the layout confab expects under certs_dir.
+func writeCerts(dir string) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	Expect(err).NotTo(HaveOccurred())
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "consul-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	ca, err := x509.ParseCertificate(caDER)
+	Expect(err).NotTo(HaveOccurred())
+
+	writePEM(filepath.Join(dir, "ca.crt"), "CERTIFICATE", caDER)
+
+	for i, name := range []string{"server", "agent"} {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		Expect(err).NotTo(HaveOccurred())
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{"server.dc1.consul", "server.dc1.some-domain"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		writePEM(filepath.Join(dir, name+".crt"), "CERTIFICATE", der)
+		writePEM(filepath.Join(dir, name+".key"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	}
+}
+
+func writePEM(path, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	Expect(ioutil.WriteFile(path, data, 0600)).To(Succeed())
+}
+
 type FakeAgentOutputData struct {
 	Args                []string
 	PID                 int
@@ -52,6 +116,9 @@ type FakeAgentOutputData struct {
 	UseKeyCallCount     int
 	InstallKeyCallCount int
 	StatsCallCount      int
+
+	EnableMaintenanceCallCount  int
+	DisableMaintenanceCallCount int
 }
 
 func killProcessWithPIDFile(pidFilePath string) {
@@ -140,7 +207,15 @@ func killProcessAttachedToPort(port int) {
 	}
 }
 
+// writeConfigurationFile points certs_dir at the suite's certificates unless
+// the configuration sets it.
 func writeConfigurationFile(filename string, configuration map[string]interface{}) {
+	if path, ok := configuration["path"].(map[string]interface{}); ok {
+		if _, ok := path["certs_dir"]; !ok {
+			path["certs_dir"] = certsDir
+		}
+	}
+
 	configData, err := json.Marshal(configuration)
 	Expect(err).NotTo(HaveOccurred())
 
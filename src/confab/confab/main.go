@@ -1,18 +1,27 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/cloudfoundry-incubator/consul-release/src/confab"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/chaperon"
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/keyring"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/status"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/telemetry"
 	"github.com/hashicorp/consul/api"
 	consulagent "github.com/hashicorp/consul/command/agent"
 	"github.com/pivotal-golang/clock"
@@ -37,8 +46,9 @@ func (ss *stringSlice) Set(value string) error {
 }
 
 var (
-	recursors  stringSlice
-	configFile string
+	recursors     stringSlice
+	configFiles   stringSlice
+	lenientConfig bool
 
 	stdout = log.New(os.Stdout, "", 0)
 	stderr = log.New(os.Stderr, "", 0)
@@ -47,25 +57,121 @@ var (
 func main() {
 	flagSet := flag.NewFlagSet("flags", flag.ContinueOnError)
 	flagSet.Var(&recursors, "recursor", "specifies the address of an upstream DNS `server`, may be specified multiple times")
-	flagSet.StringVar(&configFile, "config-file", "", "specifies the config `file`")
+	flagSet.Var(&configFiles, "config-file", "specifies a JSON or YAML config `file`, may be specified multiple times with later files overriding earlier ones")
+	flagSet.BoolVar(&lenientConfig, "lenient-config", false, "ignores keys of the config files that name no setting instead of failing")
 
 	if len(os.Args) < 2 {
 		printUsageAndExit("invalid number of arguments", flagSet)
 	}
 
-	if err := flagSet.Parse(os.Args[2:]); err != nil {
+	if os.Args[1] == "certs" {
+		if err := generateCerts(os.Args[2:]); err != nil {
+			stderr.Printf("error generating certificates: %s", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if os.Args[1] == "keygen" {
+		if err := keygen(os.Args[2:]); err != nil {
+			stderr.Printf("error generating key: %s", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	args := os.Args[2:]
+
+	var maintAction, maintService, maintReason string
+	if os.Args[1] == "maint" {
+		if len(args) == 0 || (args[0] != "enable" && args[0] != "disable") {
+			printUsageAndExit("maint requires \"enable\" or \"disable\"", flagSet)
+		}
+
+		maintAction, args = args[0], args[1:]
+		flagSet.StringVar(&maintService, "service", "", "puts only the service with this `id` into maintenance")
+		flagSet.StringVar(&maintReason, "reason", "confab maint", "`reason` shown for the maintenance")
+	}
+
+	var configAction string
+	if os.Args[1] == "config" {
+		if len(args) == 0 || (args[0] != "show" && args[0] != "migrate") {
+			printUsageAndExit("config requires \"show\" or \"migrate\"", flagSet)
+		}
+
+		configAction, args = args[0], args[1:]
+	}
+
+	if err := flagSet.Parse(args); err != nil {
 		os.Exit(1)
 	}
 
-	configFileContents, err := ioutil.ReadFile(configFile)
+	if configAction == "migrate" {
+		if err := migrateConfig(configFiles); err != nil {
+			stderr.Printf("error migrating configuration: %s", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	loader := config.Loader{
+		Files:       configFiles,
+		Environment: os.Environ(),
+		Lenient:     lenientConfig,
+		Warn: func(message string) {
+			stderr.Printf("warning: %s", message)
+		},
+	}
+
+	cfg, provenance, err := loader.Load()
 	if err != nil {
 		stderr.Printf("error reading configuration file: %s", err)
 		os.Exit(1)
 	}
 
-	cfg, err := config.ConfigFromJSON(configFileContents)
+	if os.Args[1] == "config" {
+		if err := showConfig(cfg, provenance); err != nil {
+			stderr.Printf("error showing configuration: %s", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	cfg, err = config.LoadSecrets(cfg)
 	if err != nil {
-		stderr.Printf("error reading configuration file: %s", err)
+		stderr.Printf("error reading secrets: %s", err)
+		os.Exit(1)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		stderr.Printf("invalid configuration: %s", err)
+		os.Exit(1)
+	}
+
+	if os.Args[1] == "render" {
+		if err := render(cfg); err != nil {
+			stderr.Printf("error rendering consul configuration: %s", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if os.Args[1] == "maint" {
+		if err := maintenance(cfg, maintAction, maintService, maintReason); err != nil {
+			stderr.Printf("error during maint: %s", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if err := cfg.ValidateAddresses(config.HostInterfaces{}); err != nil {
+		stderr.Printf("invalid configuration: %s", err)
 		os.Exit(1)
 	}
 
@@ -81,6 +187,12 @@ func main() {
 	logger := lager.NewLogger("confab")
 	logger.RegisterSink(lager.NewWriterSink(os.Stdout, lager.INFO))
 
+	metrics, err := telemetry.New(cfg.Consul.Agent.Telemetry)
+	if err != nil {
+		stderr.Printf("error configuring telemetry: %s", err)
+		os.Exit(1)
+	}
+
 	agentRunner := &agent.Runner{
 		Path:      path,
 		PIDFile:   cfg.Path.PIDFile,
@@ -91,16 +203,37 @@ func main() {
 		Logger:    logger,
 	}
 
-	consulAPIClient, err := api.NewClient(api.DefaultConfig())
+	apiConfig := api.DefaultConfig()
+	apiConfig.Address = cfg.Consul.Agent.HTTPAddress()
+	apiConfig.Token = cfg.Consul.Agent.ACL.ClientToken()
+
+	consulAPIClient, err := api.NewClient(apiConfig)
 	if err != nil {
 		panic(err) // not tested, NewClient never errors
 	}
 
+	datacenter := cfg.Consul.Agent.Datacenter
+	if datacenter == "" {
+		datacenter = "dc1"
+	}
+
 	agentClient := &agent.Client{
 		ExpectedMembers: cfg.Consul.Agent.Servers.LAN,
+		Datacenter:      datacenter,
+		MinServers:      cfg.Confab.MinJoinedServers,
+		EncryptStage:    cfg.Consul.EncryptStage,
+		Resolver:        config.NetResolver{},
 		ConsulAPIAgent:  consulAPIClient.Agent(),
 		ConsulRPCClient: nil,
-		Logger:          logger,
+		ConsulACL:       consulAPIClient.ACL(),
+		ConsulHealth:    consulAPIClient.Health(),
+		Autopilot: agent.AutopilotClient{
+			Address:    apiConfig.Address,
+			Token:      apiConfig.Token,
+			HTTPClient: http.DefaultClient,
+		},
+		Logger:  logger,
+		Metrics: metrics,
 	}
 
 	controller := chaperon.Controller{
@@ -108,23 +241,72 @@ func main() {
 		AgentClient:    agentClient,
 		SyncRetryDelay: 1 * time.Second,
 		SyncRetryClock: clock.NewClock(),
+		DrainTimeout:   time.Duration(cfg.Confab.DrainTimeoutInSeconds) * time.Second,
 		EncryptKeys:    cfg.Consul.EncryptKeys,
+		SSLDisabled:    !cfg.Consul.Agent.TLS.IsEnabled(),
 		Logger:         logger,
+		Metrics:        metrics,
 		ServiceDefiner: config.ServiceDefiner{logger},
-		ConfigDir:      cfg.Path.ConsulConfigDir,
-		Config:         cfg,
+		TLSVerifier: certs.Verifier{
+			Clock:        clock.NewClock(),
+			AllowExpired: !cfg.Confab.RefuseExpiredCerts,
+		},
+		ConfigDir: cfg.Path.ConsulConfigDir,
+		Config:    cfg,
 	}
 
 	keyringRemover := chaperon.NewKeyringRemover(cfg.Path.KeyringFile, logger)
-	configWriter := chaperon.NewConfigWriter(cfg.Path.ConsulConfigDir, logger)
+	clusterDetector := agent.ClusterDetector{
+		DataDir:    config.GenerateConfiguration(cfg).DataDir,
+		Port:       cfg.Consul.Agent.HTTPPort(),
+		HTTPClient: &http.Client{Timeout: 2 * time.Second},
+		Logger:     logger,
+	}
+
+	configWriter := chaperon.NewConfigWriter(cfg.Path.ConsulConfigDir, config.NetResolver{}, clusterDetector, logger)
+
+	// consul 0.8.0 removed the agent RPC interface, newer agents are asked
+	// for their stats, keyring and to leave through the HTTP API instead.
+	newRPCClient := func(string) (agent.ConsulRPCClient, error) {
+		output, err := agentRunner.Version()
+		if err != nil {
+			return nil, err
+		}
+
+		version, err := config.ParseConsulVersion(output)
+		if err != nil {
+			return nil, err
+		}
+
+		if !version.Supports(config.FeatureRPC) {
+			return agent.HTTPRPCClient{
+				Address:    apiConfig.Address,
+				Token:      apiConfig.Token,
+				HTTPClient: http.DefaultClient,
+			}, nil
+		}
+
+		rpcClient, err := consulagent.NewRPCClient(cfg.Consul.Agent.RPCAddress())
+		if err != nil {
+			return nil, err
+		}
 
-	var r runner = chaperon.NewClient(controller, consulagent.NewRPCClient, keyringRemover, configWriter)
+		return &agent.RPCClient{
+			RPCClient: *rpcClient,
+			Token:     apiConfig.Token,
+		}, nil
+	}
+
+	var r runner = chaperon.NewClient(controller, newRPCClient, keyringRemover, configWriter)
 	if controller.Config.Consul.Agent.Mode == "server" {
-		r = chaperon.NewServer(controller, configWriter, consulagent.NewRPCClient)
+		r = chaperon.NewServer(controller, configWriter, newRPCClient)
 	}
 
-	switch os.Args[1] {
-	case "start":
+	newTimeout := func() confab.Timeout {
+		return confab.NewTimeout(time.After(time.Duration(controller.Config.Confab.TimeoutInSeconds) * time.Second))
+	}
+
+	verifyStartable := func() {
 		_, err = os.Stat(controller.Config.Path.ConsulConfigDir)
 		if err != nil {
 			printUsageAndExit(fmt.Sprintf("\"consul_config_dir\" %q could not be found",
@@ -139,27 +321,248 @@ func main() {
 		if len(agentClient.ExpectedMembers) == 0 {
 			printUsageAndExit("at least one \"expected-member\" must be provided", flagSet)
 		}
-		timeout := confab.NewTimeout(time.After(time.Duration(controller.Config.Confab.TimeoutInSeconds) * time.Second))
+	}
+
+	switch os.Args[1] {
+	case "start":
+		verifyStartable()
 
-		if err := r.Start(cfg, timeout); err != nil {
+		if err := r.Start(cfg, newTimeout()); err != nil {
 			stderr.Printf("error during start: %s", err)
 			r.Stop()
+			metrics.Shutdown()
+			os.Exit(1)
+		}
+	case "supervise":
+		verifyStartable()
+
+		tracker := status.NewTracker()
+		if cfg.Confab.StatusPort != 0 {
+			listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.Confab.StatusPort))
+			if err != nil {
+				stderr.Printf("error serving status: %s", err)
+				os.Exit(1)
+			}
+
+			go http.Serve(listener, tracker)
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+		supervisor := &chaperon.Supervisor{
+			Runner:       r,
+			AgentClient:  agentClient,
+			NewRPCClient: newRPCClient,
+			IsRunning: func() bool {
+				return chaperon.IsRunningProcess(agentRunner.PIDFile)
+			},
+			NewTimeout: newTimeout,
+			Tracker:    tracker,
+			Metrics:    metrics,
+			Config:     cfg,
+			Interval:   time.Duration(cfg.Confab.SuperviseIntervalInSeconds) * time.Second,
+			Logger:     logger,
+		}
+
+		if !controller.SSLDisabled {
+			consulConfig := config.GenerateConfiguration(cfg)
+
+			supervisor.CertChecker = controller
+			supervisor.CertCheckInterval = time.Duration(cfg.Confab.CertCheckIntervalInSeconds) * time.Second
+			supervisor.CertWatcher = certs.NewWatcher(certs.Files{
+				CA:   *consulConfig.CAFile,
+				Cert: *consulConfig.CertFile,
+				Key:  *consulConfig.KeyFile,
+			})
+			supervisor.TLSReloader = controller
+			supervisor.RestartStagger = time.Duration(cfg.Confab.TimeoutInSeconds) * time.Second
+		}
+
+		if err := supervisor.Run(signals); err != nil {
+			stderr.Printf("error during supervise: %s", err)
+			r.Stop()
+			metrics.Shutdown()
 			os.Exit(1)
 		}
 	case "stop":
 		if err := r.Stop(); err != nil {
 			stderr.Printf("error during stop: %s", err)
+			metrics.Shutdown()
 			os.Exit(1)
 		}
 	default:
 		printUsageAndExit(fmt.Sprintf("invalid COMMAND %q", os.Args[1]), flagSet)
 	}
+
+	metrics.Shutdown()
+}
+
+// render prints the consul configuration confab would write, with
+// extra_config merged in and the gossip key and tokens redacted.
+func render(cfg config.Config) error {
+	consulConfig := config.GenerateConfiguration(cfg)
+
+	merged, err := config.MergeExtraConfig(consulConfig, cfg.Consul.Agent.ExtraConfig)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(config.RedactSettings(merged), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	stdout.Println(string(data))
+
+	if consulConfig.BootstrapExpect != nil {
+		stderr.Println("note: bootstrap_expect is left out when the agent starts with raft state in its data dir or a cluster leader is reachable")
+	}
+
+	return nil
+}
+
+// showConfig prints every setting of the effective configuration together
+// with the file, environment variable or default it came from.
+func showConfig(cfg config.Config, provenance config.Provenance) error {
+	settings, err := config.EffectiveSettings(cfg, provenance)
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range settings {
+		stdout.Printf("%s = %s  # %s", setting.Path, setting.Value, setting.Source)
+	}
+
+	return nil
+}
+
+// migrateConfig rewrites each of the config files in the current schema
+// version.
+func migrateConfig(files []string) error {
+	if len(files) == 0 {
+		return errors.New("at least one \"config-file\" must be provided")
+	}
+
+	for _, file := range files {
+		version, warnings, err := config.MigrateFile(file)
+		if err != nil {
+			return err
+		}
+
+		for _, warning := range warnings {
+			stderr.Printf("warning: %s: %s", file, warning)
+		}
+
+		if version == config.CurrentSchemaVersion {
+			stdout.Printf("%s already uses schema_version %d", file, version)
+			continue
+		}
+
+		stdout.Printf("migrated %s from schema_version %d to %d", file, version, config.CurrentSchemaVersion)
+	}
+
+	return nil
+}
+
+// maintenance toggles maintenance mode of the node, or of a single service,
+// on the running agent.
+func maintenance(cfg config.Config, action, serviceID, reason string) error {
+	apiConfig := api.DefaultConfig()
+	apiConfig.Address = cfg.Consul.Agent.HTTPAddress()
+	apiConfig.Token = cfg.Consul.Agent.ACL.ClientToken()
+
+	consulAPIClient, err := api.NewClient(apiConfig)
+	if err != nil {
+		return err
+	}
+
+	logger := lager.NewLogger("confab")
+	logger.RegisterSink(lager.NewWriterSink(os.Stdout, lager.INFO))
+
+	agentClient := agent.Client{
+		ConsulAPIAgent: consulAPIClient.Agent(),
+		Logger:         logger,
+	}
+
+	switch {
+	case action == "enable" && serviceID != "":
+		return agentClient.EnableServiceMaintenance(serviceID, reason)
+	case action == "enable":
+		return agentClient.EnableMaintenance(reason)
+	case serviceID != "":
+		return agentClient.DisableServiceMaintenance(serviceID)
+	default:
+		return agentClient.DisableMaintenance()
+	}
+}
+
+// generateCerts writes a new CA with server and agent key pairs signed by it,
+// for test clusters and development environments.
+func generateCerts(args []string) error {
+	if len(args) == 0 || args[0] != "generate" {
+		return errors.New("usage: confab certs generate -dir DIR [-datacenter DATACENTER] [-domain DOMAIN] [-valid-for-days DAYS]")
+	}
+
+	flagSet := flag.NewFlagSet("certs generate", flag.ContinueOnError)
+	dir := flagSet.String("dir", "", "directory to write the certificates and keys to")
+	datacenter := flagSet.String("datacenter", "dc1", "datacenter the server certificate is valid for")
+	domain := flagSet.String("domain", "consul", "domain the server certificate is valid for")
+	validForDays := flagSet.Int("valid-for-days", 365, "number of days the certificates are valid for")
+
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		return errors.New("\"dir\" cannot be empty")
+	}
+
+	if *validForDays <= 0 {
+		return fmt.Errorf("\"valid-for-days\" must be positive, got %d", *validForDays)
+	}
+
+	bundle, err := certs.Generate(certs.GenerateOptions{
+		Datacenter: *datacenter,
+		Domain:     *domain,
+		ValidFor:   time.Duration(*validForDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := bundle.Write(*dir); err != nil {
+		return err
+	}
+
+	stdout.Printf("wrote ca.crt, server.crt, server.key, agent.crt and agent.key for %s to %s",
+		certs.ServerName(*datacenter, *domain), *dir)
+	return nil
+}
+
+// keygen prints a new random gossip key and its fingerprint.
+func keygen(args []string) error {
+	flagSet := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	size := flagSet.Int("size", keyring.DefaultKeySize, "key size in bytes, one of 16, 24 or 32")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := keyring.Generate(nil, *size)
+	if err != nil {
+		return err
+	}
+
+	stdout.Printf("key:         %s", key)
+	stdout.Printf("fingerprint: %s", keyring.Fingerprint(key))
+	return nil
 }
 
 func printUsageAndExit(message string, flagSet *flag.FlagSet) {
 	stderr.Printf("%s\n\n", message)
 	stderr.Println("usage: confab COMMAND OPTIONS\n")
-	stderr.Println("COMMAND: \"start\" or \"stop\"")
+	stderr.Println("COMMAND: \"start\", \"supervise\", \"stop\", \"render\", \"maint enable|disable\", \"config show|migrate\", \"certs generate\" or \"keygen\"")
 	stderr.Println("\nOPTIONS:")
 	flagSet.PrintDefaults()
 	stderr.Println()
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+type ConfigConsulAgentACL struct {
+	Datacenter      string                                `json:"datacenter"`
+	DefaultPolicy   string                                `json:"default_policy"`
+	DownPolicy      string                                `json:"down_policy"`
+	MasterTokenFile string                                `json:"master_token_file"`
+	AgentTokenFile  string                                `json:"agent_token_file"`
+	Bootstrap       bool                                  `json:"bootstrap"`
+	AgentPolicy     string                                `json:"agent_policy"`
+	ServicePolicies map[string]ConfigConsulAgentACLPolicy `json:"service_policies"`
+
+	MasterToken string `json:"-"`
+	AgentToken  string `json:"-"`
+}
+
+type ConfigConsulAgentACLPolicy struct {
+	Rules     string `json:"rules"`
+	TokenFile string `json:"token_file"`
+
+	Token string `json:"-"`
+}
+
+type ACLPolicy struct {
+	Name  string
+	Token string
+	Rules string
+}
+
+// ClientToken is the token confab presents on its own API and RPC calls.
+func (a ConfigConsulAgentACL) ClientToken() string {
+	if a.MasterToken != "" {
+		return a.MasterToken
+	}
+
+	return a.AgentToken
+}
+
+// Policies returns the agent and service policies to create when
+// bootstrapping ACLs, ordered by name.
+func (a ConfigConsulAgentACL) Policies() []ACLPolicy {
+	policies := []ACLPolicy{}
+	if a.AgentToken != "" && a.AgentPolicy != "" {
+		policies = append(policies, ACLPolicy{
+			Name:  "agent",
+			Token: a.AgentToken,
+			Rules: a.AgentPolicy,
+		})
+	}
+
+	var names []string
+	for name := range a.ServicePolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		policy := a.ServicePolicies[name]
+		if policy.Token == "" {
+			continue
+		}
+
+		policies = append(policies, ACLPolicy{
+			Name:  fmt.Sprintf("service-%s", name),
+			Token: policy.Token,
+			Rules: policy.Rules,
+		})
+	}
+
+	return policies
+}
+
+func LoadACLTokens(cfg Config) (Config, error) {
+	acl := cfg.Consul.Agent.ACL
+
+	var err error
+	acl.MasterToken, err = readACLToken("master_token_file", acl.MasterTokenFile)
+	if err != nil {
+		return Config{}, err
+	}
+
+	acl.AgentToken, err = readACLToken("agent_token_file", acl.AgentTokenFile)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if acl.ServicePolicies != nil {
+		policies := map[string]ConfigConsulAgentACLPolicy{}
+		for name, policy := range acl.ServicePolicies {
+			policy.Token, err = readACLToken(fmt.Sprintf("service_policies.%s.token_file", name), policy.TokenFile)
+			if err != nil {
+				return Config{}, err
+			}
+
+			policies[name] = policy
+		}
+		acl.ServicePolicies = policies
+	}
+
+	if acl.Bootstrap && cfg.Consul.Agent.Mode == "server" && acl.MasterToken == "" {
+		return Config{}, fmt.Errorf("acl bootstrap requires \"master_token_file\" to be provided")
+	}
+
+	cfg.Consul.Agent.ACL = acl
+	return cfg, nil
+}
+
+// readACLToken reads the token from the file or "env:" reference configured
+// for the setting.
+func readACLToken(setting, source string) (string, error) {
+	if source == "" {
+		return "", nil
+	}
+
+	return readSecret("acl token", setting, source)
+}
@@ -0,0 +1,116 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ACL", func() {
+	var tokenDir string
+
+	BeforeEach(func() {
+		var err error
+		tokenDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tokenDir)).To(Succeed())
+	})
+
+	writeToken := func(name, contents string) string {
+		path := filepath.Join(tokenDir, name)
+		Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		return path
+	}
+
+	Describe("LoadACLTokens", func() {
+		It("reads the tokens from their files", func() {
+			cfg := config.Default()
+			cfg.Consul.Agent.ACL = config.ConfigConsulAgentACL{
+				MasterTokenFile: writeToken("master.token", "some-master-token\n"),
+				AgentTokenFile:  writeToken("agent.token", "some-agent-token"),
+				ServicePolicies: map[string]config.ConfigConsulAgentACLPolicy{
+					"some-service": {
+						Rules:     "some-rules",
+						TokenFile: writeToken("some-service.token", "  some-service-token  "),
+					},
+				},
+			}
+
+			loaded, err := config.LoadACLTokens(cfg)
+			Expect(err).NotTo(HaveOccurred())
+
+			acl := loaded.Consul.Agent.ACL
+			Expect(acl.MasterToken).To(Equal("some-master-token"))
+			Expect(acl.AgentToken).To(Equal("some-agent-token"))
+			Expect(acl.ServicePolicies["some-service"].Token).To(Equal("some-service-token"))
+			Expect(acl.ServicePolicies["some-service"].Rules).To(Equal("some-rules"))
+
+			Expect(cfg.Consul.Agent.ACL.ServicePolicies["some-service"].Token).To(BeEmpty())
+		})
+
+		It("leaves the tokens empty when no files are configured", func() {
+			loaded, err := config.LoadACLTokens(config.Default())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(config.Default()))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when a token file cannot be read", func() {
+				cfg := config.Default()
+				cfg.Consul.Agent.ACL.AgentTokenFile = filepath.Join(tokenDir, "missing.token")
+
+				_, err := config.LoadACLTokens(cfg)
+				Expect(err).To(MatchError(ContainSubstring("could not read acl token file")))
+			})
+
+			It("returns an error when bootstrap is enabled on a server without a master token", func() {
+				cfg := config.Default()
+				cfg.Consul.Agent.Mode = "server"
+				cfg.Consul.Agent.ACL.Bootstrap = true
+
+				_, err := config.LoadACLTokens(cfg)
+				Expect(err).To(MatchError(`acl bootstrap requires "master_token_file" to be provided`))
+			})
+		})
+	})
+
+	Describe("ClientToken", func() {
+		It("prefers the master token", func() {
+			acl := config.ConfigConsulAgentACL{MasterToken: "master", AgentToken: "agent"}
+			Expect(acl.ClientToken()).To(Equal("master"))
+		})
+
+		It("falls back to the agent token", func() {
+			acl := config.ConfigConsulAgentACL{AgentToken: "agent"}
+			Expect(acl.ClientToken()).To(Equal("agent"))
+		})
+	})
+
+	Describe("Policies", func() {
+		It("returns the agent policy followed by the service policies ordered by name", func() {
+			acl := config.ConfigConsulAgentACL{
+				AgentToken:  "agent-token",
+				AgentPolicy: "agent-rules",
+				ServicePolicies: map[string]config.ConfigConsulAgentACLPolicy{
+					"zebra":     {Rules: "zebra-rules", Token: "zebra-token"},
+					"apple":     {Rules: "apple-rules", Token: "apple-token"},
+					"tokenless": {Rules: "tokenless-rules"},
+				},
+			}
+
+			Expect(acl.Policies()).To(Equal([]config.ACLPolicy{
+				{Name: "agent", Token: "agent-token", Rules: "agent-rules"},
+				{Name: "service-apple", Token: "apple-token", Rules: "apple-rules"},
+				{Name: "service-zebra", Token: "zebra-token", Rules: "zebra-rules"},
+			}))
+		})
+	})
+})
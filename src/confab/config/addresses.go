@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+const (
+	defaultHTTPPort = 8500
+	defaultRPCPort  = 8400
+)
+
+// InterfaceLister lists the addresses assigned to the host's network
+// interfaces.
+type InterfaceLister interface {
+	InterfaceAddrs() ([]net.Addr, error)
+}
+
+// HostInterfaces lists the addresses of the host confab runs on.
+type HostInterfaces struct{}
+
+func (HostInterfaces) InterfaceAddrs() ([]net.Addr, error) {
+	return net.InterfaceAddrs()
+}
+
+// HTTPAddress is where confab reaches the agent's HTTP API.
+func (a ConfigConsulAgent) HTTPAddress() string {
+	return net.JoinHostPort(dialHost(a.Addresses.HTTP, a.ClientAddr), strconv.Itoa(a.HTTPPort()))
+}
+
+// RPCAddress is where confab reaches the agent's RPC endpoint.
+func (a ConfigConsulAgent) RPCAddress() string {
+	return net.JoinHostPort(dialHost(a.Addresses.RPC, a.ClientAddr), strconv.Itoa(a.RPCPort()))
+}
+
+// HTTPPort is the port of the agent's HTTP API, which extra_config can move
+// through ports.http.
+func (a ConfigConsulAgent) HTTPPort() int {
+	return a.extraConfigPort("http", defaultHTTPPort)
+}
+
+// RPCPort is the port of the agent's RPC endpoint, which extra_config can
+// move through ports.rpc.
+func (a ConfigConsulAgent) RPCPort() int {
+	return a.extraConfigPort("rpc", defaultRPCPort)
+}
+
+// ServesRemoteHTTP reports whether other hosts can reach the agent's HTTP API:
+// it has a port and listens on an address other than loopback, which is
+// consul's default.
+func (a ConfigConsulAgent) ServesRemoteHTTP() bool {
+	if a.HTTPPort() <= 0 {
+		return false
+	}
+
+	address := a.Addresses.HTTP
+	if address == "" {
+		address = a.ClientAddr
+	}
+
+	ip := net.ParseIP(address)
+	return ip != nil && !ip.IsLoopback()
+}
+
+func (a ConfigConsulAgent) extraConfigPort(name string, defaultPort int) int {
+	ports, ok := a.ExtraConfig["ports"].(map[string]interface{})
+	if !ok {
+		return defaultPort
+	}
+
+	switch port := ports[name].(type) {
+	case float64:
+		return int(port)
+	case int:
+		return port
+	}
+
+	return defaultPort
+}
+
+// ValidateAddresses checks that the addresses the agent listens on belong to
+// this host. Advertised addresses are not checked as they are commonly the
+// public side of a NAT.
+func (c Config) ValidateAddresses(lister InterfaceLister) error {
+	addrs, err := lister.InterfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("could not list the host's addresses: %s", err)
+	}
+
+	for _, address := range listenAddresses(c.Consul.Agent) {
+		ip := net.ParseIP(address.value)
+		if ip == nil || ip.IsUnspecified() || ip.IsLoopback() {
+			continue
+		}
+
+		if !hasIP(addrs, ip) {
+			return fmt.Errorf("%q %s is not an address of this host", address.name, address.value)
+		}
+	}
+
+	return nil
+}
+
+type namedAddress struct {
+	name  string
+	value string
+}
+
+func listenAddresses(agent ConfigConsulAgent) []namedAddress {
+	return []namedAddress{
+		{"client_addr", agent.ClientAddr},
+		{"addresses.dns", agent.Addresses.DNS},
+		{"addresses.http", agent.Addresses.HTTP},
+		{"addresses.https", agent.Addresses.HTTPS},
+		{"addresses.rpc", agent.Addresses.RPC},
+	}
+}
+
+func validateAddresses(agent ConfigConsulAgent) error {
+	addresses := append([]namedAddress{
+		{"advertise_addr", agent.AdvertiseAddr},
+		{"advertise_addr_wan", agent.AdvertiseAddrWAN},
+	}, listenAddresses(agent)...)
+
+	for _, address := range addresses {
+		if address.value != "" && net.ParseIP(address.value) == nil {
+			return fmt.Errorf("%q must be an IP address, got %q", address.name, address.value)
+		}
+	}
+
+	return nil
+}
+
+// dialHost picks the first configured address, dialing loopback when the
+// agent listens on every interface or on the default.
+func dialHost(addresses ...string) string {
+	for _, address := range addresses {
+		if address == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(address); ip != nil && ip.IsUnspecified() {
+			break
+		}
+
+		return address
+	}
+
+	return "127.0.0.1"
+}
+
+func hasIP(addrs []net.Addr, ip net.IP) bool {
+	for _, addr := range addrs {
+		var hostIP net.IP
+		switch a := addr.(type) {
+		case *net.IPNet:
+			hostIP = a.IP
+		case *net.IPAddr:
+			hostIP = a.IP
+		}
+
+		if hostIP != nil && hostIP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+package config_test
+
+import (
+	"errors"
+	"net"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Addresses", func() {
+	Describe("HTTPAddress and RPCAddress", func() {
+		It("dials loopback by default", func() {
+			agent := config.ConfigConsulAgent{}
+			Expect(agent.HTTPAddress()).To(Equal("127.0.0.1:8500"))
+			Expect(agent.RPCAddress()).To(Equal("127.0.0.1:8400"))
+		})
+
+		It("dials the client address", func() {
+			agent := config.ConfigConsulAgent{ClientAddr: "10.0.0.5"}
+			Expect(agent.HTTPAddress()).To(Equal("10.0.0.5:8500"))
+			Expect(agent.RPCAddress()).To(Equal("10.0.0.5:8400"))
+		})
+
+		It("prefers the address of the endpoint", func() {
+			agent := config.ConfigConsulAgent{
+				ClientAddr: "10.0.0.5",
+				Addresses: config.ConfigConsulAgentAddresses{
+					HTTP: "fd00::5",
+					RPC:  "127.0.0.1",
+				},
+			}
+			Expect(agent.HTTPAddress()).To(Equal("[fd00::5]:8500"))
+			Expect(agent.RPCAddress()).To(Equal("127.0.0.1:8400"))
+		})
+
+		It("dials loopback when the agent listens on every interface", func() {
+			agent := config.ConfigConsulAgent{ClientAddr: "0.0.0.0"}
+			Expect(agent.HTTPAddress()).To(Equal("127.0.0.1:8500"))
+		})
+
+		It("dials the ports set through extra_config", func() {
+			agent := config.ConfigConsulAgent{
+				ExtraConfig: map[string]interface{}{
+					"ports": map[string]interface{}{
+						"http": float64(8501),
+						"rpc":  8401,
+					},
+				},
+			}
+			Expect(agent.HTTPPort()).To(Equal(8501))
+			Expect(agent.HTTPAddress()).To(Equal("127.0.0.1:8501"))
+			Expect(agent.RPCPort()).To(Equal(8401))
+			Expect(agent.RPCAddress()).To(Equal("127.0.0.1:8401"))
+		})
+	})
+
+	Describe("ServesRemoteHTTP", func() {
+		It("reports whether the http api listens beyond loopback", func() {
+			Expect(config.ConfigConsulAgent{}.ServesRemoteHTTP()).To(BeFalse())
+			Expect(config.ConfigConsulAgent{ClientAddr: "127.0.0.1"}.ServesRemoteHTTP()).To(BeFalse())
+			Expect(config.ConfigConsulAgent{ClientAddr: "0.0.0.0"}.ServesRemoteHTTP()).To(BeTrue())
+			Expect(config.ConfigConsulAgent{ClientAddr: "10.0.0.5"}.ServesRemoteHTTP()).To(BeTrue())
+
+			agent := config.ConfigConsulAgent{
+				ClientAddr: "0.0.0.0",
+				Addresses:  config.ConfigConsulAgentAddresses{HTTP: "127.0.0.1"},
+			}
+			Expect(agent.ServesRemoteHTTP()).To(BeFalse())
+		})
+
+		It("reports false when extra_config disables the http port", func() {
+			agent := config.ConfigConsulAgent{
+				ClientAddr: "0.0.0.0",
+				ExtraConfig: map[string]interface{}{
+					"ports": map[string]interface{}{"http": float64(-1)},
+				},
+			}
+			Expect(agent.ServesRemoteHTTP()).To(BeFalse())
+		})
+	})
+
+	Describe("ValidateAddresses", func() {
+		var (
+			cfg    config.Config
+			lister *fakes.InterfaceLister
+		)
+
+		BeforeEach(func() {
+			cfg = config.Default()
+			cfg.Consul.Agent.AdvertiseAddr = "203.0.113.10"
+			cfg.Consul.Agent.ClientAddr = "10.0.0.5"
+			cfg.Consul.Agent.Addresses.DNS = "0.0.0.0"
+			cfg.Consul.Agent.Addresses.RPC = "127.0.0.1"
+
+			lister = &fakes.InterfaceLister{}
+			lister.InterfaceAddrsCall.Returns.Addrs = []net.Addr{
+				&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+				&net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(24, 32)},
+			}
+		})
+
+		It("accepts addresses of the host, loopback and every interface", func() {
+			Expect(cfg.ValidateAddresses(lister)).To(Succeed())
+		})
+
+		Context("failure cases", func() {
+			It("rejects a listen address that is not on the host", func() {
+				cfg.Consul.Agent.Addresses.HTTP = "10.0.1.5"
+				Expect(cfg.ValidateAddresses(lister)).To(MatchError(`"addresses.http" 10.0.1.5 is not an address of this host`))
+			})
+
+			It("returns an error when the interfaces cannot be listed", func() {
+				lister.InterfaceAddrsCall.Returns.Error = errors.New("no interfaces")
+				Expect(cfg.ValidateAddresses(lister)).To(MatchError("could not list the host's addresses: no interfaces"))
+			})
+		})
+	})
+})
@@ -3,42 +3,135 @@ package config
 import "encoding/json"
 
 type Config struct {
-	Node   ConfigNode
-	Confab ConfigConfab
-	Consul ConfigConsul
-	Path   ConfigPath
+	SchemaVersion int `json:"schema_version"`
+
+	Node   ConfigNode   `json:"node"`
+	Confab ConfigConfab `json:"confab"`
+	Consul ConfigConsul `json:"consul"`
+	Path   ConfigPath   `json:"path"`
 }
 
 type ConfigConfab struct {
-	TimeoutInSeconds int `json:"timeout_in_seconds"`
+	TimeoutInSeconds           int    `json:"timeout_in_seconds"`
+	StatusPort                 int    `json:"status_port"`
+	SuperviseIntervalInSeconds int    `json:"supervise_interval_in_seconds"`
+	CertExpiryWarningDays      []int  `json:"cert_expiry_warning_days"`
+	CertCheckIntervalInSeconds int    `json:"cert_check_interval_in_seconds"`
+	RefuseExpiredCerts         bool   `json:"refuse_expired_certs"`
+	DrainTimeoutInSeconds      int    `json:"drain_timeout_in_seconds"`
+	ServiceReadiness           string `json:"service_readiness"`
+	MinJoinedServers           int    `json:"min_joined_servers"`
 }
 
 type ConfigConsul struct {
-	Agent       ConfigConsulAgent
-	EncryptKeys []string `json:"encrypt_keys"`
+	Agent           ConfigConsulAgent `json:"agent"`
+	EncryptKeys     []string          `json:"encrypt_keys"`
+	EncryptKeysFile string            `json:"encrypt_keys_file"`
+	EncryptStage    string            `json:"encrypt_stage"`
 }
 
+// The stages of turning on gossip encryption in a running cluster. In the
+// accept stage agents have the key but still send and accept plaintext
+// gossip, in the send stage they encrypt what they send but still accept
+// plaintext, and in the enforce stage, the default, they only accept
+// encrypted gossip.
+const (
+	EncryptStageAccept  = "accept"
+	EncryptStageSend    = "send"
+	EncryptStageEnforce = "enforce"
+)
+
 type ConfigPath struct {
 	AgentPath       string `json:"agent_path"`
 	ConsulConfigDir string `json:"consul_config_dir"`
 	PIDFile         string `json:"pid_file"`
 	KeyringFile     string `json:"keyring_file"`
+	CertsDir        string `json:"certs_dir"`
 }
 
 type ConfigNode struct {
 	Name       string `json:"name"`
 	Index      int    `json:"index"`
 	ExternalIP string `json:"external_ip"`
+	AZ         string `json:"az"`
+	Deployment string `json:"deployment"`
+	ID         string `json:"id"`
+
+	NameTemplate string            `json:"name_template"`
+	Meta         map[string]string `json:"meta"`
+	InstanceMeta bool              `json:"instance_meta"`
 }
 
 type ConfigConsulAgent struct {
 	Servers         ConfigConsulAgentServers     `json:"servers"`
 	Services        map[string]ServiceDefinition `json:"services"`
 	Mode            string                       `json:"mode"`
+	BootstrapExpect int                          `json:"bootstrap_expect"`
 	Domain          string                       `json:"domain"`
 	Datacenter      string                       `json:"datacenter"`
 	LogLevel        string                       `json:"log_level"`
 	ProtocolVersion int                          `json:"protocol_version"`
+	ACL             ConfigConsulAgentACL         `json:"acl"`
+	Telemetry       ConfigConsulAgentTelemetry   `json:"telemetry"`
+	TLS             ConfigConsulAgentTLS         `json:"tls"`
+
+	AdvertiseAddr    string                     `json:"advertise_addr"`
+	AdvertiseAddrWAN string                     `json:"advertise_addr_wan"`
+	ClientAddr       string                     `json:"client_addr"`
+	Addresses        ConfigConsulAgentAddresses `json:"addresses"`
+
+	DNSConfig       ConfigConsulAgentDNSConfig `json:"dns_config"`
+	RecursorTimeout string                     `json:"recursor_timeout"`
+
+	Performance          ConfigConsulAgentPerformance `json:"performance"`
+	Autopilot            ConfigConsulAgentAutopilot   `json:"autopilot"`
+	LeaveOnTerminate     *bool                        `json:"leave_on_terminate"`
+	SkipLeaveOnInterrupt *bool                        `json:"skip_leave_on_interrupt"`
+
+	ExtraConfig map[string]interface{} `json:"extra_config"`
+}
+
+type ConfigConsulAgentPerformance struct {
+	RaftMultiplier int `json:"raft_multiplier"`
+}
+
+type ConfigConsulAgentAutopilot struct {
+	CleanupDeadServers      *bool  `json:"cleanup_dead_servers"`
+	LastContactThreshold    string `json:"last_contact_threshold"`
+	ServerStabilizationTime string `json:"server_stabilization_time"`
+}
+
+// ConfigConsulAgentTLS leaves TLS enabled and every verification on unless
+// they are explicitly turned off.
+type ConfigConsulAgentTLS struct {
+	Enabled              *bool    `json:"enabled"`
+	VerifyIncoming       *bool    `json:"verify_incoming"`
+	VerifyOutgoing       *bool    `json:"verify_outgoing"`
+	VerifyServerHostname *bool    `json:"verify_server_hostname"`
+	MinVersion           string   `json:"min_version"`
+	CipherSuites         []string `json:"cipher_suites"`
+	HTTPSPort            int      `json:"https_port"`
+}
+
+func (t ConfigConsulAgentTLS) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+type ConfigConsulAgentAddresses struct {
+	DNS   string `json:"dns"`
+	HTTP  string `json:"http"`
+	HTTPS string `json:"https"`
+	RPC   string `json:"rpc"`
+}
+
+type ConfigConsulAgentDNSConfig struct {
+	AllowStale     *bool             `json:"allow_stale"`
+	MaxStale       string            `json:"max_stale"`
+	NodeTTL        string            `json:"node_ttl"`
+	ServiceTTL     map[string]string `json:"service_ttl"`
+	EnableTruncate *bool             `json:"enable_truncate"`
+	OnlyPassing    *bool             `json:"only_passing"`
+	UDPAnswerLimit int               `json:"udp_answer_limit"`
 }
 
 type ConfigConsulAgentServers struct {
@@ -46,13 +139,35 @@ type ConfigConsulAgentServers struct {
 	WAN []string `json:"wan"`
 }
 
+type ConfigConsulAgentTelemetry struct {
+	StatsdAddress    string   `json:"statsd_address"`
+	StatsiteAddress  string   `json:"statsite_address"`
+	StatsitePrefix   string   `json:"statsite_prefix"`
+	DogstatsdAddress string   `json:"dogstatsd_addr"`
+	DogstatsdTags    []string `json:"dogstatsd_tags"`
+	ConfabPrefix     string   `json:"confab_prefix"`
+}
+
+// The service readiness levels a client waits for before its start succeeds:
+// none, every defined service registered with the agent, or registered with
+// all of its checks passing.
+const (
+	ServiceReadinessNone       = "none"
+	ServiceReadinessRegistered = "registered"
+	ServiceReadinessPassing    = "passing"
+)
+
+const DefaultCertsDir = "/var/vcap/jobs/consul_agent/config/certs"
+
 func Default() Config {
 	return Config{
+		SchemaVersion: CurrentSchemaVersion,
 		Path: ConfigPath{
 			AgentPath:       "/var/vcap/packages/consul/bin/consul",
 			ConsulConfigDir: "/var/vcap/jobs/consul_agent/config",
 			PIDFile:         "/var/vcap/sys/run/consul_agent/consul_agent.pid",
 			KeyringFile:     "/var/vcap/store/consul_agent/serf/local.keyring",
+			CertsDir:        DefaultCertsDir,
 		},
 		Consul: ConfigConsul{
 			Agent: ConfigConsulAgent{
@@ -61,9 +176,17 @@ func Default() Config {
 					WAN: []string{},
 				},
 			},
+			EncryptStage: EncryptStageEnforce,
 		},
 		Confab: ConfigConfab{
-			TimeoutInSeconds: 55,
+			TimeoutInSeconds:           55,
+			SuperviseIntervalInSeconds: 10,
+			CertExpiryWarningDays:      []int{30, 7},
+			CertCheckIntervalInSeconds: 3600,
+			RefuseExpiredCerts:         true,
+			DrainTimeoutInSeconds:      10,
+			ServiceReadiness:           ServiceReadinessNone,
+			MinJoinedServers:           1,
 		},
 	}
 }
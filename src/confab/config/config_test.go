@@ -11,6 +11,7 @@ var _ = Describe("Config", func() {
 	Describe("Default", func() {
 		It("returns a default configuration", func() {
 			Expect(config.Default()).To(Equal(config.Config{
+				SchemaVersion: 2,
 				Consul: config.ConfigConsul{
 					Agent: config.ConfigConsulAgent{
 						Servers: config.ConfigConsulAgentServers{
@@ -18,15 +19,24 @@ var _ = Describe("Config", func() {
 							WAN: []string{},
 						},
 					},
+					EncryptStage: "enforce",
 				},
 				Path: config.ConfigPath{
 					AgentPath:       "/var/vcap/packages/consul/bin/consul",
 					ConsulConfigDir: "/var/vcap/jobs/consul_agent/config",
 					PIDFile:         "/var/vcap/sys/run/consul_agent/consul_agent.pid",
 					KeyringFile:     "/var/vcap/store/consul_agent/serf/local.keyring",
+					CertsDir:        "/var/vcap/jobs/consul_agent/config/certs",
 				},
 				Confab: config.ConfigConfab{
-					TimeoutInSeconds: 55,
+					TimeoutInSeconds:           55,
+					SuperviseIntervalInSeconds: 10,
+					CertExpiryWarningDays:      []int{30, 7},
+					CertCheckIntervalInSeconds: 3600,
+					RefuseExpiredCerts:         true,
+					DrainTimeoutInSeconds:      10,
+					ServiceReadiness:           "none",
+					MinJoinedServers:           1,
 				},
 			}))
 		})
@@ -38,13 +48,20 @@ var _ = Describe("Config", func() {
 				"node": {
 					"name": "nodename",
 					"index": 1234,
-					"external_ip": "10.0.0.1"
+					"external_ip": "10.0.0.1",
+					"az": "z1",
+					"deployment": "cf",
+					"id": "some-instance-id",
+					"name_template": "{{.Deployment}}-{{.Name}}-{{.Index}}",
+					"meta": {"rack": "r12"},
+					"instance_meta": true
 				},
 				"path": {
 					"agent_path": "/path/to/agent",
 					"consul_config_dir": "/consul/config/dir",
 					"pid_file": "/path/to/pidfile",
-					"keyring_file": "/path/to/keyring"
+					"keyring_file": "/path/to/keyring",
+					"certs_dir": "/path/to/certs"
 				},
 				"consul": {
 					"agent": {
@@ -54,34 +71,107 @@ var _ = Describe("Config", func() {
 							}
 						},
 						"mode": "server",
+						"bootstrap_expect": 3,
 						"datacenter": "dc1",
 						"log_level": "debug",
 						"protocol_version": 1,
 						"servers": {
 							"lan": ["server1", "server2", "server3"],
 							"wan": ["wan-server1", "wan-server2", "wan-server3"]
+						},
+						"acl": {
+							"datacenter": "dc1",
+							"default_policy": "deny",
+							"down_policy": "extend-cache",
+							"master_token_file": "/path/to/master.token",
+							"agent_token_file": "/path/to/agent.token",
+							"bootstrap": true,
+							"agent_policy": "node \"\" { policy = \"write\" }",
+							"service_policies": {
+								"myservice": {
+									"rules": "service \"myservicename\" { policy = \"write\" }",
+									"token_file": "/path/to/myservice.token"
+								}
+							}
+						},
+						"performance": {
+							"raft_multiplier": 3
+						},
+						"autopilot": {
+							"cleanup_dead_servers": false,
+							"last_contact_threshold": "400ms",
+							"server_stabilization_time": "20s"
+						},
+						"tls": {
+							"enabled": true,
+							"verify_incoming": false,
+							"verify_outgoing": true,
+							"verify_server_hostname": false,
+							"min_version": "tls12",
+							"cipher_suites": ["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"],
+							"https_port": 8501
+						},
+						"dns_config": {
+							"allow_stale": true,
+							"max_stale": "5s",
+							"node_ttl": "10s",
+							"service_ttl": {"*": "5s"},
+							"enable_truncate": true,
+							"only_passing": true,
+							"udp_answer_limit": 6
+						},
+						"recursor_timeout": "2s",
+						"advertise_addr": "203.0.113.10",
+						"advertise_addr_wan": "203.0.113.11",
+						"client_addr": "10.0.0.5",
+						"addresses": {"dns": "0.0.0.0", "http": "10.0.0.6", "https": "10.0.0.7", "rpc": "127.0.0.1"},
+						"leave_on_terminate": true,
+						"skip_leave_on_interrupt": true,
+						"extra_config": {
+							"ui": true,
+							"ports": {"http": 8501}
 						}
 					},
-					"encrypt_keys": ["key-1", "key-2"]
+					"encrypt_keys": ["key-1", "key-2"],
+					"encrypt_stage": "send"
 				},
 				"confab": {
-					"timeout_in_seconds": 30
+					"timeout_in_seconds": 30,
+					"status_port": 8512,
+					"supervise_interval_in_seconds": 5,
+					"cert_expiry_warning_days": [14, 3],
+					"cert_check_interval_in_seconds": 600,
+					"refuse_expired_certs": false,
+					"drain_timeout_in_seconds": 20,
+					"service_readiness": "passing",
+					"min_joined_servers": 2
 				}
 			}`)
 
 			cfg, err := config.ConfigFromJSON(json)
 			Expect(err).NotTo(HaveOccurred())
+
+			trueValue, falseValue := true, false
 			Expect(cfg).To(Equal(config.Config{
+				SchemaVersion: 2,
 				Path: config.ConfigPath{
 					AgentPath:       "/path/to/agent",
 					ConsulConfigDir: "/consul/config/dir",
 					PIDFile:         "/path/to/pidfile",
 					KeyringFile:     "/path/to/keyring",
+					CertsDir:        "/path/to/certs",
 				},
 				Node: config.ConfigNode{
 					Name:       "nodename",
 					Index:      1234,
 					ExternalIP: "10.0.0.1",
+					AZ:         "z1",
+					Deployment: "cf",
+					ID:         "some-instance-id",
+
+					NameTemplate: "{{.Deployment}}-{{.Name}}-{{.Index}}",
+					Meta:         map[string]string{"rack": "r12"},
+					InstanceMeta: true,
 				},
 				Consul: config.ConfigConsul{
 					Agent: config.ConfigConsulAgent{
@@ -91,6 +181,7 @@ var _ = Describe("Config", func() {
 							},
 						},
 						Mode:            "server",
+						BootstrapExpect: 3,
 						Datacenter:      "dc1",
 						LogLevel:        "debug",
 						ProtocolVersion: 1,
@@ -98,11 +189,79 @@ var _ = Describe("Config", func() {
 							LAN: []string{"server1", "server2", "server3"},
 							WAN: []string{"wan-server1", "wan-server2", "wan-server3"},
 						},
+						ACL: config.ConfigConsulAgentACL{
+							Datacenter:      "dc1",
+							DefaultPolicy:   "deny",
+							DownPolicy:      "extend-cache",
+							MasterTokenFile: "/path/to/master.token",
+							AgentTokenFile:  "/path/to/agent.token",
+							Bootstrap:       true,
+							AgentPolicy:     `node "" { policy = "write" }`,
+							ServicePolicies: map[string]config.ConfigConsulAgentACLPolicy{
+								"myservice": {
+									Rules:     `service "myservicename" { policy = "write" }`,
+									TokenFile: "/path/to/myservice.token",
+								},
+							},
+						},
+						Performance: config.ConfigConsulAgentPerformance{
+							RaftMultiplier: 3,
+						},
+						Autopilot: config.ConfigConsulAgentAutopilot{
+							CleanupDeadServers:      &falseValue,
+							LastContactThreshold:    "400ms",
+							ServerStabilizationTime: "20s",
+						},
+						TLS: config.ConfigConsulAgentTLS{
+							Enabled:              &trueValue,
+							VerifyIncoming:       &falseValue,
+							VerifyOutgoing:       &trueValue,
+							VerifyServerHostname: &falseValue,
+							MinVersion:           "tls12",
+							CipherSuites:         []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+							HTTPSPort:            8501,
+						},
+						DNSConfig: config.ConfigConsulAgentDNSConfig{
+							AllowStale:     &trueValue,
+							MaxStale:       "5s",
+							NodeTTL:        "10s",
+							ServiceTTL:     map[string]string{"*": "5s"},
+							EnableTruncate: &trueValue,
+							OnlyPassing:    &trueValue,
+							UDPAnswerLimit: 6,
+						},
+						RecursorTimeout:  "2s",
+						AdvertiseAddr:    "203.0.113.10",
+						AdvertiseAddrWAN: "203.0.113.11",
+						ClientAddr:       "10.0.0.5",
+						Addresses: config.ConfigConsulAgentAddresses{
+							DNS:   "0.0.0.0",
+							HTTP:  "10.0.0.6",
+							HTTPS: "10.0.0.7",
+							RPC:   "127.0.0.1",
+						},
+						LeaveOnTerminate:     &trueValue,
+						SkipLeaveOnInterrupt: &trueValue,
+						ExtraConfig: map[string]interface{}{
+							"ui": true,
+							"ports": map[string]interface{}{
+								"http": float64(8501),
+							},
+						},
 					},
-					EncryptKeys: []string{"key-1", "key-2"},
+					EncryptKeys:  []string{"key-1", "key-2"},
+					EncryptStage: "send",
 				},
 				Confab: config.ConfigConfab{
-					TimeoutInSeconds: 30,
+					TimeoutInSeconds:           30,
+					StatusPort:                 8512,
+					SuperviseIntervalInSeconds: 5,
+					CertExpiryWarningDays:      []int{14, 3},
+					CertCheckIntervalInSeconds: 600,
+					RefuseExpiredCerts:         false,
+					DrainTimeoutInSeconds:      20,
+					ServiceReadiness:           "passing",
+					MinJoinedServers:           2,
 				},
 			}))
 		})
@@ -112,11 +271,13 @@ var _ = Describe("Config", func() {
 			cfg, err := config.ConfigFromJSON(json)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(cfg).To(Equal(config.Config{
+				SchemaVersion: 2,
 				Path: config.ConfigPath{
 					AgentPath:       "/var/vcap/packages/consul/bin/consul",
 					ConsulConfigDir: "/var/vcap/jobs/consul_agent/config",
 					PIDFile:         "/var/vcap/sys/run/consul_agent/consul_agent.pid",
 					KeyringFile:     "/var/vcap/store/consul_agent/serf/local.keyring",
+					CertsDir:        "/var/vcap/jobs/consul_agent/config/certs",
 				},
 				Consul: config.ConfigConsul{
 					Agent: config.ConfigConsulAgent{
@@ -125,9 +286,17 @@ var _ = Describe("Config", func() {
 							WAN: []string{},
 						},
 					},
+					EncryptStage: "enforce",
 				},
 				Confab: config.ConfigConfab{
-					TimeoutInSeconds: 55,
+					TimeoutInSeconds:           55,
+					SuperviseIntervalInSeconds: 10,
+					CertExpiryWarningDays:      []int{30, 7},
+					CertCheckIntervalInSeconds: 3600,
+					RefuseExpiredCerts:         true,
+					DrainTimeoutInSeconds:      10,
+					ServiceReadiness:           "none",
+					MinJoinedServers:           1,
 				},
 			}))
 		})
@@ -1,42 +1,95 @@
 package config
 
 import (
-	"crypto/sha1"
-	"encoding/base64"
 	"fmt"
 	"path/filepath"
 	"strings"
 
-	"golang.org/x/crypto/pbkdf2"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/keyring"
 )
 
 type ConsulConfig struct {
-	Server               bool              `json:"server"`
-	Domain               string            `json:"domain"`
-	Datacenter           string            `json:"datacenter"`
-	DataDir              string            `json:"data_dir"`
-	LogLevel             string            `json:"log_level"`
-	NodeName             string            `json:"node_name"`
-	Ports                ConsulConfigPorts `json:"ports"`
-	RejoinAfterLeave     bool              `json:"rejoin_after_leave"`
-	RetryJoin            []string          `json:"retry_join"`
-	RetryJoinWAN         []string          `json:"retry_join_wan"`
-	BindAddr             string            `json:"bind_addr"`
-	DisableRemoteExec    bool              `json:"disable_remote_exec"`
-	DisableUpdateCheck   bool              `json:"disable_update_check"`
-	Protocol             int               `json:"protocol"`
-	VerifyOutgoing       *bool             `json:"verify_outgoing,omitempty"`
-	VerifyIncoming       *bool             `json:"verify_incoming,omitempty"`
-	VerifyServerHostname *bool             `json:"verify_server_hostname,omitempty"`
-	CAFile               *string           `json:"ca_file,omitempty"`
-	KeyFile              *string           `json:"key_file,omitempty"`
-	CertFile             *string           `json:"cert_file,omitempty"`
-	Encrypt              *string           `json:"encrypt,omitempty"`
-	BootstrapExpect      *int              `json:"bootstrap_expect,omitempty"`
+	Server                bool                     `json:"server"`
+	Domain                string                   `json:"domain"`
+	Datacenter            string                   `json:"datacenter"`
+	DataDir               string                   `json:"data_dir"`
+	LogLevel              string                   `json:"log_level"`
+	NodeName              string                   `json:"node_name"`
+	NodeMeta              map[string]string        `json:"node_meta,omitempty"`
+	Ports                 ConsulConfigPorts        `json:"ports"`
+	RejoinAfterLeave      bool                     `json:"rejoin_after_leave"`
+	RetryJoin             []string                 `json:"retry_join"`
+	RetryJoinWAN          []string                 `json:"retry_join_wan"`
+	BindAddr              string                   `json:"bind_addr"`
+	AdvertiseAddr         *string                  `json:"advertise_addr,omitempty"`
+	AdvertiseAddrWAN      *string                  `json:"advertise_addr_wan,omitempty"`
+	ClientAddr            *string                  `json:"client_addr,omitempty"`
+	Addresses             *ConsulConfigAddresses   `json:"addresses,omitempty"`
+	DNSConfig             *ConsulConfigDNSConfig   `json:"dns_config,omitempty"`
+	RecursorTimeout       *string                  `json:"recursor_timeout,omitempty"`
+	DisableRemoteExec     bool                     `json:"disable_remote_exec"`
+	DisableUpdateCheck    bool                     `json:"disable_update_check"`
+	Protocol              int                      `json:"protocol"`
+	VerifyOutgoing        *bool                    `json:"verify_outgoing,omitempty"`
+	VerifyIncoming        *bool                    `json:"verify_incoming,omitempty"`
+	VerifyServerHostname  *bool                    `json:"verify_server_hostname,omitempty"`
+	CAFile                *string                  `json:"ca_file,omitempty"`
+	KeyFile               *string                  `json:"key_file,omitempty"`
+	CertFile              *string                  `json:"cert_file,omitempty"`
+	TLSMinVersion         *string                  `json:"tls_min_version,omitempty"`
+	TLSCipherSuites       *string                  `json:"tls_cipher_suites,omitempty"`
+	Encrypt               *string                  `json:"encrypt,omitempty"`
+	EncryptVerifyIncoming *bool                    `json:"encrypt_verify_incoming,omitempty"`
+	EncryptVerifyOutgoing *bool                    `json:"encrypt_verify_outgoing,omitempty"`
+	BootstrapExpect       *int                     `json:"bootstrap_expect,omitempty"`
+	ACLDatacenter         *string                  `json:"acl_datacenter,omitempty"`
+	ACLMasterToken        *string                  `json:"acl_master_token,omitempty"`
+	ACLAgentToken         *string                  `json:"acl_agent_token,omitempty"`
+	ACLDefaultPolicy      *string                  `json:"acl_default_policy,omitempty"`
+	ACLDownPolicy         *string                  `json:"acl_down_policy,omitempty"`
+	StatsdAddr            *string                  `json:"statsd_addr,omitempty"`
+	StatsiteAddr          *string                  `json:"statsite_addr,omitempty"`
+	StatsitePrefix        *string                  `json:"statsite_prefix,omitempty"`
+	DogstatsdAddr         *string                  `json:"dogstatsd_addr,omitempty"`
+	DogstatsdTags         []string                 `json:"dogstatsd_tags,omitempty"`
+	LeaveOnTerminate      *bool                    `json:"leave_on_terminate,omitempty"`
+	SkipLeaveOnInterrupt  *bool                    `json:"skip_leave_on_interrupt,omitempty"`
+	Performance           *ConsulConfigPerformance `json:"performance,omitempty"`
+	Autopilot             *ConsulConfigAutopilot   `json:"autopilot,omitempty"`
+}
+
+type ConsulConfigPerformance struct {
+	RaftMultiplier int `json:"raft_multiplier"`
+}
+
+type ConsulConfigAutopilot struct {
+	CleanupDeadServers      *bool   `json:"cleanup_dead_servers,omitempty"`
+	LastContactThreshold    *string `json:"last_contact_threshold,omitempty"`
+	ServerStabilizationTime *string `json:"server_stabilization_time,omitempty"`
+}
+
+const redacted = "[redacted]"
+
+type ConsulConfigAddresses struct {
+	DNS   string `json:"dns,omitempty"`
+	HTTP  string `json:"http,omitempty"`
+	HTTPS string `json:"https,omitempty"`
+	RPC   string `json:"rpc,omitempty"`
+}
+
+type ConsulConfigDNSConfig struct {
+	AllowStale     *bool             `json:"allow_stale,omitempty"`
+	MaxStale       *string           `json:"max_stale,omitempty"`
+	NodeTTL        *string           `json:"node_ttl,omitempty"`
+	ServiceTTL     map[string]string `json:"service_ttl,omitempty"`
+	EnableTruncate *bool             `json:"enable_truncate,omitempty"`
+	OnlyPassing    *bool             `json:"only_passing,omitempty"`
+	UDPAnswerLimit *int              `json:"udp_answer_limit,omitempty"`
 }
 
 type ConsulConfigPorts struct {
-	DNS int `json:"dns"`
+	DNS   int `json:"dns"`
+	HTTPS int `json:"https,omitempty"`
 }
 
 func GenerateConfiguration(config Config) ConsulConfig {
@@ -50,8 +103,10 @@ func GenerateConfiguration(config Config) ConsulConfig {
 		wan = []string{}
 	}
 
-	nodeName := strings.Replace(config.Node.Name, "_", "-", -1)
-	nodeName = fmt.Sprintf("%s-%d", nodeName, config.Node.Index)
+	nodeName, err := NodeName(config.Node)
+	if err != nil {
+		nodeName = fmt.Sprintf("%s-%d", strings.Replace(config.Node.Name, "_", "-", -1), config.Node.Index)
+	}
 
 	isServer := config.Consul.Agent.Mode == "server"
 
@@ -74,39 +129,187 @@ func GenerateConfiguration(config Config) ConsulConfig {
 		Protocol:           config.Consul.Agent.ProtocolVersion,
 	}
 
-	consulConfig.VerifyOutgoing = boolPtr(true)
-	consulConfig.VerifyIncoming = boolPtr(true)
-	consulConfig.VerifyServerHostname = boolPtr(true)
-	certsDir := "/var/vcap/jobs/consul_agent/config/certs"
-	consulConfig.CAFile = strPtr(filepath.Join(certsDir, "ca.crt"))
+	agent := config.Consul.Agent
+	if agent.AdvertiseAddr != "" {
+		consulConfig.AdvertiseAddr = strPtr(agent.AdvertiseAddr)
+	}
 
-	if isServer {
-		consulConfig.KeyFile = strPtr(filepath.Join(certsDir, "server.key"))
-		consulConfig.CertFile = strPtr(filepath.Join(certsDir, "server.crt"))
-	} else {
-		consulConfig.KeyFile = strPtr(filepath.Join(certsDir, "agent.key"))
-		consulConfig.CertFile = strPtr(filepath.Join(certsDir, "agent.crt"))
+	if agent.AdvertiseAddrWAN != "" {
+		consulConfig.AdvertiseAddrWAN = strPtr(agent.AdvertiseAddrWAN)
+	}
+
+	if agent.ClientAddr != "" {
+		consulConfig.ClientAddr = strPtr(agent.ClientAddr)
+	}
+
+	if agent.Addresses != (ConfigConsulAgentAddresses{}) {
+		consulConfig.Addresses = &ConsulConfigAddresses{
+			DNS:   agent.Addresses.DNS,
+			HTTP:  agent.Addresses.HTTP,
+			HTTPS: agent.Addresses.HTTPS,
+			RPC:   agent.Addresses.RPC,
+		}
+	}
+
+	consulConfig.DNSConfig = ConsulDNSConfig(agent.DNSConfig)
+
+	if agent.RecursorTimeout != "" {
+		consulConfig.RecursorTimeout = strPtr(agent.RecursorTimeout)
+	}
+
+	tls := config.Consul.Agent.TLS
+	if tls.IsEnabled() {
+		consulConfig.VerifyOutgoing = boolPtr(tls.VerifyOutgoing == nil || *tls.VerifyOutgoing)
+		consulConfig.VerifyIncoming = boolPtr(tls.VerifyIncoming == nil || *tls.VerifyIncoming)
+		consulConfig.VerifyServerHostname = boolPtr(tls.VerifyServerHostname == nil || *tls.VerifyServerHostname)
+
+		certsDir := certsDir(config)
+		consulConfig.CAFile = strPtr(filepath.Join(certsDir, "ca.crt"))
+
+		if isServer {
+			consulConfig.KeyFile = strPtr(filepath.Join(certsDir, "server.key"))
+			consulConfig.CertFile = strPtr(filepath.Join(certsDir, "server.crt"))
+		} else {
+			consulConfig.KeyFile = strPtr(filepath.Join(certsDir, "agent.key"))
+			consulConfig.CertFile = strPtr(filepath.Join(certsDir, "agent.crt"))
+		}
+
+		if tls.MinVersion != "" {
+			consulConfig.TLSMinVersion = strPtr(tls.MinVersion)
+		}
+
+		if len(tls.CipherSuites) > 0 {
+			consulConfig.TLSCipherSuites = strPtr(strings.Join(tls.CipherSuites, ","))
+		}
+
+		consulConfig.Ports.HTTPS = tls.HTTPSPort
+	}
+
+	if meta := NodeMeta(config.Node); len(meta) > 0 {
+		consulConfig.NodeMeta = meta
 	}
 
 	if len(config.Consul.EncryptKeys) > 0 {
-		consulConfig.Encrypt = encryptKey(config.Consul.EncryptKeys[0])
+		consulConfig.Encrypt = strPtr(keyring.Key(config.Consul.EncryptKeys[0]))
+
+		switch config.Consul.EncryptStage {
+		case EncryptStageAccept:
+			consulConfig.EncryptVerifyIncoming = boolPtr(false)
+			consulConfig.EncryptVerifyOutgoing = boolPtr(false)
+		case EncryptStageSend:
+			consulConfig.EncryptVerifyIncoming = boolPtr(false)
+			consulConfig.EncryptVerifyOutgoing = boolPtr(true)
+		}
 	}
 
 	if isServer {
-		consulConfig.BootstrapExpect = intPtr(len(config.Consul.Agent.Servers.LAN))
+		expect := config.Consul.Agent.BootstrapExpect
+		if expect == 0 {
+			expect = len(config.Consul.Agent.Servers.LAN)
+		}
+		consulConfig.BootstrapExpect = intPtr(expect)
+	}
+
+	acl := config.Consul.Agent.ACL
+	if acl.Datacenter != "" {
+		consulConfig.ACLDatacenter = strPtr(acl.Datacenter)
+	}
+
+	if acl.DefaultPolicy != "" {
+		consulConfig.ACLDefaultPolicy = strPtr(acl.DefaultPolicy)
+	}
+
+	if acl.DownPolicy != "" {
+		consulConfig.ACLDownPolicy = strPtr(acl.DownPolicy)
+	}
+
+	if isServer && acl.MasterToken != "" {
+		consulConfig.ACLMasterToken = strPtr(acl.MasterToken)
+	}
+
+	if acl.AgentToken != "" {
+		consulConfig.ACLAgentToken = strPtr(acl.AgentToken)
+	}
+
+	telemetry := config.Consul.Agent.Telemetry
+	if telemetry.StatsdAddress != "" {
+		consulConfig.StatsdAddr = strPtr(telemetry.StatsdAddress)
+	}
+
+	if telemetry.StatsiteAddress != "" {
+		consulConfig.StatsiteAddr = strPtr(telemetry.StatsiteAddress)
+	}
+
+	if telemetry.StatsitePrefix != "" {
+		consulConfig.StatsitePrefix = strPtr(telemetry.StatsitePrefix)
+	}
+
+	if telemetry.DogstatsdAddress != "" {
+		consulConfig.DogstatsdAddr = strPtr(telemetry.DogstatsdAddress)
+		consulConfig.DogstatsdTags = telemetry.DogstatsdTags
+	}
+
+	consulConfig.LeaveOnTerminate = config.Consul.Agent.LeaveOnTerminate
+	consulConfig.SkipLeaveOnInterrupt = config.Consul.Agent.SkipLeaveOnInterrupt
+
+	if multiplier := config.Consul.Agent.Performance.RaftMultiplier; multiplier != 0 {
+		consulConfig.Performance = &ConsulConfigPerformance{
+			RaftMultiplier: multiplier,
+		}
+	}
+
+	autopilot := config.Consul.Agent.Autopilot
+	if isServer && autopilot != (ConfigConsulAgentAutopilot{}) {
+		consulConfig.Autopilot = &ConsulConfigAutopilot{
+			CleanupDeadServers: autopilot.CleanupDeadServers,
+		}
+
+		if autopilot.LastContactThreshold != "" {
+			consulConfig.Autopilot.LastContactThreshold = strPtr(autopilot.LastContactThreshold)
+		}
+
+		if autopilot.ServerStabilizationTime != "" {
+			consulConfig.Autopilot.ServerStabilizationTime = strPtr(autopilot.ServerStabilizationTime)
+		}
 	}
 
 	return consulConfig
 }
 
-func encryptKey(key string) *string {
-	decodedKey, err := base64.StdEncoding.DecodeString(key)
+// TLSCertFiles returns the CA certificate and the server and agent
+// certificates in the certs dir. The job gives every node all of them.
+func TLSCertFiles(config Config) (string, []string) {
+	certsDir := certsDir(config)
+
+	return filepath.Join(certsDir, "ca.crt"), []string{
+		filepath.Join(certsDir, "server.crt"),
+		filepath.Join(certsDir, "agent.crt"),
+	}
+}
+
+func certsDir(config Config) string {
+	if config.Path.CertsDir == "" {
+		return DefaultCertsDir
+	}
+
+	return config.Path.CertsDir
+}
+
+// Redacted returns a copy of the configuration that is safe to log.
+func (c ConsulConfig) Redacted() ConsulConfig {
+	if c.ACLMasterToken != nil {
+		c.ACLMasterToken = strPtr(redacted)
+	}
+
+	if c.ACLAgentToken != nil {
+		c.ACLAgentToken = strPtr(redacted)
+	}
 
-	if err != nil || len(decodedKey) != 16 {
-		return strPtr(base64.StdEncoding.EncodeToString(pbkdf2.Key([]byte(key), []byte(""), 20000, 16, sha1.New)))
-	} else {
-		return strPtr(key)
+	if c.Encrypt != nil {
+		c.Encrypt = strPtr(redacted)
 	}
+
+	return c
 }
 
 func intPtr(i int) *int {
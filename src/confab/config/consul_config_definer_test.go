@@ -1,6 +1,8 @@
 package config_test
 
 import (
+	"encoding/json"
+
 	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
 
 	. "github.com/onsi/ginkgo"
@@ -48,6 +50,147 @@ var _ = Describe("ConsulConfigDefiner", func() {
 			})
 		})
 
+		Describe("node_name", func() {
+			It("is the node's name and index", func() {
+				consulConfig = config.GenerateConfiguration(config.Config{
+					Node: config.ConfigNode{Name: "consul_server", Index: 1},
+				})
+				Expect(consulConfig.NodeName).To(Equal("consul-server-1"))
+			})
+
+			Context("when `consul.agent.node_name_template` is set", func() {
+				It("renders that template", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Node: config.ConfigNode{
+							Name:         "consul_server",
+							Index:        1,
+							AZ:           "z2",
+							NameTemplate: "{{.Name}}-{{.AZ}}-{{.Index}}",
+						},
+					})
+					Expect(consulConfig.NodeName).To(Equal("consul-server-z2-1"))
+				})
+			})
+		})
+
+		Describe("node_meta", func() {
+			It("is omitted by default", func() {
+				Expect(consulConfig.NodeMeta).To(BeNil())
+			})
+
+			Context("when node metadata is configured", func() {
+				It("uses that metadata", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Node: config.ConfigNode{
+							Deployment:   "cf",
+							InstanceMeta: true,
+							Meta:         map[string]string{"rack": "r12"},
+						},
+					})
+					Expect(consulConfig.NodeMeta).To(Equal(map[string]string{
+						"deployment": "cf",
+						"rack":       "r12",
+					}))
+				})
+			})
+		})
+
+		Describe("dns_config", func() {
+			It("leaves the DNS settings to consul", func() {
+				Expect(consulConfig.DNSConfig).To(BeNil())
+				Expect(consulConfig.RecursorTimeout).To(BeNil())
+			})
+
+			Context("when the DNS settings are configured", func() {
+				It("uses those values", func() {
+					trueValue := true
+					falseValue := false
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								DNSConfig: config.ConfigConsulAgentDNSConfig{
+									AllowStale: &trueValue,
+									MaxStale:   "5s",
+									NodeTTL:    "10s",
+									ServiceTTL: map[string]string{
+										"*":   "5s",
+										"uaa": "30s",
+									},
+									EnableTruncate: &falseValue,
+									OnlyPassing:    &trueValue,
+									UDPAnswerLimit: 6,
+								},
+								RecursorTimeout: "2s",
+							},
+						},
+					})
+
+					limit := 6
+					Expect(consulConfig.DNSConfig).To(Equal(&config.ConsulConfigDNSConfig{
+						AllowStale: &trueValue,
+						MaxStale:   &[]string{"5s"}[0],
+						NodeTTL:    &[]string{"10s"}[0],
+						ServiceTTL: map[string]string{
+							"*":   "5s",
+							"uaa": "30s",
+						},
+						EnableTruncate: &falseValue,
+						OnlyPassing:    &trueValue,
+						UDPAnswerLimit: &limit,
+					}))
+					Expect(*consulConfig.RecursorTimeout).To(Equal("2s"))
+				})
+
+				It("only renders the settings that are configured", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								DNSConfig: config.ConfigConsulAgentDNSConfig{
+									NodeTTL: "0s",
+								},
+							},
+						},
+					})
+
+					contents, err := json.Marshal(consulConfig.DNSConfig)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(contents).To(MatchJSON(`{"node_ttl": "0s"}`))
+				})
+			})
+		})
+
+		Describe("addresses", func() {
+			It("leaves the advertised and client addresses to consul", func() {
+				Expect(consulConfig.AdvertiseAddr).To(BeNil())
+				Expect(consulConfig.AdvertiseAddrWAN).To(BeNil())
+				Expect(consulConfig.ClientAddr).To(BeNil())
+				Expect(consulConfig.Addresses).To(BeNil())
+			})
+
+			Context("when the addresses are configured", func() {
+				It("uses those values", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								AdvertiseAddr:    "203.0.113.10",
+								AdvertiseAddrWAN: "203.0.113.11",
+								ClientAddr:       "10.0.0.5",
+								Addresses: config.ConfigConsulAgentAddresses{
+									DNS: "0.0.0.0",
+								},
+							},
+						},
+					})
+					Expect(*consulConfig.AdvertiseAddr).To(Equal("203.0.113.10"))
+					Expect(*consulConfig.AdvertiseAddrWAN).To(Equal("203.0.113.11"))
+					Expect(*consulConfig.ClientAddr).To(Equal("10.0.0.5"))
+					Expect(consulConfig.Addresses).To(Equal(&config.ConsulConfigAddresses{
+						DNS: "0.0.0.0",
+					}))
+				})
+			})
+		})
+
 		Describe("data_dir", func() {
 			It("defaults to `/var/vcap/store/consul_agent`", func() {
 				Expect(consulConfig.DataDir).To(Equal("/var/vcap/store/consul_agent"))
@@ -261,12 +404,86 @@ var _ = Describe("ConsulConfigDefiner", func() {
 			})
 		})
 
+		Describe("tls", func() {
+			var trueValue, falseValue = true, false
+
+			It("leaves the tls settings to consul's defaults", func() {
+				Expect(consulConfig.TLSMinVersion).To(BeNil())
+				Expect(consulConfig.TLSCipherSuites).To(BeNil())
+				Expect(consulConfig.Ports.HTTPS).To(Equal(0))
+			})
+
+			Context("when `consul.agent.tls` is configured", func() {
+				It("uses those values", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								TLS: config.ConfigConsulAgentTLS{
+									Enabled:              &trueValue,
+									VerifyIncoming:       &falseValue,
+									VerifyServerHostname: &falseValue,
+									MinVersion:           "tls12",
+									CipherSuites:         []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+									HTTPSPort:            8501,
+								},
+							},
+						},
+					})
+					Expect(*consulConfig.VerifyIncoming).To(BeFalse())
+					Expect(*consulConfig.VerifyOutgoing).To(BeTrue())
+					Expect(*consulConfig.VerifyServerHostname).To(BeFalse())
+					Expect(*consulConfig.TLSMinVersion).To(Equal("tls12"))
+					Expect(*consulConfig.TLSCipherSuites).To(Equal("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"))
+					Expect(consulConfig.Ports.HTTPS).To(Equal(8501))
+				})
+			})
+
+			Context("when `consul.agent.tls.enabled` is false", func() {
+				It("leaves out every tls setting", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								TLS: config.ConfigConsulAgentTLS{
+									Enabled:      &falseValue,
+									MinVersion:   "tls12",
+									CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+									HTTPSPort:    8501,
+								},
+							},
+						},
+					})
+					Expect(consulConfig.VerifyIncoming).To(BeNil())
+					Expect(consulConfig.VerifyOutgoing).To(BeNil())
+					Expect(consulConfig.VerifyServerHostname).To(BeNil())
+					Expect(consulConfig.CAFile).To(BeNil())
+					Expect(consulConfig.CertFile).To(BeNil())
+					Expect(consulConfig.KeyFile).To(BeNil())
+					Expect(consulConfig.TLSMinVersion).To(BeNil())
+					Expect(consulConfig.TLSCipherSuites).To(BeNil())
+					Expect(consulConfig.Ports.HTTPS).To(Equal(0))
+				})
+			})
+		})
+
 		Describe("ca_file", func() {
 			It("is the location of the ca file", func() {
 				consulConfig = config.GenerateConfiguration(config.Config{})
 				Expect(consulConfig.CAFile).NotTo(BeNil())
 				Expect(*consulConfig.CAFile).To(Equal("/var/vcap/jobs/consul_agent/config/certs/ca.crt"))
 			})
+
+			Context("when `path.certs_dir` is provided", func() {
+				It("points the tls files at that directory", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Path: config.ConfigPath{
+							CertsDir: "/some/certs",
+						},
+					})
+					Expect(*consulConfig.CAFile).To(Equal("/some/certs/ca.crt"))
+					Expect(*consulConfig.CertFile).To(Equal("/some/certs/agent.crt"))
+					Expect(*consulConfig.KeyFile).To(Equal("/some/certs/agent.key"))
+				})
+			})
 		})
 
 		Describe("key_file", func() {
@@ -337,6 +554,17 @@ var _ = Describe("ConsulConfigDefiner", func() {
 					Expect(*consulConfig.Encrypt).To(Equal("enqzXBmgKOy13WIGsmUk+g=="))
 				})
 
+				It("redacts the key", func() {
+					consulConfig = config.GenerateConfiguration(
+						config.Config{
+							Consul: config.ConfigConsul{
+								EncryptKeys: []string{"banana"},
+							},
+						})
+					Expect(*consulConfig.Redacted().Encrypt).To(Equal("[redacted]"))
+					Expect(*consulConfig.Encrypt).To(Equal("enqzXBmgKOy13WIGsmUk+g=="))
+				})
+
 				It("leaves the key alone if it is already base 64 encoded", func() {
 					consulConfig = config.GenerateConfiguration(
 						config.Config{
@@ -350,6 +578,43 @@ var _ = Describe("ConsulConfigDefiner", func() {
 			})
 		})
 
+		Describe("encrypt_verify_incoming and encrypt_verify_outgoing", func() {
+			generate := func(stage string) config.ConsulConfig {
+				return config.GenerateConfiguration(config.Config{
+					Consul: config.ConfigConsul{
+						EncryptKeys:  []string{"enqzXBmgKOy13WIGsmUk+g=="},
+						EncryptStage: stage,
+					},
+				})
+			}
+
+			It("accepts and sends plaintext gossip in the accept stage", func() {
+				consulConfig = generate("accept")
+				Expect(*consulConfig.EncryptVerifyIncoming).To(BeFalse())
+				Expect(*consulConfig.EncryptVerifyOutgoing).To(BeFalse())
+			})
+
+			It("only sends encrypted gossip in the send stage", func() {
+				consulConfig = generate("send")
+				Expect(*consulConfig.EncryptVerifyIncoming).To(BeFalse())
+				Expect(*consulConfig.EncryptVerifyOutgoing).To(BeTrue())
+			})
+
+			It("leaves consul to enforce encryption in the enforce stage", func() {
+				consulConfig = generate("enforce")
+				Expect(consulConfig.EncryptVerifyIncoming).To(BeNil())
+				Expect(consulConfig.EncryptVerifyOutgoing).To(BeNil())
+			})
+
+			It("is nil without encrypt keys", func() {
+				consulConfig = config.GenerateConfiguration(config.Config{
+					Consul: config.ConfigConsul{EncryptStage: "accept"},
+				})
+				Expect(consulConfig.EncryptVerifyIncoming).To(BeNil())
+				Expect(consulConfig.EncryptVerifyOutgoing).To(BeNil())
+			})
+		})
+
 		Describe("bootstrap_expect", func() {
 			Context("when `consul.agent.mode` is not `server`", func() {
 				It("is nil", func() {
@@ -376,6 +641,218 @@ var _ = Describe("ConsulConfigDefiner", func() {
 					Expect(consulConfig.BootstrapExpect).NotTo(BeNil())
 					Expect(*consulConfig.BootstrapExpect).To(Equal(3))
 				})
+
+				It("prefers the configured value", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								Mode:            "server",
+								BootstrapExpect: 5,
+								Servers: config.ConfigConsulAgentServers{
+									LAN: []string{"consul.service.internal"},
+								},
+							},
+						},
+					})
+					Expect(consulConfig.BootstrapExpect).NotTo(BeNil())
+					Expect(*consulConfig.BootstrapExpect).To(Equal(5))
+				})
+			})
+		})
+
+		Describe("acl", func() {
+			It("leaves the acl settings unset by default", func() {
+				Expect(consulConfig.ACLDatacenter).To(BeNil())
+				Expect(consulConfig.ACLMasterToken).To(BeNil())
+				Expect(consulConfig.ACLAgentToken).To(BeNil())
+				Expect(consulConfig.ACLDefaultPolicy).To(BeNil())
+				Expect(consulConfig.ACLDownPolicy).To(BeNil())
+			})
+
+			Context("when `consul.agent.acl` is provided", func() {
+				var acl config.ConfigConsulAgentACL
+
+				BeforeEach(func() {
+					acl = config.ConfigConsulAgentACL{
+						Datacenter:    "some-acl-datacenter",
+						DefaultPolicy: "deny",
+						DownPolicy:    "extend-cache",
+						MasterToken:   "some-master-token",
+						AgentToken:    "some-agent-token",
+					}
+				})
+
+				It("renders the acl settings", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								Mode: "server",
+								ACL:  acl,
+							},
+						},
+					})
+					Expect(*consulConfig.ACLDatacenter).To(Equal("some-acl-datacenter"))
+					Expect(*consulConfig.ACLDefaultPolicy).To(Equal("deny"))
+					Expect(*consulConfig.ACLDownPolicy).To(Equal("extend-cache"))
+					Expect(*consulConfig.ACLMasterToken).To(Equal("some-master-token"))
+					Expect(*consulConfig.ACLAgentToken).To(Equal("some-agent-token"))
+				})
+
+				It("does not render the master token on clients", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								Mode: "client",
+								ACL:  acl,
+							},
+						},
+					})
+					Expect(consulConfig.ACLMasterToken).To(BeNil())
+					Expect(*consulConfig.ACLAgentToken).To(Equal("some-agent-token"))
+				})
+
+				It("redacts the tokens", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								Mode: "server",
+								ACL:  acl,
+							},
+						},
+					})
+
+					redacted := consulConfig.Redacted()
+					Expect(*redacted.ACLMasterToken).To(Equal("[redacted]"))
+					Expect(*redacted.ACLAgentToken).To(Equal("[redacted]"))
+					Expect(*consulConfig.ACLMasterToken).To(Equal("some-master-token"))
+				})
+			})
+		})
+
+		Describe("telemetry", func() {
+			It("leaves the telemetry settings unset by default", func() {
+				Expect(consulConfig.StatsdAddr).To(BeNil())
+				Expect(consulConfig.StatsiteAddr).To(BeNil())
+				Expect(consulConfig.StatsitePrefix).To(BeNil())
+				Expect(consulConfig.DogstatsdAddr).To(BeNil())
+				Expect(consulConfig.DogstatsdTags).To(BeNil())
+			})
+
+			Context("when `consul.agent.telemetry` is provided", func() {
+				It("renders the telemetry settings", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								Telemetry: config.ConfigConsulAgentTelemetry{
+									StatsdAddress:    "127.0.0.1:8125",
+									StatsiteAddress:  "127.0.0.1:8126",
+									StatsitePrefix:   "some-prefix",
+									DogstatsdAddress: "127.0.0.1:8127",
+									DogstatsdTags:    []string{"env:test"},
+									ConfabPrefix:     "some-confab-prefix",
+								},
+							},
+						},
+					})
+					Expect(*consulConfig.StatsdAddr).To(Equal("127.0.0.1:8125"))
+					Expect(*consulConfig.StatsiteAddr).To(Equal("127.0.0.1:8126"))
+					Expect(*consulConfig.StatsitePrefix).To(Equal("some-prefix"))
+					Expect(*consulConfig.DogstatsdAddr).To(Equal("127.0.0.1:8127"))
+					Expect(consulConfig.DogstatsdTags).To(Equal([]string{"env:test"}))
+				})
+			})
+		})
+
+		Describe("leave_on_terminate and skip_leave_on_interrupt", func() {
+			It("leaves them unset by default", func() {
+				Expect(consulConfig.LeaveOnTerminate).To(BeNil())
+				Expect(consulConfig.SkipLeaveOnInterrupt).To(BeNil())
+			})
+
+			Context("when they are provided", func() {
+				It("renders them", func() {
+					leaveOnTerminate := true
+					skipLeaveOnInterrupt := false
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								LeaveOnTerminate:     &leaveOnTerminate,
+								SkipLeaveOnInterrupt: &skipLeaveOnInterrupt,
+							},
+						},
+					})
+					Expect(*consulConfig.LeaveOnTerminate).To(BeTrue())
+					Expect(*consulConfig.SkipLeaveOnInterrupt).To(BeFalse())
+				})
+			})
+		})
+
+		Describe("performance", func() {
+			It("is unset by default", func() {
+				Expect(consulConfig.Performance).To(BeNil())
+			})
+
+			Context("when `consul.agent.performance.raft_multiplier` is provided", func() {
+				It("renders the raft multiplier", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								Performance: config.ConfigConsulAgentPerformance{
+									RaftMultiplier: 5,
+								},
+							},
+						},
+					})
+					Expect(consulConfig.Performance).To(Equal(&config.ConsulConfigPerformance{
+						RaftMultiplier: 5,
+					}))
+				})
+			})
+		})
+
+		Describe("autopilot", func() {
+			var autopilot config.ConfigConsulAgentAutopilot
+
+			BeforeEach(func() {
+				cleanupDeadServers := false
+				autopilot = config.ConfigConsulAgentAutopilot{
+					CleanupDeadServers:      &cleanupDeadServers,
+					LastContactThreshold:    "400ms",
+					ServerStabilizationTime: "20s",
+				}
+			})
+
+			It("is unset by default", func() {
+				Expect(consulConfig.Autopilot).To(BeNil())
+			})
+
+			Context("when `consul.agent.mode` is `server`", func() {
+				It("renders the autopilot settings", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								Mode:      "server",
+								Autopilot: autopilot,
+							},
+						},
+					})
+					Expect(*consulConfig.Autopilot.CleanupDeadServers).To(BeFalse())
+					Expect(*consulConfig.Autopilot.LastContactThreshold).To(Equal("400ms"))
+					Expect(*consulConfig.Autopilot.ServerStabilizationTime).To(Equal("20s"))
+				})
+			})
+
+			Context("when `consul.agent.mode` is not `server`", func() {
+				It("does not render the autopilot settings", func() {
+					consulConfig = config.GenerateConfiguration(config.Config{
+						Consul: config.ConfigConsul{
+							Agent: config.ConfigConsulAgent{
+								Autopilot: autopilot,
+							},
+						},
+					})
+					Expect(consulConfig.Autopilot).To(BeNil())
+				})
 			})
 		})
 	})
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const (
+	FeatureRPC       = "rpc"
+	FeatureTLSReload = "tls-reload"
+)
+
+var (
+	consulVersionPattern  = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.]+))?`)
+	consulProtocolPattern = regexp.MustCompile(`Consul Protocol: (\d+) \(Understands back to: (\d+)\)`)
+)
+
+// MinimumConsulVersion is the oldest consul confab supports. It is the
+// version the release ships, which exercises the agent RPC paths; the HTTP
+// API paths take over from 0.8.0 on.
+var MinimumConsulVersion = ConsulVersion{Major: 0, Minor: 6, Patch: 4}
+
+type ConsulVersion struct {
+	Major       int
+	Minor       int
+	Patch       int
+	Prerelease  string
+	ProtocolMin int
+	ProtocolMax int
+}
+
+type consulVersionRange struct {
+	Since ConsulVersion
+	Until ConsulVersion
+}
+
+// consulFeatureSupport lists the agent interfaces confab talks to. A zero
+// Until means the feature has not been removed.
+var consulFeatureSupport = map[string]consulVersionRange{
+	FeatureRPC:       {Until: ConsulVersion{Major: 0, Minor: 8, Patch: 0}},
+	FeatureTLSReload: {Since: ConsulVersion{Major: 1, Minor: 4, Patch: 0}},
+}
+
+// consulConfigFieldSupport lists ConsulConfig keys that have not always been
+// understood by the agent, keyed by their JSON name. Keys of nested objects
+// are joined to their parent with a dot.
+var consulConfigFieldSupport = map[string]consulVersionRange{
+	"retry_join_wan":          {Since: ConsulVersion{Major: 0, Minor: 5, Patch: 0}},
+	"verify_server_hostname":  {Since: ConsulVersion{Major: 0, Minor: 5, Patch: 1}},
+	"acl_datacenter":          {Since: ConsulVersion{Major: 0, Minor: 4, Patch: 0}},
+	"acl_master_token":        {Since: ConsulVersion{Major: 0, Minor: 4, Patch: 0}},
+	"acl_agent_token":         {Since: ConsulVersion{Major: 0, Minor: 7, Patch: 2}},
+	"acl_default_policy":      {Since: ConsulVersion{Major: 0, Minor: 4, Patch: 0}},
+	"acl_down_policy":         {Since: ConsulVersion{Major: 0, Minor: 4, Patch: 0}},
+	"statsite_addr":           {Since: ConsulVersion{Major: 0, Minor: 3, Patch: 0}, Until: ConsulVersion{Major: 1, Minor: 0, Patch: 0}},
+	"statsd_addr":             {Since: ConsulVersion{Major: 0, Minor: 5, Patch: 0}, Until: ConsulVersion{Major: 1, Minor: 0, Patch: 0}},
+	"statsite_prefix":         {Since: ConsulVersion{Major: 0, Minor: 5, Patch: 1}, Until: ConsulVersion{Major: 1, Minor: 0, Patch: 0}},
+	"dogstatsd_addr":          {Since: ConsulVersion{Major: 0, Minor: 6, Patch: 0}, Until: ConsulVersion{Major: 1, Minor: 0, Patch: 0}},
+	"dogstatsd_tags":          {Since: ConsulVersion{Major: 0, Minor: 6, Patch: 0}, Until: ConsulVersion{Major: 1, Minor: 0, Patch: 0}},
+	"skip_leave_on_interrupt": {Since: ConsulVersion{Major: 0, Minor: 5, Patch: 0}},
+	"node_meta":               {Since: ConsulVersion{Major: 0, Minor: 7, Patch: 3}},
+	"advertise_addr_wan":      {Since: ConsulVersion{Major: 0, Minor: 5, Patch: 0}},
+	"tls_min_version":         {Since: ConsulVersion{Major: 0, Minor: 7, Patch: 4}},
+	"tls_cipher_suites":       {Since: ConsulVersion{Major: 0, Minor: 8, Patch: 2}},
+	"performance":             {Since: ConsulVersion{Major: 0, Minor: 7, Patch: 0}},
+	"autopilot":               {Since: ConsulVersion{Major: 0, Minor: 8, Patch: 0}},
+	"recursor_timeout":        {Since: ConsulVersion{Major: 0, Minor: 7, Patch: 0}},
+	"encrypt_verify_incoming": {Since: ConsulVersion{Major: 0, Minor: 8, Patch: 4}},
+	"encrypt_verify_outgoing": {Since: ConsulVersion{Major: 0, Minor: 8, Patch: 4}},
+
+	"dns_config.udp_answer_limit": {Since: ConsulVersion{Major: 0, Minor: 7, Patch: 0}},
+}
+
+// consulServiceCheckFieldSupport lists service check keys that have not
+// always been understood by the agent, keyed by their JSON name.
+var consulServiceCheckFieldSupport = map[string]consulVersionRange{
+	"grpc":         {Since: ConsulVersion{Major: 1, Minor: 0, Patch: 5}},
+	"grpc_use_tls": {Since: ConsulVersion{Major: 1, Minor: 0, Patch: 5}},
+}
+
+func ParseConsulVersion(output string) (ConsulVersion, error) {
+	version, err := NewConsulVersion(output)
+	if err != nil {
+		return ConsulVersion{}, err
+	}
+
+	matches := consulProtocolPattern.FindStringSubmatch(output)
+	if matches == nil {
+		return ConsulVersion{}, fmt.Errorf("could not find protocol range in consul version output: %q", output)
+	}
+
+	version.ProtocolMax, _ = strconv.Atoi(matches[1])
+	version.ProtocolMin, _ = strconv.Atoi(matches[2])
+
+	return version, nil
+}
+
+func NewConsulVersion(version string) (ConsulVersion, error) {
+	matches := consulVersionPattern.FindStringSubmatch(version)
+	if matches == nil {
+		return ConsulVersion{}, fmt.Errorf("could not parse consul version: %q", version)
+	}
+
+	major, _ := strconv.Atoi(matches[1])
+	minor, _ := strconv.Atoi(matches[2])
+	patch, _ := strconv.Atoi(matches[3])
+
+	return ConsulVersion{
+		Major:      major,
+		Minor:      minor,
+		Patch:      patch,
+		Prerelease: matches[4],
+	}, nil
+}
+
+func (v ConsulVersion) String() string {
+	version := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		version = fmt.Sprintf("%s-%s", version, v.Prerelease)
+	}
+
+	return version
+}
+
+func (v ConsulVersion) LessThan(other ConsulVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+
+	return v.Patch < other.Patch
+}
+
+func (v ConsulVersion) Supports(feature string) bool {
+	versionRange, ok := consulFeatureSupport[feature]
+	if !ok {
+		return false
+	}
+
+	return versionRange.includes(v)
+}
+
+// CheckMinimum returns an error when the version is older than
+// MinimumConsulVersion.
+func (v ConsulVersion) CheckMinimum() error {
+	if v.LessThan(MinimumConsulVersion) {
+		return fmt.Errorf("consul %s is not supported: confab requires consul >= %s", v, MinimumConsulVersion)
+	}
+
+	return nil
+}
+
+func (v ConsulVersion) Validate(consulConfig ConsulConfig) error {
+	if consulConfig.Protocol != 0 && v.ProtocolMax != 0 {
+		if consulConfig.Protocol < v.ProtocolMin || consulConfig.Protocol > v.ProtocolMax {
+			return fmt.Errorf("consul %s is not supported: protocol version %d is outside of the supported range %d-%d",
+				v, consulConfig.Protocol, v.ProtocolMin, v.ProtocolMax)
+		}
+	}
+
+	fields, err := consulConfigFields(consulConfig)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		versionRange, ok := consulConfigFieldSupport[field]
+		if ok && !versionRange.includes(v) {
+			return fmt.Errorf("consul %s is not supported: configuration %q is only available in consul %s",
+				v, field, versionRange)
+		}
+	}
+
+	return nil
+}
+
+// ValidateServices checks the service definitions handed to the agent in the
+// same way Validate checks its configuration.
+func (v ConsulVersion) ValidateServices(definitions []ServiceDefinition) error {
+	for _, definition := range definitions {
+		checks := definition.Checks
+		if definition.Check != nil {
+			checks = append([]ServiceDefinitionCheck{*definition.Check}, checks...)
+		}
+
+		for _, check := range checks {
+			fields, err := jsonKeys(check)
+			if err != nil {
+				return err
+			}
+
+			for _, field := range fields {
+				versionRange, ok := consulServiceCheckFieldSupport[field]
+				if ok && !versionRange.includes(v) {
+					return fmt.Errorf("consul %s is not supported: check %q of service %q uses %q, which is only available in consul %s",
+						v, check.Name, definition.Name, field, versionRange)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r consulVersionRange) includes(v ConsulVersion) bool {
+	if v.LessThan(r.Since) {
+		return false
+	}
+
+	if r.Until != (ConsulVersion{}) && !v.LessThan(r.Until) {
+		return false
+	}
+
+	return true
+}
+
+func (r consulVersionRange) String() string {
+	switch {
+	case r.Until == (ConsulVersion{}):
+		return fmt.Sprintf(">= %s", r.Since)
+	case r.Since == (ConsulVersion{}):
+		return fmt.Sprintf("< %s", r.Until)
+	default:
+		return fmt.Sprintf(">= %s, < %s", r.Since, r.Until)
+	}
+}
+
+func consulConfigFields(consulConfig ConsulConfig) ([]string, error) {
+	fields, err := jsonObject(consulConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key, value := range fields {
+		keys = append(keys, key)
+
+		if object, ok := value.(map[string]interface{}); ok {
+			for nestedKey := range object {
+				keys = append(keys, key+"."+nestedKey)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func jsonKeys(value interface{}) ([]string, error) {
+	fields, err := jsonObject(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func jsonObject(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.New(err.Error())
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,181 @@
+package config_test
+
+import (
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConsulVersion", func() {
+	Describe("ParseConsulVersion", func() {
+		It("parses the output of `consul version`", func() {
+			version, err := config.ParseConsulVersion("Consul v0.6.4\nConsul Protocol: 3 (Understands back to: 1)\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(config.ConsulVersion{
+				Major:       0,
+				Minor:       6,
+				Patch:       4,
+				ProtocolMin: 1,
+				ProtocolMax: 3,
+			}))
+		})
+
+		It("parses prerelease versions", func() {
+			version, err := config.ParseConsulVersion("Consul v0.7.0-rc1 ('a189091+CHANGES')\nConsul Protocol: 3 (Understands back to: 1)\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version.String()).To(Equal("0.7.0-rc1"))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the version is missing", func() {
+				_, err := config.ParseConsulVersion("banana")
+				Expect(err).To(MatchError(`could not parse consul version: "banana"`))
+			})
+
+			It("returns an error when the protocol range is missing", func() {
+				_, err := config.ParseConsulVersion("Consul v0.6.4")
+				Expect(err).To(MatchError(`could not find protocol range in consul version output: "Consul v0.6.4"`))
+			})
+		})
+	})
+
+	Describe("NewConsulVersion", func() {
+		It("parses the version reported by the agent self endpoint", func() {
+			version, err := config.NewConsulVersion("0.6.4")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(config.ConsulVersion{Major: 0, Minor: 6, Patch: 4}))
+		})
+	})
+
+	Describe("Supports", func() {
+		It("reports the features available in a given version", func() {
+			Expect(config.ConsulVersion{Major: 0, Minor: 6, Patch: 4}.Supports(config.FeatureRPC)).To(BeTrue())
+			Expect(config.ConsulVersion{Major: 0, Minor: 8, Patch: 0}.Supports(config.FeatureRPC)).To(BeFalse())
+			Expect(config.ConsulVersion{Major: 0, Minor: 6, Patch: 4}.Supports(config.FeatureTLSReload)).To(BeFalse())
+			Expect(config.ConsulVersion{Major: 1, Minor: 4, Patch: 0}.Supports(config.FeatureTLSReload)).To(BeTrue())
+			Expect(config.ConsulVersion{Major: 0, Minor: 6, Patch: 4}.Supports("banana")).To(BeFalse())
+		})
+	})
+
+	Describe("CheckMinimum", func() {
+		It("accepts the minimum version and later ones", func() {
+			Expect(config.MinimumConsulVersion.CheckMinimum()).To(Succeed())
+			Expect(config.ConsulVersion{Major: 1, Minor: 4, Patch: 0}.CheckMinimum()).To(Succeed())
+		})
+
+		It("rejects older versions", func() {
+			version := config.ConsulVersion{Major: 0, Minor: 6, Patch: 3}
+			Expect(version.CheckMinimum()).To(MatchError("consul 0.6.3 is not supported: confab requires consul >= 0.6.4"))
+		})
+	})
+
+	Describe("Validate", func() {
+		var consulConfig config.ConsulConfig
+
+		BeforeEach(func() {
+			consulConfig = config.GenerateConfiguration(config.Default())
+		})
+
+		It("accepts a supported version", func() {
+			version := config.ConsulVersion{Major: 0, Minor: 6, Patch: 4, ProtocolMin: 1, ProtocolMax: 3}
+			Expect(version.Validate(consulConfig)).To(Succeed())
+		})
+
+		It("accepts versions without the agent rpc interface", func() {
+			version := config.ConsulVersion{Major: 1, Minor: 4, Patch: 0, ProtocolMin: 2, ProtocolMax: 3}
+			Expect(version.Validate(consulConfig)).To(Succeed())
+		})
+
+		It("rejects versions that do not understand the generated configuration", func() {
+			version := config.ConsulVersion{Major: 0, Minor: 5, Patch: 0}
+			Expect(version.Validate(consulConfig)).To(MatchError(`consul 0.5.0 is not supported: configuration "verify_server_hostname" is only available in consul >= 0.5.1`))
+		})
+
+		It("rejects raft performance tuning before consul 0.7.0", func() {
+			consulConfig.Performance = &config.ConsulConfigPerformance{RaftMultiplier: 5}
+			version := config.ConsulVersion{Major: 0, Minor: 6, Patch: 4}
+			Expect(version.Validate(consulConfig)).To(MatchError(`consul 0.6.4 is not supported: configuration "performance" is only available in consul >= 0.7.0`))
+		})
+
+		It("accepts autopilot settings from consul 0.8.0", func() {
+			cfg := config.Default()
+			cfg.Consul.Agent.Mode = "server"
+			cfg.Consul.Agent.Autopilot.LastContactThreshold = "200ms"
+			consulConfig = config.GenerateConfiguration(cfg)
+
+			version := config.ConsulVersion{Major: 0, Minor: 8, Patch: 0}
+			Expect(version.Validate(consulConfig)).To(Succeed())
+
+			version = config.ConsulVersion{Major: 0, Minor: 7, Patch: 5}
+			Expect(version.Validate(consulConfig)).To(MatchError(`consul 0.7.5 is not supported: configuration "autopilot" is only available in consul >= 0.8.0`))
+		})
+
+		It("rejects nested configuration the version does not understand", func() {
+			limit := 3
+			consulConfig.DNSConfig = &config.ConsulConfigDNSConfig{UDPAnswerLimit: &limit}
+			version := config.ConsulVersion{Major: 0, Minor: 6, Patch: 4}
+			Expect(version.Validate(consulConfig)).To(MatchError(`consul 0.6.4 is not supported: configuration "dns_config.udp_answer_limit" is only available in consul >= 0.7.0`))
+
+			consulConfig.DNSConfig = &config.ConsulConfigDNSConfig{NodeTTL: &[]string{"10s"}[0]}
+			Expect(version.Validate(consulConfig)).To(Succeed())
+		})
+
+		It("rejects staged gossip encryption before consul 0.8.4", func() {
+			consulConfig.EncryptVerifyIncoming = &[]bool{false}[0]
+			version := config.ConsulVersion{Major: 0, Minor: 7, Patch: 5}
+			Expect(version.Validate(consulConfig)).To(MatchError(`consul 0.7.5 is not supported: configuration "encrypt_verify_incoming" is only available in consul >= 0.8.4`))
+		})
+
+		It("accepts the accept and send stages from consul 0.8.4", func() {
+			for _, stage := range []string{config.EncryptStageAccept, config.EncryptStageSend} {
+				cfg := config.Default()
+				cfg.Consul.EncryptKeys = []string{"some-key"}
+				cfg.Consul.EncryptStage = stage
+				consulConfig = config.GenerateConfiguration(cfg)
+
+				version := config.ConsulVersion{Major: 0, Minor: 8, Patch: 4}
+				Expect(version.Validate(consulConfig)).To(Succeed(), stage)
+
+				version = config.ConsulVersion{Major: 0, Minor: 8, Patch: 3}
+				Expect(version.Validate(consulConfig)).To(MatchError(`consul 0.8.3 is not supported: configuration "encrypt_verify_incoming" is only available in consul >= 0.8.4`), stage)
+			}
+		})
+
+		It("rejects a protocol version outside of the supported range", func() {
+			consulConfig.Protocol = 4
+			version := config.ConsulVersion{Major: 0, Minor: 6, Patch: 4, ProtocolMin: 1, ProtocolMax: 3}
+			Expect(version.Validate(consulConfig)).To(MatchError("consul 0.6.4 is not supported: protocol version 4 is outside of the supported range 1-3"))
+		})
+	})
+
+	Describe("ValidateServices", func() {
+		var definitions []config.ServiceDefinition
+
+		BeforeEach(func() {
+			definitions = []config.ServiceDefinition{
+				{
+					Name: "router",
+					Check: &config.ServiceDefinitionCheck{
+						Name:     "dns_health_check",
+						Script:   "/var/vcap/jobs/router/bin/dns_health_check",
+						Interval: "3s",
+					},
+					Checks: []config.ServiceDefinitionCheck{
+						{Name: "router-grpc", GRPC: "127.0.0.1:9000", GRPCUseTLS: true, Interval: "10s"},
+					},
+				},
+			}
+		})
+
+		It("accepts checks the version understands", func() {
+			version := config.ConsulVersion{Major: 1, Minor: 0, Patch: 5}
+			Expect(version.ValidateServices(definitions)).To(Succeed())
+		})
+
+		It("rejects checks the version does not understand", func() {
+			version := config.ConsulVersion{Major: 1, Minor: 0, Patch: 4}
+			Expect(version.ValidateServices(definitions)).To(MatchError(`consul 1.0.4 is not supported: check "router-grpc" of service "router" uses "grpc", which is only available in consul >= 1.0.5`))
+		})
+	})
+})
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ConsulDNSConfig returns the dns_config block to render, or nil when none of
+// its settings are configured so that consul keeps its own defaults.
+func ConsulDNSConfig(dns ConfigConsulAgentDNSConfig) *ConsulConfigDNSConfig {
+	if dns.AllowStale == nil && dns.MaxStale == "" && dns.NodeTTL == "" && len(dns.ServiceTTL) == 0 &&
+		dns.EnableTruncate == nil && dns.OnlyPassing == nil && dns.UDPAnswerLimit == 0 {
+		return nil
+	}
+
+	consulDNSConfig := &ConsulConfigDNSConfig{
+		AllowStale:     dns.AllowStale,
+		ServiceTTL:     dns.ServiceTTL,
+		EnableTruncate: dns.EnableTruncate,
+		OnlyPassing:    dns.OnlyPassing,
+	}
+
+	if dns.MaxStale != "" {
+		consulDNSConfig.MaxStale = strPtr(dns.MaxStale)
+	}
+
+	if dns.NodeTTL != "" {
+		consulDNSConfig.NodeTTL = strPtr(dns.NodeTTL)
+	}
+
+	if dns.UDPAnswerLimit != 0 {
+		consulDNSConfig.UDPAnswerLimit = &dns.UDPAnswerLimit
+	}
+
+	return consulDNSConfig
+}
+
+// validateDNS checks the DNS durations, which unlike the autopilot timings
+// may be zero to disable caching.
+func validateDNS(agent ConfigConsulAgent) error {
+	type namedDuration struct {
+		name  string
+		value string
+	}
+
+	durations := []namedDuration{
+		{"recursor_timeout", agent.RecursorTimeout},
+		{"dns_config.max_stale", agent.DNSConfig.MaxStale},
+		{"dns_config.node_ttl", agent.DNSConfig.NodeTTL},
+	}
+
+	var services []string
+	for service := range agent.DNSConfig.ServiceTTL {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
+		durations = append(durations, namedDuration{
+			name:  fmt.Sprintf("dns_config.service_ttl.%s", service),
+			value: agent.DNSConfig.ServiceTTL[service],
+		})
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("%q must be a duration such as \"5s\" or \"1m\", got %q", d.name, d.value)
+		}
+
+		if duration < 0 {
+			return fmt.Errorf("%q must not be negative, got %q", d.name, d.value)
+		}
+	}
+
+	if limit := agent.DNSConfig.UDPAnswerLimit; limit < 0 {
+		return fmt.Errorf("\"dns_config.udp_answer_limit\" must not be negative, got %d", limit)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// confabOwnedConsulConfigKeys are derived from confab's own properties and
+// cannot be overridden through extra_config.
+var confabOwnedConsulConfigKeys = []string{
+	"bootstrap_expect",
+	"ca_file",
+	"cert_file",
+	"data_dir",
+	"encrypt",
+	"key_file",
+	"server",
+}
+
+// MergeExtraConfig deep-merges extra into the generated configuration. Nested
+// objects are merged key by key, any other value in extra replaces the
+// generated one.
+func MergeExtraConfig(consulConfig ConsulConfig, extra map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(consulConfig)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+
+	var merged map[string]interface{}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, errors.New(err.Error())
+	}
+
+	mergeMaps(merged, extra)
+
+	return merged, nil
+}
+
+// RedactSettings returns a copy of a merged configuration that is safe to
+// show. The gossip key and every token are redacted, including the ones
+// extra_config nests in objects such as acl.tokens.
+func RedactSettings(settings map[string]interface{}) map[string]interface{} {
+	return redactValue(settings, false).(map[string]interface{})
+}
+
+func redactValue(value interface{}, secret bool) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		redactedMap := map[string]interface{}{}
+		for key, nested := range value {
+			redactedMap[key] = redactValue(nested, secret || isSecretKey(key))
+		}
+		return redactedMap
+	case []interface{}:
+		redactedSlice := make([]interface{}, len(value))
+		for i, nested := range value {
+			redactedSlice[i] = redactValue(nested, secret)
+		}
+		return redactedSlice
+	case string:
+		if secret {
+			return redacted
+		}
+	}
+
+	return value
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	return key == "encrypt" || strings.HasSuffix(key, "token") || strings.HasSuffix(key, "tokens")
+}
+
+func mergeMaps(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+
+		if srcIsMap && dstIsMap {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+
+		dst[key] = value
+	}
+}
+
+func validateExtraConfig(extra map[string]interface{}) error {
+	var keys []string
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, owned := range confabOwnedConsulConfigKeys {
+			if key == owned {
+				return fmt.Errorf("\"extra_config\" cannot override %q, it is managed by confab", key)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package config_test
+
+import (
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MergeExtraConfig", func() {
+	var consulConfig config.ConsulConfig
+
+	BeforeEach(func() {
+		consulConfig = config.GenerateConfiguration(config.Config{
+			Node: config.ConfigNode{Name: "node", Index: 0},
+		})
+	})
+
+	It("returns the generated configuration when there is no extra config", func() {
+		merged, err := config.MergeExtraConfig(consulConfig, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged["node_name"]).To(Equal("node-0"))
+		Expect(merged["ports"]).To(Equal(map[string]interface{}{"dns": float64(53)}))
+	})
+
+	It("adds keys that confab does not generate", func() {
+		merged, err := config.MergeExtraConfig(consulConfig, map[string]interface{}{
+			"ui": true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged["ui"]).To(BeTrue())
+	})
+
+	It("replaces generated values", func() {
+		merged, err := config.MergeExtraConfig(consulConfig, map[string]interface{}{
+			"log_level":  "trace",
+			"retry_join": []interface{}{"10.0.0.1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged["log_level"]).To(Equal("trace"))
+		Expect(merged["retry_join"]).To(Equal([]interface{}{"10.0.0.1"}))
+	})
+
+	It("merges nested objects key by key", func() {
+		merged, err := config.MergeExtraConfig(consulConfig, map[string]interface{}{
+			"ports": map[string]interface{}{
+				"http": 8501,
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged["ports"]).To(Equal(map[string]interface{}{
+			"dns":  float64(53),
+			"http": 8501,
+		}))
+	})
+
+	It("replaces a generated object with a non-object value", func() {
+		merged, err := config.MergeExtraConfig(consulConfig, map[string]interface{}{
+			"ports": nil,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged["ports"]).To(BeNil())
+	})
+})
+
+var _ = Describe("RedactSettings", func() {
+	It("redacts the gossip key and tokens however deeply they are nested", func() {
+		redactedSettings := config.RedactSettings(map[string]interface{}{
+			"encrypt":   "some-key",
+			"acl_token": "some-token",
+			"acl": map[string]interface{}{
+				"tokens": map[string]interface{}{
+					"agent":  "some-agent-token",
+					"master": "some-master-token",
+				},
+			},
+			"node_name":  "node-0",
+			"retry_join": []interface{}{"10.0.0.1"},
+		})
+
+		Expect(redactedSettings).To(Equal(map[string]interface{}{
+			"encrypt":   "[redacted]",
+			"acl_token": "[redacted]",
+			"acl": map[string]interface{}{
+				"tokens": map[string]interface{}{
+					"agent":  "[redacted]",
+					"master": "[redacted]",
+				},
+			},
+			"node_name":  "node-0",
+			"retry_join": []interface{}{"10.0.0.1"},
+		}))
+	})
+})
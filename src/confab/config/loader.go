@@ -0,0 +1,422 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+)
+
+// EnvPrefix starts the environment variables that override settings. The
+// rest of the name is the setting's path, upper cased, with "__" between the
+// path elements: CONFAB_CONSUL__AGENT__LOG_LEVEL sets consul.agent.log_level.
+const EnvPrefix = "CONFAB_"
+
+const (
+	envPathSeparator = "__"
+	defaultSource    = "default"
+)
+
+// Loader builds the configuration from layers. Settings missing from every
+// layer keep their defaults, the files are merged in order and the
+// environment is applied last. Objects are merged key by key, any other
+// value replaces what an earlier layer set.
+type Loader struct {
+	// Files are JSON, or YAML when named *.yml or *.yaml.
+	Files []string
+
+	// Environment holds "KEY=value" pairs, as returned by os.Environ.
+	Environment []string
+
+	// Lenient ignores keys of the files that name no setting instead of
+	// rejecting them.
+	Lenient bool
+
+	// Warn, when set, is called with each setting that upgrading a file to
+	// the current schema version dropped.
+	Warn func(message string)
+}
+
+// Provenance records which layer set each setting, keyed by the setting's
+// dotted path.
+type Provenance map[string]string
+
+// Setting is one value of the effective configuration.
+type Setting struct {
+	Path   string
+	Value  string
+	Source string
+}
+
+func (l Loader) Load() (Config, Provenance, error) {
+	merged := map[string]interface{}{}
+	provenance := Provenance{}
+
+	for _, file := range l.Files {
+		layer, err := readConfigFile(file)
+		if err != nil {
+			return Config{}, nil, err
+		}
+
+		layer, _, warnings, err := MigrateLayer(layer)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("config file %s: %s", file, err)
+		}
+
+		if l.Warn != nil {
+			for _, warning := range warnings {
+				l.Warn(fmt.Sprintf("config file %s: %s", file, warning))
+			}
+		}
+
+		if !l.Lenient {
+			if err := CheckUnknownSettings(layer); err != nil {
+				return Config{}, nil, fmt.Errorf("config file %s: %s", file, err)
+			}
+		}
+
+		mergeLayer(merged, layer, nil, file, provenance)
+	}
+
+	if err := l.applyEnvironment(merged, provenance); err != nil {
+		return Config{}, nil, err
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	config, err := ConfigFromJSON(data)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	return config, provenance, nil
+}
+
+// Source returns the layer that set the value at the path, which is the
+// layer that set the path itself or the closest of its parents.
+func (p Provenance) Source(path string) string {
+	for {
+		if source, ok := p[path]; ok {
+			return source
+		}
+
+		index := strings.LastIndex(path, ".")
+		if index < 0 {
+			return defaultSource
+		}
+		path = path[:index]
+	}
+}
+
+// EffectiveSettings lists every value of the configuration with the layer
+// it came from, ordered by path. Encryption keys are redacted, and so is
+// every token, including the ones in extra_config, the same way render
+// redacts them.
+func EffectiveSettings(config Config, provenance Provenance) ([]Setting, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	var settings []Setting
+	var flatten func(prefix string, value interface{}) error
+	flatten = func(prefix string, value interface{}) error {
+		if object, ok := value.(map[string]interface{}); ok && len(object) > 0 {
+			for key, child := range object {
+				if err := flatten(joinPath(prefix, key), child); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if prefix == "consul.encrypt_keys" && value != nil {
+			value = redacted
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		settings = append(settings, Setting{
+			Path:   prefix,
+			Value:  string(encoded),
+			Source: provenance.Source(prefix),
+		})
+		return nil
+	}
+
+	if err := flatten("", RedactSettings(values)); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(settingsByPath(settings))
+	return settings, nil
+}
+
+type settingsByPath []Setting
+
+func (s settingsByPath) Len() int           { return len(s) }
+func (s settingsByPath) Less(i, j int) bool { return s[i].Path < s[j].Path }
+func (s settingsByPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var layer interface{}
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml":
+		if err := candiedyaml.Unmarshal(data, &layer); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %s", path, err)
+		}
+		layer = stringKeys(layer)
+	default:
+		if err := json.Unmarshal(data, &layer); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %s", path, err)
+		}
+	}
+
+	if layer == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	object, ok := layer.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("config file %s must hold an object", path)
+	}
+
+	return object, nil
+}
+
+// stringKeys turns the map[interface{}]interface{} values the YAML decoder
+// returns into the map[string]interface{} values JSON uses.
+func stringKeys(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		object := map[string]interface{}{}
+		for key, child := range value {
+			object[fmt.Sprint(key)] = stringKeys(child)
+		}
+		return object
+	case map[string]interface{}:
+		for key, child := range value {
+			value[key] = stringKeys(child)
+		}
+		return value
+	case []interface{}:
+		for i, child := range value {
+			value[i] = stringKeys(child)
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+func mergeLayer(merged, layer map[string]interface{}, path []string, source string, provenance Provenance) {
+	for key, value := range layer {
+		childPath := append(append([]string{}, path...), key)
+
+		object, isObject := value.(map[string]interface{})
+		existing, existingIsObject := merged[key].(map[string]interface{})
+		if isObject && existingIsObject {
+			mergeLayer(existing, object, childPath, source, provenance)
+			continue
+		}
+
+		if isObject {
+			merged[key] = map[string]interface{}{}
+			provenance.clear(strings.Join(childPath, "."))
+			mergeLayer(merged[key].(map[string]interface{}), object, childPath, source, provenance)
+			if len(object) == 0 {
+				provenance[strings.Join(childPath, ".")] = source
+			}
+			continue
+		}
+
+		merged[key] = value
+		provenance.clear(strings.Join(childPath, "."))
+		provenance[strings.Join(childPath, ".")] = source
+	}
+}
+
+func (p Provenance) clear(path string) {
+	for key := range p {
+		if key == path || strings.HasPrefix(key, path+".") {
+			delete(p, key)
+		}
+	}
+}
+
+func (l Loader) applyEnvironment(merged map[string]interface{}, provenance Provenance) error {
+	secrets := map[string]bool{}
+	collectEnvSecrets(merged, secrets)
+
+	var names []string
+	values := map[string]string{}
+	for _, variable := range l.Environment {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], EnvPrefix) {
+			continue
+		}
+
+		// A variable an "env:" reference reads a secret from is not an
+		// override, whatever its name.
+		if secrets[parts[0]] {
+			continue
+		}
+
+		names = append(names, parts[0])
+		values[parts[0]] = parts[1]
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path, settingType, ok := settingPath(strings.Split(strings.TrimPrefix(name, EnvPrefix), envPathSeparator))
+		if !ok {
+			err := fmt.Errorf("environment variable %s: there is no setting %q", name, strings.ToLower(strings.Join(path, ".")))
+			if l.Lenient {
+				if l.Warn != nil {
+					l.Warn(fmt.Sprintf("%s, ignoring it", err))
+				}
+				continue
+			}
+
+			return err
+		}
+
+		value, err := envValue(settingType, values[name])
+		if err != nil {
+			return fmt.Errorf("environment variable %s: %s", name, err)
+		}
+
+		layer := map[string]interface{}{}
+		parent := layer
+		for _, key := range path[:len(path)-1] {
+			child := map[string]interface{}{}
+			parent[key] = child
+			parent = child
+		}
+		parent[path[len(path)-1]] = value
+
+		mergeLayer(merged, layer, nil, "env:"+name, provenance)
+	}
+
+	return nil
+}
+
+// envValue decodes the value of an environment variable for a setting of the
+// given type. Strings are taken as they are, anything else is JSON.
+func envValue(settingType reflect.Type, value string) (interface{}, error) {
+	if settingType.Kind() == reflect.String {
+		return value, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		if settingType.Kind() == reflect.Interface {
+			return value, nil
+		}
+
+		return nil, fmt.Errorf("value must be JSON for a setting of type %s: %s", settingType, err)
+	}
+
+	return decoded, nil
+}
+
+// settingPath follows the path through the Config fields and returns it with
+// each field matched regardless of case and spelled by its JSON name, along
+// with the type of the setting. Map keys are kept as they are.
+func settingPath(path []string) ([]string, reflect.Type, bool) {
+	t := reflect.TypeOf(Config{})
+	canonical := make([]string, len(path))
+	for i, key := range path {
+		switch t.Kind() {
+		case reflect.Struct:
+			name := caseInsensitiveField(t, key)
+			if name == "" {
+				return path, nil, false
+			}
+
+			field, _ := jsonField(t, name)
+			canonical[i] = name
+			t = field.Type
+		case reflect.Map:
+			canonical[i] = key
+			t = t.Elem()
+		default:
+			return path, nil, false
+		}
+
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+
+	return canonical, t, true
+}
+
+// collectEnvSecrets adds the names of the variables that "env:" references
+// among the values read secrets from.
+func collectEnvSecrets(value interface{}, names map[string]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, child := range value {
+			collectEnvSecrets(child, names)
+		}
+	case []interface{}:
+		for _, child := range value {
+			collectEnvSecrets(child, names)
+		}
+	case string:
+		if strings.HasPrefix(value, envSecretPrefix) {
+			names[strings.TrimPrefix(value, envSecretPrefix)] = true
+		}
+	}
+}
+
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if tag == "" {
+			tag = strings.ToLower(field.Name)
+		}
+
+		if tag == name {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
@@ -0,0 +1,237 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Loader", func() {
+	var (
+		configDir string
+		base      string
+		override  string
+	)
+
+	writeFile := func(name, contents string) string {
+		path := filepath.Join(configDir, name)
+		Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		configDir, err = ioutil.TempDir("", "loader")
+		Expect(err).NotTo(HaveOccurred())
+
+		base = writeFile("base.json", `{
+			"node": {"name": "consul", "index": 2, "meta": {"rack": "r1", "zone": "z1"}},
+			"consul": {
+				"agent": {
+					"mode": "server",
+					"log_level": "info",
+					"servers": {"lan": ["10.0.0.1", "10.0.0.2"]}
+				}
+			}
+		}`)
+
+		override = writeFile("override.yml", `
+consul:
+  agent:
+    log_level: debug
+    servers:
+      lan: [10.0.0.3]
+node:
+  meta:
+    zone: z2
+confab:
+  timeout_in_seconds: 30
+`)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(configDir)).To(Succeed())
+	})
+
+	Describe("Load", func() {
+		It("merges the files in order over the defaults", func() {
+			cfg, provenance, err := config.Loader{Files: []string{base, override}}.Load()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cfg.Node.Name).To(Equal("consul"))
+			Expect(cfg.Node.Index).To(Equal(2))
+			Expect(cfg.Consul.Agent.Mode).To(Equal("server"))
+			Expect(cfg.Consul.Agent.LogLevel).To(Equal("debug"))
+			Expect(cfg.Consul.Agent.Servers.LAN).To(Equal([]string{"10.0.0.3"}))
+			Expect(cfg.Node.Meta).To(Equal(map[string]string{"rack": "r1", "zone": "z2"}))
+			Expect(cfg.Confab.TimeoutInSeconds).To(Equal(30))
+			Expect(cfg.Confab.SuperviseIntervalInSeconds).To(Equal(config.Default().Confab.SuperviseIntervalInSeconds))
+
+			Expect(provenance.Source("consul.agent.mode")).To(Equal(base))
+			Expect(provenance.Source("consul.agent.log_level")).To(Equal(override))
+			Expect(provenance.Source("node.meta.rack")).To(Equal(base))
+			Expect(provenance.Source("node.meta.zone")).To(Equal(override))
+			Expect(provenance.Source("confab.supervise_interval_in_seconds")).To(Equal("default"))
+		})
+
+		It("applies CONFAB_ environment variables last", func() {
+			cfg, provenance, err := config.Loader{
+				Files: []string{base, override},
+				Environment: []string{
+					"CONFAB_CONSUL__AGENT__LOG_LEVEL=warn",
+					"CONFAB_CONFAB__TIMEOUT_IN_SECONDS=45",
+					"CONFAB_CONSUL__AGENT__SERVERS__LAN=[\"10.0.0.4\",\"10.0.0.5\"]",
+					"CONFAB_NODE__META__row=7",
+					"CONFAB_NODE__META__Rack=r12",
+					"CONFAB_NODE__NAME=123",
+					"PATH=/usr/bin",
+				},
+			}.Load()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cfg.Consul.Agent.LogLevel).To(Equal("warn"))
+			Expect(cfg.Confab.TimeoutInSeconds).To(Equal(45))
+			Expect(cfg.Consul.Agent.Servers.LAN).To(Equal([]string{"10.0.0.4", "10.0.0.5"}))
+			Expect(cfg.Node.Meta).To(HaveKeyWithValue("row", "7"))
+			Expect(cfg.Node.Meta).To(HaveKeyWithValue("Rack", "r12"))
+			Expect(cfg.Node.Name).To(Equal("123"))
+
+			Expect(provenance.Source("consul.agent.log_level")).To(Equal("env:CONFAB_CONSUL__AGENT__LOG_LEVEL"))
+			Expect(provenance.Source("consul.agent.servers.lan")).To(Equal("env:CONFAB_CONSUL__AGENT__SERVERS__LAN"))
+		})
+
+		It("does not treat the variables of env: references as overrides", func() {
+			secrets := writeFile("secrets.json", `{
+				"consul": {"agent": {"acl": {"agent_token_file": "env:CONFAB_AGENT_TOKEN"}}}
+			}`)
+
+			cfg, _, err := config.Loader{
+				Files:       []string{secrets},
+				Environment: []string{"CONFAB_AGENT_TOKEN=some-token"},
+			}.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Consul.Agent.ACL.AgentTokenFile).To(Equal("env:CONFAB_AGENT_TOKEN"))
+		})
+
+		It("ignores environment variables that name no setting when lenient", func() {
+			var warnings []string
+			cfg, _, err := config.Loader{
+				Environment: []string{"CONFAB_STRAY=1", "CONFAB_CONSUL__AGENT__LOG_LEVEL=warn"},
+				Lenient:     true,
+				Warn: func(message string) {
+					warnings = append(warnings, message)
+				},
+			}.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Consul.Agent.LogLevel).To(Equal("warn"))
+			Expect(warnings).To(Equal([]string{`environment variable CONFAB_STRAY: there is no setting "stray", ignoring it`}))
+		})
+
+		It("loads the defaults without any layers", func() {
+			cfg, provenance, err := config.Loader{}.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg).To(Equal(config.Default()))
+			Expect(provenance).To(BeEmpty())
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when a file cannot be read", func() {
+				_, _, err := config.Loader{Files: []string{filepath.Join(configDir, "missing.json")}}.Load()
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+			})
+
+			It("names the file that cannot be parsed", func() {
+				invalid := writeFile("invalid.json", `{%%%`)
+				_, _, err := config.Loader{Files: []string{base, invalid}}.Load()
+				Expect(err).To(MatchError(ContainSubstring("parsing config file " + invalid)))
+
+				invalid = writeFile("invalid.yaml", "consul: [")
+				_, _, err = config.Loader{Files: []string{invalid}}.Load()
+				Expect(err).To(MatchError(ContainSubstring("parsing config file " + invalid)))
+			})
+
+			It("rejects files that do not hold an object", func() {
+				list := writeFile("list.yml", "- consul")
+				_, _, err := config.Loader{Files: []string{list}}.Load()
+				Expect(err).To(MatchError("config file " + list + " must hold an object"))
+			})
+
+			It("rejects files with keys that name no setting unless lenient", func() {
+				typo := writeFile("typo.json", `{"consul": {"agent": {"log_levle": "debug"}}}`)
+
+				_, _, err := config.Loader{Files: []string{base, typo}}.Load()
+				Expect(err).To(MatchError("config file " + typo + ": unknown settings: consul.agent.log_levle"))
+
+				cfg, _, err := config.Loader{Files: []string{base, typo}, Lenient: true}.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cfg.Consul.Agent.LogLevel).To(Equal("info"))
+			})
+
+			It("rejects files of a newer schema version", func() {
+				newer := writeFile("newer.json", `{"schema_version": 3}`)
+
+				_, _, err := config.Loader{Files: []string{newer}}.Load()
+				Expect(err).To(MatchError(`config file ` + newer + `: "schema_version" 3 is not supported, this confab reads versions 1 to 2`))
+			})
+
+			It("rejects environment variables for settings that do not exist", func() {
+				_, _, err := config.Loader{Environment: []string{"CONFAB_CONSUL__AGENT__LOGLEVEL=debug"}}.Load()
+				Expect(err).To(MatchError(`environment variable CONFAB_CONSUL__AGENT__LOGLEVEL: there is no setting "consul.agent.loglevel"`))
+			})
+
+			It("rejects environment variables that are not JSON for non-string settings", func() {
+				_, _, err := config.Loader{Environment: []string{"CONFAB_CONFAB__TIMEOUT_IN_SECONDS=soon"}}.Load()
+				Expect(err).To(MatchError(ContainSubstring("environment variable CONFAB_CONFAB__TIMEOUT_IN_SECONDS: value must be JSON for a setting of type int")))
+			})
+		})
+	})
+
+	Describe("EffectiveSettings", func() {
+		It("lists every setting with its source and redacts encryption keys", func() {
+			cfg, provenance, err := config.Loader{
+				Files:       []string{base},
+				Environment: []string{`CONFAB_CONSUL__ENCRYPT_KEYS=["secret-key"]`},
+			}.Load()
+			Expect(err).NotTo(HaveOccurred())
+
+			settings, err := config.EffectiveSettings(cfg, provenance)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(settings).To(ContainElement(config.Setting{Path: "consul.agent.mode", Value: `"server"`, Source: base}))
+			Expect(settings).To(ContainElement(config.Setting{Path: "consul.agent.servers.lan", Value: `["10.0.0.1","10.0.0.2"]`, Source: base}))
+			Expect(settings).To(ContainElement(config.Setting{Path: "confab.timeout_in_seconds", Value: "55", Source: "default"}))
+			Expect(settings).To(ContainElement(config.Setting{
+				Path:   "consul.encrypt_keys",
+				Value:  `"[redacted]"`,
+				Source: "env:CONFAB_CONSUL__ENCRYPT_KEYS",
+			}))
+
+			for i := 1; i < len(settings); i++ {
+				Expect(settings[i-1].Path < settings[i].Path).To(BeTrue())
+			}
+		})
+
+		It("redacts tokens the same way render does", func() {
+			cfg := config.Default()
+			cfg.Consul.Agent.ExtraConfig = map[string]interface{}{
+				"acl_agent_token": "agent-secret",
+				"acl": map[string]interface{}{
+					"tokens": map[string]interface{}{"default": "default-secret"},
+				},
+				"ui": true,
+			}
+
+			settings, err := config.EffectiveSettings(cfg, config.Provenance{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(settings).To(ContainElement(config.Setting{Path: "consul.agent.extra_config.acl_agent_token", Value: `"[redacted]"`, Source: "default"}))
+			Expect(settings).To(ContainElement(config.Setting{Path: "consul.agent.extra_config.acl.tokens.default", Value: `"[redacted]"`, Source: "default"}))
+			Expect(settings).To(ContainElement(config.Setting{Path: "consul.agent.extra_config.ui", Value: "true", Source: "default"}))
+		})
+	})
+})
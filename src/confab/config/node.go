@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultNodeNameTemplate names nodes after their job and index, which is
+// how confab has always named them.
+const DefaultNodeNameTemplate = "{{.Name}}-{{.Index}}"
+
+const (
+	maxNodeNameLength   = 63
+	maxNodeMetaPairs    = 64
+	maxNodeMetaKeyLen   = 128
+	maxNodeMetaValueLen = 512
+)
+
+var (
+	nodeNamePattern    = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+	nodeMetaKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// NodeName renders the node name template. Underscores, which consul does not
+// allow in DNS-compatible names, are replaced with dashes.
+func NodeName(node ConfigNode) (string, error) {
+	nameTemplate := node.NameTemplate
+	if nameTemplate == "" {
+		nameTemplate = DefaultNodeNameTemplate
+	}
+
+	t, err := template.New("node_name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("\"name_template\" %q could not be parsed: %s", nameTemplate, err)
+	}
+
+	var name bytes.Buffer
+	if err := t.Execute(&name, node); err != nil {
+		return "", fmt.Errorf("\"name_template\" %q could not be rendered: %s", nameTemplate, err)
+	}
+
+	return strings.Replace(name.String(), "_", "-", -1), nil
+}
+
+// NodeMeta is the custom metadata, along with the instance's az, deployment
+// and id when InstanceMeta is set. Custom keys take precedence.
+func NodeMeta(node ConfigNode) map[string]string {
+	meta := map[string]string{}
+
+	if node.InstanceMeta {
+		instance := map[string]string{
+			"az":          node.AZ,
+			"deployment":  node.Deployment,
+			"instance_id": node.ID,
+		}
+
+		for key, value := range instance {
+			if value != "" {
+				meta[key] = value
+			}
+		}
+	}
+
+	for key, value := range node.Meta {
+		meta[key] = value
+	}
+
+	return meta
+}
+
+func validateNode(node ConfigNode) error {
+	name, err := NodeName(node)
+	if err != nil {
+		return err
+	}
+
+	// Without a template the name is passed through as it always has been;
+	// consul only warns about names it cannot serve over DNS.
+	if node.NameTemplate != "" && (len(name) > maxNodeNameLength || !nodeNamePattern.MatchString(name)) {
+		return fmt.Errorf("node name %q must be 1 to %d letters, digits or dashes", name, maxNodeNameLength)
+	}
+
+	meta := NodeMeta(node)
+	if len(meta) > maxNodeMetaPairs {
+		return fmt.Errorf("\"meta\" cannot have more than %d keys, got %d", maxNodeMetaPairs, len(meta))
+	}
+
+	for key, value := range meta {
+		switch {
+		case len(key) > maxNodeMetaKeyLen || !nodeMetaKeyPattern.MatchString(key):
+			return fmt.Errorf("\"meta\" key %q must be 1 to %d letters, digits, dashes or underscores", key, maxNodeMetaKeyLen)
+		case strings.HasPrefix(key, "consul-"):
+			return fmt.Errorf("\"meta\" key %q cannot use the reserved \"consul-\" prefix", key)
+		case len(value) > maxNodeMetaValueLen:
+			return fmt.Errorf("\"meta\" value for %q cannot be longer than %d characters", key, maxNodeMetaValueLen)
+		}
+	}
+
+	return nil
+}
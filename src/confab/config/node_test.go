@@ -0,0 +1,78 @@
+package config_test
+
+import (
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Node", func() {
+	var node config.ConfigNode
+
+	BeforeEach(func() {
+		node = config.ConfigNode{
+			Name:       "consul_server",
+			Index:      2,
+			AZ:         "z1",
+			Deployment: "cf",
+			ID:         "8f3b1a2c-6d7e-4f90-a1b2-c3d4e5f60718",
+		}
+	})
+
+	Describe("NodeName", func() {
+		It("defaults to the name and index with dashes for underscores", func() {
+			name, err := config.NodeName(node)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("consul-server-2"))
+		})
+
+		It("renders the name template", func() {
+			node.NameTemplate = "{{.Deployment}}-{{.AZ}}-{{.Name}}-{{.Index}}"
+
+			name, err := config.NodeName(node)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("cf-z1-consul-server-2"))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the template cannot be parsed", func() {
+				node.NameTemplate = "{{.Name"
+
+				_, err := config.NodeName(node)
+				Expect(err).To(MatchError(ContainSubstring(`"name_template" "{{.Name" could not be parsed`)))
+			})
+
+			It("returns an error when the template refers to an unknown field", func() {
+				node.NameTemplate = "{{.Job}}"
+
+				_, err := config.NodeName(node)
+				Expect(err).To(MatchError(ContainSubstring(`"name_template" "{{.Job}}" could not be rendered`)))
+			})
+		})
+	})
+
+	Describe("NodeMeta", func() {
+		It("is empty by default", func() {
+			Expect(config.NodeMeta(node)).To(BeEmpty())
+		})
+
+		It("includes the custom metadata", func() {
+			node.Meta = map[string]string{"rack": "r12"}
+
+			Expect(config.NodeMeta(node)).To(Equal(map[string]string{"rack": "r12"}))
+		})
+
+		It("includes the instance's az, deployment and id when asked to", func() {
+			node.InstanceMeta = true
+			node.Meta = map[string]string{"rack": "r12", "az": "custom-az"}
+
+			Expect(config.NodeMeta(node)).To(Equal(map[string]string{
+				"az":          "custom-az",
+				"deployment":  "cf",
+				"instance_id": "8f3b1a2c-6d7e-4f90-a1b2-c3d4e5f60718",
+				"rack":        "r12",
+			}))
+		})
+	})
+})
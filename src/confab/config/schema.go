@@ -0,0 +1,302 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+)
+
+// CurrentSchemaVersion is the layout of the configuration files this confab
+// reads. Files without a schema_version are version 1: they were decoded by
+// encoding/json, which matches keys regardless of case and ignores keys it
+// does not know. Version 2 requires every key to be spelled exactly as
+// documented.
+const CurrentSchemaVersion = 2
+
+const schemaVersionKey = "schema_version"
+
+// schemaMigrations upgrade a layout of the version they are keyed by to the
+// next version, returning a warning for each setting they drop.
+var schemaMigrations = map[int]func(map[string]interface{}) (map[string]interface{}, []string){
+	1: migrateV1,
+}
+
+// v1CertKeys are the inline certificates and keys the version 1 job template
+// rendered under "consul". The job writes them to files in path.certs_dir
+// now, where confab reads them from.
+var v1CertKeys = []string{"ca_cert", "server_cert", "server_key", "agent_cert", "agent_key"}
+
+// UnknownSettingsError lists the keys of a configuration layer that do not
+// name a setting.
+type UnknownSettingsError struct {
+	Paths []string
+}
+
+func (e UnknownSettingsError) Error() string {
+	return fmt.Sprintf("unknown settings: %s", strings.Join(e.Paths, ", "))
+}
+
+// SchemaVersion returns the schema version a configuration layer declares,
+// or 1 when it does not declare one.
+func SchemaVersion(layer map[string]interface{}) (int, error) {
+	value, ok := layer[schemaVersionKey]
+	if !ok {
+		return 1, nil
+	}
+
+	var version int
+	switch value := value.(type) {
+	case float64:
+		version = int(value)
+		if float64(version) != value {
+			return 0, fmt.Errorf("%q must be a whole number, got %v", schemaVersionKey, value)
+		}
+	case int:
+		version = value
+	case int64:
+		version = int(value)
+	default:
+		return 0, fmt.Errorf("%q must be a number, got %v", schemaVersionKey, value)
+	}
+
+	if version < 1 || version > CurrentSchemaVersion {
+		return 0, fmt.Errorf("%q %d is not supported, this confab reads versions 1 to %d", schemaVersionKey, version, CurrentSchemaVersion)
+	}
+
+	return version, nil
+}
+
+// MigrateLayer upgrades a configuration layer to the current schema version
+// and returns it along with the version it declared and a warning for each
+// setting the upgrade dropped.
+func MigrateLayer(layer map[string]interface{}) (map[string]interface{}, int, []string, error) {
+	version, err := SchemaVersion(layer)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var warnings []string
+	for v := version; v < CurrentSchemaVersion; v++ {
+		var dropped []string
+		layer, dropped = schemaMigrations[v](layer)
+		warnings = append(warnings, dropped...)
+	}
+	layer[schemaVersionKey] = CurrentSchemaVersion
+
+	return layer, version, warnings, nil
+}
+
+// MigrateFile rewrites a configuration file in the current schema version,
+// keeping its format, and returns the version the file had and a warning for
+// each setting the upgrade dropped. Files that are current already are left
+// untouched, and so are files with keys that name no setting.
+func MigrateFile(path string) (int, []string, error) {
+	layer, err := readConfigFile(path)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	layer, version, warnings, err := MigrateLayer(layer)
+	if err != nil {
+		return 0, nil, fmt.Errorf("config file %s: %s", path, err)
+	}
+
+	if err := CheckUnknownSettings(layer); err != nil {
+		return 0, nil, fmt.Errorf("config file %s: %s", path, err)
+	}
+
+	if version == CurrentSchemaVersion {
+		return version, nil, nil
+	}
+
+	var data []byte
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml":
+		data, err = candiedyaml.Marshal(layer)
+	default:
+		data, err = json.MarshalIndent(layer, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := replaceFile(path, data); err != nil {
+		return 0, nil, err
+	}
+
+	return version, warnings, nil
+}
+
+// replaceFile writes the data next to the file and renames it over the
+// file, so readers see either the old or the new contents.
+func replaceFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(temp.Name(), info.Mode()); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+// CheckUnknownSettings returns an UnknownSettingsError naming every key of
+// the layer that is not the exact JSON name of a setting.
+func CheckUnknownSettings(layer map[string]interface{}) error {
+	var unknown []string
+	walkSettings(layer, reflect.TypeOf(Config{}), "", func(parent reflect.Type, path, key string) string {
+		unknown = append(unknown, path)
+		return ""
+	})
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return UnknownSettingsError{Paths: unknown}
+	}
+
+	return nil
+}
+
+// migrateV1 renames the keys of a version 1 layer to the settings they
+// matched regardless of case and drops the inline certificates.
+func migrateV1(layer map[string]interface{}) (map[string]interface{}, []string) {
+	layer = canonicalKeys(layer)
+
+	consul, ok := layer["consul"].(map[string]interface{})
+	if !ok {
+		return layer, nil
+	}
+
+	var keys []string
+	for key := range consul {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var warnings []string
+	for _, key := range keys {
+		for _, certKey := range v1CertKeys {
+			if strings.EqualFold(key, certKey) {
+				delete(consul, key)
+				warnings = append(warnings, fmt.Sprintf("dropped %q, certificates and keys are read from the files in path.certs_dir", joinPath("consul", key)))
+			}
+		}
+	}
+
+	return layer, warnings
+}
+
+// canonicalKeys renames keys that only match a setting when compared
+// regardless of case, such as "Consul" or "LAN", to the setting's name.
+func canonicalKeys(layer map[string]interface{}) map[string]interface{} {
+	walkSettings(layer, reflect.TypeOf(Config{}), "", func(parent reflect.Type, path, key string) string {
+		return caseInsensitiveField(parent, key)
+	})
+
+	return layer
+}
+
+// walkSettings calls visit for every key of the objects in value, which
+// describes a value of type t, that does not name a field of its struct.
+// visit may return the name of a field to rename the key to.
+func walkSettings(value interface{}, t reflect.Type, path string, visit func(parent reflect.Type, path, key string) string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		var keys []string
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if path == "" && key == schemaVersionKey {
+				continue
+			}
+
+			child := object[key]
+			field, ok := jsonField(t, key)
+			if !ok {
+				rename := visit(t, joinPath(path, key), key)
+				if _, exists := object[rename]; rename == "" || exists {
+					continue
+				}
+
+				delete(object, key)
+				object[rename] = child
+				key = rename
+				field, _ = jsonField(t, key)
+			}
+
+			walkSettings(child, field.Type, joinPath(path, key), visit)
+		}
+	case reflect.Map:
+		if object, ok := value.(map[string]interface{}); ok {
+			for key, child := range object {
+				walkSettings(child, t.Elem(), joinPath(path, key), visit)
+			}
+		}
+	case reflect.Slice:
+		if list, ok := value.([]interface{}); ok {
+			for i, child := range list {
+				walkSettings(child, t.Elem(), fmt.Sprintf("%s[%d]", path, i), visit)
+			}
+		}
+	}
+}
+
+// caseInsensitiveField returns the JSON name of the field of t that matches
+// the key regardless of case, as encoding/json would.
+func caseInsensitiveField(t reflect.Type, key string) string {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		if strings.EqualFold(name, key) {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// envSecretPrefix marks a secret source that names an environment variable
+// rather than a file, e.g. "env:CONSUL_AGENT_TOKEN".
+const envSecretPrefix = "env:"
+
+// LoadSecrets resolves the secrets that are referenced rather than given
+// inline: gossip keys from "encrypt_keys_file" or "env:" entries of
+// "encrypt_keys", and the acl tokens. Errors name the setting and where the
+// secret was looked for, never the secret itself.
+func LoadSecrets(cfg Config) (Config, error) {
+	keys, err := loadEncryptKeys(cfg.Consul)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Consul.EncryptKeys = keys
+
+	return LoadACLTokens(cfg)
+}
+
+func loadEncryptKeys(consul ConfigConsul) ([]string, error) {
+	if consul.EncryptKeysFile != "" {
+		if len(consul.EncryptKeys) > 0 {
+			return nil, fmt.Errorf("only one of \"encrypt_keys\" and \"encrypt_keys_file\" can be provided")
+		}
+
+		contents, err := readSecret("encrypt keys", "encrypt_keys_file", consul.EncryptKeysFile)
+		if err != nil {
+			return nil, err
+		}
+
+		var keys []string
+		for _, line := range strings.Split(contents, "\n") {
+			if key := strings.TrimSpace(line); key != "" {
+				keys = append(keys, key)
+			}
+		}
+
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("\"encrypt_keys_file\" %s holds no keys", consul.EncryptKeysFile)
+		}
+
+		return keys, nil
+	}
+
+	var keys []string
+	for _, key := range consul.EncryptKeys {
+		if strings.HasPrefix(key, envSecretPrefix) {
+			var err error
+			key, err = readSecret("encrypt key", "encrypt_keys", key)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// readSecret reads a secret from its source, either a file or an "env:"
+// reference, trimming surrounding whitespace.
+func readSecret(kind, setting, source string) (string, error) {
+	if strings.HasPrefix(source, envSecretPrefix) {
+		name := strings.TrimPrefix(source, envSecretPrefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("could not read %s for %q: environment variable %q is not set", kind, setting, name)
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return "", fmt.Errorf("could not read %s for %q: environment variable %q is empty", kind, setting, name)
+		}
+
+		return value, nil
+	}
+
+	contents, err := ioutil.ReadFile(source)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s file: %s", kind, err)
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
@@ -0,0 +1,109 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadSecrets", func() {
+	var (
+		secretsDir string
+		cfg        config.Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		secretsDir, err = ioutil.TempDir("", "secrets")
+		Expect(err).NotTo(HaveOccurred())
+
+		cfg = config.Default()
+		os.Setenv("CONFAB_TEST_GOSSIP_KEY", " key-from-env\n")
+		os.Setenv("CONFAB_TEST_AGENT_TOKEN", "agent-token-from-env")
+		os.Setenv("CONFAB_TEST_EMPTY", " ")
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("CONFAB_TEST_GOSSIP_KEY")
+		os.Unsetenv("CONFAB_TEST_AGENT_TOKEN")
+		os.Unsetenv("CONFAB_TEST_EMPTY")
+		Expect(os.RemoveAll(secretsDir)).To(Succeed())
+	})
+
+	writeSecret := func(name, contents string) string {
+		path := filepath.Join(secretsDir, name)
+		Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		return path
+	}
+
+	It("reads the encrypt keys from a file, one per line", func() {
+		cfg.Consul.EncryptKeysFile = writeSecret("keys", "key-1\n\n  key-2  \n")
+
+		loaded, err := config.LoadSecrets(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Consul.EncryptKeys).To(Equal([]string{"key-1", "key-2"}))
+	})
+
+	It("resolves env references among the inline encrypt keys", func() {
+		cfg.Consul.EncryptKeys = []string{"env:CONFAB_TEST_GOSSIP_KEY", "inline-key"}
+
+		loaded, err := config.LoadSecrets(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Consul.EncryptKeys).To(Equal([]string{"key-from-env", "inline-key"}))
+	})
+
+	It("reads acl tokens from env references", func() {
+		cfg.Consul.Agent.ACL.AgentTokenFile = "env:CONFAB_TEST_AGENT_TOKEN"
+
+		loaded, err := config.LoadSecrets(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Consul.Agent.ACL.AgentToken).To(Equal("agent-token-from-env"))
+	})
+
+	It("leaves a configuration without secret references alone", func() {
+		loaded, err := config.LoadSecrets(config.Default())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(config.Default()))
+	})
+
+	Context("failure cases", func() {
+		It("names the missing environment variable and the setting referencing it", func() {
+			cfg.Consul.EncryptKeys = []string{"env:CONFAB_TEST_MISSING"}
+
+			_, err := config.LoadSecrets(cfg)
+			Expect(err).To(MatchError(`could not read encrypt key for "encrypt_keys": environment variable "CONFAB_TEST_MISSING" is not set`))
+
+			cfg.Consul.EncryptKeys = nil
+			cfg.Consul.Agent.ACL.ServicePolicies = map[string]config.ConfigConsulAgentACLPolicy{
+				"router": {TokenFile: "env:CONFAB_TEST_EMPTY"},
+			}
+
+			_, err = config.LoadSecrets(cfg)
+			Expect(err).To(MatchError(`could not read acl token for "service_policies.router.token_file": environment variable "CONFAB_TEST_EMPTY" is empty`))
+		})
+
+		It("names the encrypt keys file that cannot be read or holds no keys", func() {
+			cfg.Consul.EncryptKeysFile = filepath.Join(secretsDir, "missing")
+
+			_, err := config.LoadSecrets(cfg)
+			Expect(err).To(MatchError(ContainSubstring("could not read encrypt keys file: open " + cfg.Consul.EncryptKeysFile)))
+
+			cfg.Consul.EncryptKeysFile = writeSecret("empty", "\n\n")
+			_, err = config.LoadSecrets(cfg)
+			Expect(err).To(MatchError(`"encrypt_keys_file" ` + cfg.Consul.EncryptKeysFile + ` holds no keys`))
+		})
+
+		It("rejects encrypt keys given both inline and in a file", func() {
+			cfg.Consul.EncryptKeys = []string{"inline-key"}
+			cfg.Consul.EncryptKeysFile = writeSecret("keys", "key-1")
+
+			_, err := config.LoadSecrets(cfg)
+			Expect(err).To(MatchError(`only one of "encrypt_keys" and "encrypt_keys_file" can be provided`))
+		})
+	})
+})
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Resolver looks up the servers listed by name. NetResolver uses the
+// system's resolver.
+type Resolver interface {
+	LookupHost(host string) ([]string, error)
+	LookupSRV(service, proto, name string) (string, []*net.SRV, error)
+}
+
+type NetResolver struct{}
+
+func (NetResolver) LookupHost(host string) ([]string, error) {
+	return net.LookupHost(host)
+}
+
+func (NetResolver) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	return net.LookupSRV(service, proto, name)
+}
+
+// ResolveServers turns server entries into addresses the agent can join.
+// IP addresses, with or without a port, are kept as they are. Names that
+// start with an underscore, such as _consul._tcp.service.cf.internal, are
+// SRV records and resolve to the address and port of each target. Any other
+// name resolves to all of its addresses. The result keeps the order of the
+// entries and drops duplicates.
+func ResolveServers(resolver Resolver, servers []string) ([]string, error) {
+	var resolved []string
+	seen := map[string]bool{}
+	add := func(address string) {
+		if !seen[address] {
+			seen[address] = true
+			resolved = append(resolved, address)
+		}
+	}
+
+	for _, server := range servers {
+		host, port := splitServer(server)
+
+		switch {
+		case net.ParseIP(host) != nil:
+			add(server)
+		case strings.HasPrefix(host, "_"):
+			_, records, err := resolver.LookupSRV("", "", host)
+			if err != nil {
+				return nil, fmt.Errorf("resolving server %q: %s", server, err)
+			}
+
+			for _, record := range records {
+				addresses, err := lookupHost(resolver, strings.TrimSuffix(record.Target, "."))
+				if err != nil {
+					return nil, fmt.Errorf("resolving server %q: %s", server, err)
+				}
+
+				for _, address := range addresses {
+					add(net.JoinHostPort(address, strconv.Itoa(int(record.Port))))
+				}
+			}
+		default:
+			addresses, err := lookupHost(resolver, host)
+			if err != nil {
+				return nil, fmt.Errorf("resolving server %q: %s", server, err)
+			}
+
+			for _, address := range addresses {
+				if port != "" {
+					address = net.JoinHostPort(address, port)
+				}
+				add(address)
+			}
+		}
+	}
+
+	if len(servers) > 0 && len(resolved) == 0 {
+		return nil, fmt.Errorf("servers %s resolved to no addresses", strings.Join(servers, ", "))
+	}
+
+	return resolved, nil
+}
+
+// IsServerAddress reports whether the server entry is an IP address, with or
+// without a port, rather than a name that needs to be resolved.
+func IsServerAddress(server string) bool {
+	host, _ := splitServer(server)
+	return net.ParseIP(host) != nil
+}
+
+func lookupHost(resolver Resolver, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	return resolver.LookupHost(host)
+}
+
+func splitServer(server string) (string, string) {
+	if host, port, err := net.SplitHostPort(server); err == nil {
+		return host, port
+	}
+
+	return server, ""
+}
@@ -0,0 +1,94 @@
+package config_test
+
+import (
+	"errors"
+	"net"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Servers", func() {
+	Describe("ResolveServers", func() {
+		var resolver *fakes.Resolver
+
+		BeforeEach(func() {
+			resolver = &fakes.Resolver{}
+			resolver.LookupHostCall.Returns.Addresses = map[string][]string{
+				"consul.service.internal": {"10.0.0.1", "10.0.0.2"},
+				"server-3.internal":       {"10.0.0.3"},
+			}
+			resolver.LookupSRVCall.Returns.Records = map[string][]*net.SRV{
+				"_consul._tcp.internal": {
+					{Target: "server-3.internal.", Port: 8301},
+					{Target: "10.0.0.4", Port: 8302},
+				},
+			}
+		})
+
+		It("keeps addresses and resolves names and SRV records", func() {
+			servers, err := config.ResolveServers(resolver, []string{
+				"10.0.0.9",
+				"[fd00::9]:8301",
+				"consul.service.internal",
+				"server-3.internal:8301",
+				"_consul._tcp.internal",
+				"10.0.0.1",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(servers).To(Equal([]string{
+				"10.0.0.9",
+				"[fd00::9]:8301",
+				"10.0.0.1",
+				"10.0.0.2",
+				"10.0.0.3:8301",
+				"10.0.0.4:8302",
+			}))
+			Expect(resolver.LookupSRVCall.Receives.Name).To(Equal("_consul._tcp.internal"))
+		})
+
+		It("does not look anything up for addresses", func() {
+			servers, err := config.ResolveServers(resolver, []string{"10.0.0.1", "10.0.0.2:8301"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(servers).To(Equal([]string{"10.0.0.1", "10.0.0.2:8301"}))
+			Expect(resolver.LookupHostCall.CallCount).To(Equal(0))
+			Expect(resolver.LookupSRVCall.CallCount).To(Equal(0))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when a name cannot be resolved", func() {
+				resolver.LookupHostCall.Returns.Error = errors.New("lookup failed")
+
+				_, err := config.ResolveServers(resolver, []string{"consul.service.internal"})
+				Expect(err).To(MatchError(`resolving server "consul.service.internal": lookup failed`))
+			})
+
+			It("returns an error when an SRV record cannot be resolved", func() {
+				resolver.LookupSRVCall.Returns.Error = errors.New("lookup failed")
+
+				_, err := config.ResolveServers(resolver, []string{"_consul._tcp.internal"})
+				Expect(err).To(MatchError(`resolving server "_consul._tcp.internal": lookup failed`))
+			})
+
+			It("returns an error when nothing resolves to an address", func() {
+				resolver.LookupSRVCall.Returns.Records["_consul._tcp.internal"] = nil
+
+				_, err := config.ResolveServers(resolver, []string{"_consul._tcp.internal"})
+				Expect(err).To(MatchError("servers _consul._tcp.internal resolved to no addresses"))
+			})
+		})
+	})
+
+	Describe("IsServerAddress", func() {
+		It("tells addresses from names", func() {
+			Expect(config.IsServerAddress("10.0.0.1")).To(BeTrue())
+			Expect(config.IsServerAddress("10.0.0.1:8301")).To(BeTrue())
+			Expect(config.IsServerAddress("fd00::1")).To(BeTrue())
+			Expect(config.IsServerAddress("consul.service.internal")).To(BeFalse())
+			Expect(config.IsServerAddress("_consul._tcp.internal")).To(BeFalse())
+		})
+	})
+})
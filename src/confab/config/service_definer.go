@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pivotal-golang/lager"
 )
@@ -29,6 +31,20 @@ type ServiceDefinition struct {
 	EnableTagOverride bool                     `json:"enableTagOverride,omitempty"`
 	ID                string                   `json:"id,omitempty"`
 	Token             string                   `json:"token,omitempty"`
+
+	// DefaultCheck and Instances are only read from the confab configuration
+	// and are never written into the definitions given to consul.
+	DefaultCheck *bool             `json:"default_check,omitempty"`
+	Instances    []ServiceInstance `json:"instances,omitempty"`
+}
+
+// ServiceInstance registers another copy of a service, such as a second
+// process listening on its own port.
+type ServiceInstance struct {
+	ID      string   `json:"id"`
+	Address string   `json:"address"`
+	Port    int      `json:"port"`
+	Tags    []string `json:"tags"`
 }
 
 type ServiceDefinitionCheck struct {
@@ -45,6 +61,13 @@ type ServiceDefinitionCheck struct {
 	Shell             string `json:"shell,omitempty"`
 	Status            string `json:"status,omitempty"`
 	ServiceID         string `json:"service_id,omitempty"`
+
+	GRPC                           string              `json:"grpc,omitempty"`
+	GRPCUseTLS                     bool                `json:"grpc_use_tls,omitempty"`
+	Method                         string              `json:"method,omitempty"`
+	Header                         map[string][]string `json:"header,omitempty"`
+	TLSSkipVerify                  bool                `json:"tls_skip_verify,omitempty"`
+	DeregisterCriticalServiceAfter string              `json:"deregister_critical_service_after,omitempty"`
 }
 
 type ServiceDefiner struct {
@@ -59,13 +82,8 @@ func (s ServiceDefiner) GenerateDefinitions(config Config) []ServiceDefinition {
 			"service": name,
 		})
 		definition := ServiceDefinition{
-			ServiceName: name,
-			Name:        strings.Replace(name, "_", "-", -1),
-			Check: &ServiceDefinitionCheck{
-				Name:     "dns_health_check",
-				Script:   fmt.Sprintf("/var/vcap/jobs/%s/bin/dns_health_check", name),
-				Interval: "3s",
-			},
+			ServiceName:       name,
+			Name:              strings.Replace(name, "_", "-", -1),
 			Checks:            service.Checks,
 			Tags:              []string{fmt.Sprintf("%s-%d", strings.Replace(config.Node.Name, "_", "-", -1), config.Node.Index)},
 			Address:           service.Address,
@@ -75,6 +93,14 @@ func (s ServiceDefiner) GenerateDefinitions(config Config) []ServiceDefinition {
 			Token:             service.Token,
 		}
 
+		if service.DefaultCheck == nil || *service.DefaultCheck {
+			definition.Check = &ServiceDefinitionCheck{
+				Name:     "dns_health_check",
+				Script:   fmt.Sprintf("/var/vcap/jobs/%s/bin/dns_health_check", name),
+				Interval: "3s",
+			}
+		}
+
 		if service.Name != "" {
 			definition.Name = service.Name
 		}
@@ -87,7 +113,34 @@ func (s ServiceDefiner) GenerateDefinitions(config Config) []ServiceDefinition {
 			definition.Tags = service.Tags
 		}
 
-		definitions = append(definitions, definition)
+		if policy, ok := config.Consul.Agent.ACL.ServicePolicies[name]; ok && definition.Token == "" {
+			definition.Token = policy.Token
+		}
+
+		if len(service.Instances) == 0 {
+			definitions = append(definitions, definition)
+			continue
+		}
+
+		for i, instance := range service.Instances {
+			instanceDefinition := definition
+			instanceDefinition.ServiceName = fmt.Sprintf("%s-%d", name, i)
+			instanceDefinition.ID = instanceID(definition.Name, i, instance)
+
+			if instance.Address != "" {
+				instanceDefinition.Address = instance.Address
+			}
+
+			if instance.Port != 0 {
+				instanceDefinition.Port = instance.Port
+			}
+
+			if instance.Tags != nil {
+				instanceDefinition.Tags = instance.Tags
+			}
+
+			definitions = append(definitions, instanceDefinition)
+		}
 	}
 
 	return definitions
@@ -109,6 +162,9 @@ func (s ServiceDefiner) WriteDefinitions(configDir string, definitions []Service
 			return err
 		}
 
+		definition.DefaultCheck = nil
+		definition.Instances = nil
+
 		err = json.NewEncoder(file).Encode(map[string]ServiceDefinition{
 			"service": definition,
 		})
@@ -126,3 +182,125 @@ func (s ServiceDefiner) WriteDefinitions(configDir string, definitions []Service
 	}
 	return nil
 }
+
+// instanceID defaults to the service name and the position of the instance,
+// as every instance needs an ID that is unique on the agent.
+func instanceID(name string, index int, instance ServiceInstance) string {
+	if instance.ID != "" {
+		return instance.ID
+	}
+
+	return fmt.Sprintf("%s-%d", name, index)
+}
+
+func validateServices(services map[string]ServiceDefinition) error {
+	var names []string
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ids := map[string]string{}
+	for _, name := range names {
+		service := services[name]
+
+		serviceName := strings.Replace(name, "_", "-", -1)
+		if service.Name != "" {
+			serviceName = service.Name
+		}
+
+		var serviceIDs []string
+		if len(service.Instances) == 0 {
+			serviceID := serviceName
+			if service.ID != "" {
+				serviceID = service.ID
+			}
+			serviceIDs = append(serviceIDs, serviceID)
+		}
+
+		for i, instance := range service.Instances {
+			if instance.Port < 0 || instance.Port > 65535 {
+				return fmt.Errorf("service %q instance %d port must be between 0 and 65535, got %d", name, i, instance.Port)
+			}
+
+			serviceIDs = append(serviceIDs, instanceID(serviceName, i, instance))
+		}
+
+		for _, id := range serviceIDs {
+			if other, ok := ids[id]; ok {
+				return fmt.Errorf("service %q and service %q both register the id %q", other, name, id)
+			}
+			ids[id] = name
+		}
+
+		checks := service.Checks
+		if service.Check != nil {
+			checks = append([]ServiceDefinitionCheck{*service.Check}, checks...)
+		}
+
+		for _, check := range checks {
+			if err := validateCheck(check); err != nil {
+				return fmt.Errorf("service %q check %q %s", name, check.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateCheck(check ServiceDefinitionCheck) error {
+	var kinds []string
+	for kind, value := range map[string]string{
+		"script": check.Script,
+		"http":   check.HTTP,
+		"tcp":    check.TCP,
+		"ttl":    check.TTL,
+		"grpc":   check.GRPC,
+	} {
+		if value != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	if len(kinds) != 1 {
+		return errors.New("must define exactly one of script, http, tcp, ttl or grpc")
+	}
+
+	if check.DockerContainerID != "" && check.Script == "" {
+		return errors.New("must define a script to run in the docker container")
+	}
+
+	switch {
+	case check.TTL != "" && check.Interval != "":
+		return errors.New("must not define an interval as it is a ttl check")
+	case check.TTL == "" && check.Interval == "":
+		return errors.New("must define an interval")
+	}
+
+	durations := []struct {
+		name  string
+		value string
+	}{
+		{"interval", check.Interval},
+		{"timeout", check.Timeout},
+		{"ttl", check.TTL},
+		{"deregister_critical_service_after", check.DeregisterCriticalServiceAfter},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration such as \"10s\", got %q", d.name, d.value)
+		}
+
+		if duration <= 0 {
+			return fmt.Errorf("%s must be positive, got %q", d.name, d.value)
+		}
+	}
+
+	return nil
+}
@@ -413,6 +413,42 @@ var _ = Describe("ServiceDefiner", func() {
 			}))
 		})
 
+		It("generates definitions with the token from the service acl policy", func() {
+			definitions := definer.GenerateDefinitions(config.Config{
+				Node: config.ConfigNode{
+					Name:  "some_node",
+					Index: 0,
+				},
+				Consul: config.ConfigConsul{
+					Agent: config.ConfigConsulAgent{
+						Services: map[string]config.ServiceDefinition{
+							"router": {},
+						},
+						ACL: config.ConfigConsulAgentACL{
+							ServicePolicies: map[string]config.ConfigConsulAgentACLPolicy{
+								"router": {
+									Token: "some-policy-token",
+								},
+							},
+						},
+					},
+				},
+			})
+			Expect(definitions).To(ConsistOf([]config.ServiceDefinition{
+				{
+					ServiceName: "router",
+					Name:        "router",
+					Token:       "some-policy-token",
+					Check: &config.ServiceDefinitionCheck{
+						Name:     "dns_health_check",
+						Script:   "/var/vcap/jobs/router/bin/dns_health_check",
+						Interval: "3s",
+					},
+					Tags: []string{"some-node-0"},
+				},
+			}))
+		})
+
 		It("generates definitions with a check type given the overrides", func() {
 			definitions := definer.GenerateDefinitions(config.Config{
 				Node: config.ConfigNode{
@@ -466,6 +502,106 @@ var _ = Describe("ServiceDefiner", func() {
 				},
 			}))
 		})
+
+		It("generates a definition without the default check when it is disabled", func() {
+			falseValue := false
+			definitions := definer.GenerateDefinitions(config.Config{
+				Node: config.ConfigNode{
+					Name:  "some_node",
+					Index: 0,
+				},
+				Consul: config.ConfigConsul{
+					Agent: config.ConfigConsulAgent{
+						Services: map[string]config.ServiceDefinition{
+							"router": {
+								DefaultCheck: &falseValue,
+								Checks: []config.ServiceDefinitionCheck{
+									{
+										Name:                           "router-health",
+										HTTP:                           "https://localhost:8080/health",
+										Method:                         "HEAD",
+										Header:                         map[string][]string{"X-Probe": {"consul"}},
+										TLSSkipVerify:                  true,
+										Interval:                       "10s",
+										DeregisterCriticalServiceAfter: "10m",
+									},
+								},
+							},
+						},
+					},
+				},
+			})
+			Expect(definitions).To(ConsistOf([]config.ServiceDefinition{
+				{
+					ServiceName: "router",
+					Name:        "router",
+					Checks: []config.ServiceDefinitionCheck{
+						{
+							Name:                           "router-health",
+							HTTP:                           "https://localhost:8080/health",
+							Method:                         "HEAD",
+							Header:                         map[string][]string{"X-Probe": {"consul"}},
+							TLSSkipVerify:                  true,
+							Interval:                       "10s",
+							DeregisterCriticalServiceAfter: "10m",
+						},
+					},
+					Tags: []string{"some-node-0"},
+				},
+			}))
+		})
+
+		It("generates a definition per instance", func() {
+			definitions := definer.GenerateDefinitions(config.Config{
+				Node: config.ConfigNode{
+					Name:  "some_node",
+					Index: 0,
+				},
+				Consul: config.ConfigConsul{
+					Agent: config.ConfigConsulAgent{
+						Services: map[string]config.ServiceDefinition{
+							"cloud_controller": {
+								Port: 9022,
+								Instances: []config.ServiceInstance{
+									{},
+									{
+										ID:   "cc-worker",
+										Port: 9023,
+										Tags: []string{"worker"},
+									},
+								},
+							},
+						},
+					},
+				},
+			})
+			Expect(definitions).To(ConsistOf([]config.ServiceDefinition{
+				{
+					ServiceName: "cloud_controller-0",
+					Name:        "cloud-controller",
+					ID:          "cloud-controller-0",
+					Check: &config.ServiceDefinitionCheck{
+						Name:     "dns_health_check",
+						Script:   "/var/vcap/jobs/cloud_controller/bin/dns_health_check",
+						Interval: "3s",
+					},
+					Tags: []string{"some-node-0"},
+					Port: 9022,
+				},
+				{
+					ServiceName: "cloud_controller-1",
+					Name:        "cloud-controller",
+					ID:          "cc-worker",
+					Check: &config.ServiceDefinitionCheck{
+						Name:     "dns_health_check",
+						Script:   "/var/vcap/jobs/cloud_controller/bin/dns_health_check",
+						Interval: "3s",
+					},
+					Tags: []string{"worker"},
+					Port: 9023,
+				},
+			}))
+		})
 	})
 
 	Describe("WriteDefinitions", func() {
@@ -654,6 +790,40 @@ var _ = Describe("ServiceDefiner", func() {
 			}`))
 		})
 
+		It("does not write out the settings that only confab reads", func() {
+			trueValue := true
+			err := definer.WriteDefinitions(tempDir, []config.ServiceDefinition{
+				{
+					ServiceName:  "router",
+					Name:         "router",
+					DefaultCheck: &trueValue,
+					Instances:    []config.ServiceInstance{{ID: "router-0"}},
+					Check: &config.ServiceDefinitionCheck{
+						Name:       "router-grpc",
+						GRPC:       "localhost:9090/router",
+						GRPCUseTLS: true,
+						Interval:   "10s",
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			configFile, err := ioutil.ReadFile(fmt.Sprintf("%s/service-router.json", tempDir))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(string(configFile)).To(MatchJSON(`{
+				"service": {
+					"name": "router",
+					"check": {
+						"name": "router-grpc",
+						"grpc": "localhost:9090/router",
+						"grpc_use_tls": true,
+						"interval": "10s"
+					}
+				}
+			}`))
+		})
+
 		Context("failure cases", func() {
 			It("errors when the file cannot be created", func() {
 				err := definer.WriteDefinitions("/some/random/path", []config.ServiceDefinition{
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	minRaftMultiplier = 1
+	maxRaftMultiplier = 10
+)
+
+var tlsMinVersions = []string{"tls10", "tls11", "tls12"}
+
+var encryptStages = []string{EncryptStageAccept, EncryptStageSend, EncryptStageEnforce}
+
+var serviceReadinessLevels = []string{ServiceReadinessNone, ServiceReadinessRegistered, ServiceReadinessPassing}
+
+// Validate checks the settings that consul would otherwise only reject once
+// the agent is already booting.
+func (c Config) Validate() error {
+	agent := c.Consul.Agent
+
+	if err := validateNode(c.Node); err != nil {
+		return err
+	}
+
+	multiplier := agent.Performance.RaftMultiplier
+	if multiplier != 0 && (multiplier < minRaftMultiplier || multiplier > maxRaftMultiplier) {
+		return fmt.Errorf("\"raft_multiplier\" must be between %d and %d, got %d",
+			minRaftMultiplier, maxRaftMultiplier, multiplier)
+	}
+
+	durations := []struct {
+		name  string
+		value string
+	}{
+		{"last_contact_threshold", agent.Autopilot.LastContactThreshold},
+		{"server_stabilization_time", agent.Autopilot.ServerStabilizationTime},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("%q must be a duration such as \"200ms\" or \"10s\", got %q", d.name, d.value)
+		}
+
+		if duration <= 0 {
+			return fmt.Errorf("%q must be positive, got %q", d.name, d.value)
+		}
+	}
+
+	if agent.Mode != "server" && agent.Autopilot != (ConfigConsulAgentAutopilot{}) {
+		return fmt.Errorf("\"autopilot\" can only be configured on servers")
+	}
+
+	if agent.BootstrapExpect < 0 {
+		return fmt.Errorf("\"bootstrap_expect\" must not be negative, got %d", agent.BootstrapExpect)
+	}
+
+	if agent.Mode != "server" && agent.BootstrapExpect != 0 {
+		return fmt.Errorf("\"bootstrap_expect\" can only be configured on servers")
+	}
+
+	if version := agent.TLS.MinVersion; version != "" && !contains(tlsMinVersions, version) {
+		return fmt.Errorf("\"tls.min_version\" must be one of %s, got %q", strings.Join(tlsMinVersions, ", "), version)
+	}
+
+	if port := agent.TLS.HTTPSPort; port < 0 || port > 65535 {
+		return fmt.Errorf("\"tls.https_port\" must be between 0 and 65535, got %d", port)
+	}
+
+	for _, days := range c.Confab.CertExpiryWarningDays {
+		if days <= 0 {
+			return fmt.Errorf("\"cert_expiry_warning_days\" must be positive, got %d", days)
+		}
+	}
+
+	if timeout := c.Confab.DrainTimeoutInSeconds; timeout < 0 {
+		return fmt.Errorf("\"drain_timeout_in_seconds\" must not be negative, got %d", timeout)
+	}
+
+	if stage := c.Consul.EncryptStage; stage != "" {
+		if !contains(encryptStages, stage) {
+			return fmt.Errorf("\"encrypt_stage\" must be one of %s, got %q", strings.Join(encryptStages, ", "), stage)
+		}
+
+		if stage != EncryptStageEnforce && len(c.Consul.EncryptKeys) == 0 {
+			return fmt.Errorf("\"encrypt_stage\" %q requires \"encrypt_keys\"", stage)
+		}
+	}
+
+	if readiness := c.Confab.ServiceReadiness; !contains(serviceReadinessLevels, readiness) {
+		return fmt.Errorf("\"service_readiness\" must be one of %s, got %q", strings.Join(serviceReadinessLevels, ", "), readiness)
+	}
+
+	if min := c.Confab.MinJoinedServers; min < 1 {
+		return fmt.Errorf("\"min_joined_servers\" must be at least 1, got %d", min)
+	} else if servers := len(agent.Servers.LAN); servers > 0 && min > servers && allServerAddresses(agent.Servers.LAN) {
+		return fmt.Errorf("\"min_joined_servers\" must not exceed the %d lan servers, got %d", servers, min)
+	}
+
+	if err := validateAddresses(agent); err != nil {
+		return err
+	}
+
+	if err := validateServices(agent.Services); err != nil {
+		return err
+	}
+
+	if err := validateDNS(agent); err != nil {
+		return err
+	}
+
+	if err := validateExtraConfig(agent.ExtraConfig); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allServerAddresses reports whether none of the servers is a name that only
+// resolves to its addresses once confab starts.
+func allServerAddresses(servers []string) bool {
+	for _, server := range servers {
+		if !IsServerAddress(server) {
+			return false
+		}
+	}
+
+	return true
+}
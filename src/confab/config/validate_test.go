@@ -0,0 +1,282 @@
+package config_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validate", func() {
+	var cfg config.Config
+
+	BeforeEach(func() {
+		cleanupDeadServers := true
+		cfg = config.Default()
+		cfg.Consul.Agent.Mode = "server"
+		cfg.Consul.Agent.Performance.RaftMultiplier = 5
+		cfg.Consul.Agent.Autopilot = config.ConfigConsulAgentAutopilot{
+			CleanupDeadServers:      &cleanupDeadServers,
+			LastContactThreshold:    "200ms",
+			ServerStabilizationTime: "10s",
+		}
+		cfg.Consul.Agent.TLS.MinVersion = "tls12"
+		cfg.Consul.Agent.TLS.HTTPSPort = 8501
+		cfg.Node.NameTemplate = "{{.Deployment}}-{{.Name}}-{{.Index}}"
+		cfg.Node.Meta = map[string]string{"rack": "r12"}
+	})
+
+	It("accepts a valid configuration", func() {
+		Expect(cfg.Validate()).To(Succeed())
+	})
+
+	It("accepts extra_config that does not override confab's settings", func() {
+		cfg.Consul.Agent.ExtraConfig = map[string]interface{}{
+			"ui": true,
+		}
+		Expect(cfg.Validate()).To(Succeed())
+	})
+
+	It("accepts the default configuration", func() {
+		Expect(config.Default().Validate()).To(Succeed())
+	})
+
+	Context("failure cases", func() {
+		It("rejects a raft multiplier outside of 1-10", func() {
+			cfg.Consul.Agent.Performance.RaftMultiplier = 11
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"raft_multiplier" must be between 1 and 10, got 11`)))
+
+			cfg.Consul.Agent.Performance.RaftMultiplier = -1
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"raft_multiplier" must be between 1 and 10, got -1`)))
+		})
+
+		It("rejects an unparseable last_contact_threshold", func() {
+			cfg.Consul.Agent.Autopilot.LastContactThreshold = "soon"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"last_contact_threshold" must be a duration such as "200ms" or "10s", got "soon"`)))
+		})
+
+		It("rejects a non-positive server_stabilization_time", func() {
+			cfg.Consul.Agent.Autopilot.ServerStabilizationTime = "0s"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"server_stabilization_time" must be positive, got "0s"`)))
+		})
+
+		It("rejects extra_config that overrides settings confab manages", func() {
+			for _, key := range []string{"server", "data_dir", "encrypt", "ca_file", "cert_file", "key_file", "bootstrap_expect"} {
+				cfg.Consul.Agent.ExtraConfig = map[string]interface{}{
+					"ui": true,
+					key:  "some-value",
+				}
+				Expect(cfg.Validate()).To(MatchError(fmt.Sprintf(`"extra_config" cannot override %q, it is managed by confab`, key)))
+			}
+		})
+
+		It("rejects non-positive certificate expiry warnings", func() {
+			cfg.Confab.CertExpiryWarningDays = []int{30, 0}
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"cert_expiry_warning_days" must be positive, got 0`)))
+		})
+
+		It("rejects an unknown minimum tls version", func() {
+			cfg.Consul.Agent.TLS.MinVersion = "ssl3"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"tls.min_version" must be one of tls10, tls11, tls12, got "ssl3"`)))
+
+			cfg.Consul.Agent.TLS.MinVersion = "tls13"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"tls.min_version" must be one of tls10, tls11, tls12, got "tls13"`)))
+		})
+
+		It("rejects an https port outside of 0-65535", func() {
+			cfg.Consul.Agent.TLS.HTTPSPort = 70000
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"tls.https_port" must be between 0 and 65535, got 70000`)))
+		})
+
+		It("rejects templated node names consul cannot serve over DNS", func() {
+			cfg.Node.NameTemplate = "{{.Name}}.{{.Index}}"
+			cfg.Node.Name = "consul"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`node name "consul.0" must be 1 to 63 letters, digits or dashes`)))
+
+			cfg.Node.NameTemplate = "{{.Name}}-{{.Index}}"
+			cfg.Node.Name = strings.Repeat("a", 62)
+			Expect(cfg.Validate()).To(MatchError(ContainSubstring("must be 1 to 63 letters, digits or dashes")))
+		})
+
+		It("passes node names through without a template, as it always has", func() {
+			cfg.Node.NameTemplate = ""
+			cfg.Node.Name = "consul.z1"
+			Expect(cfg.Validate()).To(Succeed())
+
+			cfg.Node.Name = strings.Repeat("a", 62)
+			Expect(cfg.Validate()).To(Succeed())
+		})
+
+		It("rejects a node name template that cannot be rendered", func() {
+			cfg.Node.NameTemplate = "{{.Job}}"
+			Expect(cfg.Validate()).To(MatchError(ContainSubstring(`"name_template" "{{.Job}}" could not be rendered`)))
+		})
+
+		It("rejects node metadata beyond consul's limits", func() {
+			cfg.Node.Meta = map[string]string{"rack id": "r12"}
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"meta" key "rack id" must be 1 to 128 letters, digits, dashes or underscores`)))
+
+			cfg.Node.Meta = map[string]string{"consul-version": "0.7.3"}
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"meta" key "consul-version" cannot use the reserved "consul-" prefix`)))
+
+			cfg.Node.Meta = map[string]string{"rack": strings.Repeat("r", 513)}
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"meta" value for "rack" cannot be longer than 512 characters`)))
+
+			cfg.Node.Meta = map[string]string{}
+			for i := 0; i < 65; i++ {
+				cfg.Node.Meta[fmt.Sprintf("key-%d", i)] = "value"
+			}
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"meta" cannot have more than 64 keys, got 65`)))
+		})
+
+		Context("services", func() {
+			BeforeEach(func() {
+				cfg.Consul.Agent.Services = map[string]config.ServiceDefinition{
+					"router": {
+						Check: &config.ServiceDefinitionCheck{
+							Name:     "router-health",
+							HTTP:     "http://localhost:8080/health",
+							Interval: "10s",
+							Timeout:  "1s",
+						},
+						Checks: []config.ServiceDefinitionCheck{
+							{Name: "router-heartbeat", TTL: "30s", DeregisterCriticalServiceAfter: "10m"},
+							{Name: "router-grpc", GRPC: "localhost:9090", Interval: "10s"},
+						},
+						Instances: []config.ServiceInstance{{Port: 8080}, {Port: 8081}},
+					},
+				}
+			})
+
+			It("accepts valid checks and instances", func() {
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("rejects checks without exactly one type", func() {
+				cfg.Consul.Agent.Services["router"].Checks[1].TCP = "localhost:9090"
+				Expect(cfg.Validate()).To(MatchError(errors.New(`service "router" check "router-grpc" must define exactly one of script, http, tcp, ttl or grpc`)))
+			})
+
+			It("rejects docker checks without a script", func() {
+				cfg.Consul.Agent.Services["router"].Checks[1].DockerContainerID = "some-container"
+				Expect(cfg.Validate()).To(MatchError(errors.New(`service "router" check "router-grpc" must define a script to run in the docker container`)))
+			})
+
+			It("rejects intervals on ttl checks and their absence on others", func() {
+				cfg.Consul.Agent.Services["router"].Checks[0].Interval = "10s"
+				Expect(cfg.Validate()).To(MatchError(errors.New(`service "router" check "router-heartbeat" must not define an interval as it is a ttl check`)))
+
+				cfg.Consul.Agent.Services["router"].Checks[0].Interval = ""
+				cfg.Consul.Agent.Services["router"].Check.Interval = ""
+				Expect(cfg.Validate()).To(MatchError(errors.New(`service "router" check "router-health" must define an interval`)))
+			})
+
+			It("rejects check durations that are invalid", func() {
+				cfg.Consul.Agent.Services["router"].Check.Timeout = "1"
+				Expect(cfg.Validate()).To(MatchError(errors.New(`service "router" check "router-health" timeout must be a duration such as "10s", got "1"`)))
+
+				cfg.Consul.Agent.Services["router"].Check.Timeout = "0s"
+				Expect(cfg.Validate()).To(MatchError(errors.New(`service "router" check "router-health" timeout must be positive, got "0s"`)))
+			})
+
+			It("rejects instances with an invalid port", func() {
+				cfg.Consul.Agent.Services["router"].Instances[1].Port = 65536
+				Expect(cfg.Validate()).To(MatchError(errors.New(`service "router" instance 1 port must be between 0 and 65535, got 65536`)))
+			})
+
+			It("rejects services that register the same id", func() {
+				cfg.Consul.Agent.Services["router"].Instances[1].ID = "gorouter"
+				cfg.Consul.Agent.Services["gorouter"] = config.ServiceDefinition{}
+				Expect(cfg.Validate()).To(MatchError(errors.New(`service "gorouter" and service "router" both register the id "gorouter"`)))
+			})
+		})
+
+		It("rejects a negative drain timeout", func() {
+			cfg.Confab.DrainTimeoutInSeconds = -1
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"drain_timeout_in_seconds" must not be negative, got -1`)))
+		})
+
+		It("rejects an unknown encrypt stage or a staged rollout without keys", func() {
+			cfg.Consul.EncryptStage = "plaintext"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"encrypt_stage" must be one of accept, send, enforce, got "plaintext"`)))
+
+			cfg.Consul.EncryptStage = "accept"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"encrypt_stage" "accept" requires "encrypt_keys"`)))
+
+			cfg.Consul.EncryptKeys = []string{"key"}
+			Expect(cfg.Validate()).To(Succeed())
+		})
+
+		It("rejects an unknown service readiness", func() {
+			cfg.Confab.ServiceReadiness = "healthy"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"service_readiness" must be one of none, registered, passing, got "healthy"`)))
+		})
+
+		It("rejects a minimum of joined servers the cluster cannot satisfy", func() {
+			cfg.Confab.MinJoinedServers = 0
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"min_joined_servers" must be at least 1, got 0`)))
+
+			cfg.Consul.Agent.Servers.LAN = []string{"10.0.0.1", "10.0.0.2"}
+			cfg.Confab.MinJoinedServers = 3
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"min_joined_servers" must not exceed the 2 lan servers, got 3`)))
+
+			cfg.Confab.MinJoinedServers = 2
+			Expect(cfg.Validate()).To(Succeed())
+
+			cfg.Consul.Agent.Servers.LAN = []string{"consul.service.internal"}
+			cfg.Confab.MinJoinedServers = 3
+			Expect(cfg.Validate()).To(Succeed())
+		})
+
+		It("rejects DNS durations that cannot be parsed", func() {
+			cfg.Consul.Agent.DNSConfig.ServiceTTL = map[string]string{"*": "5s", "uaa": "forever"}
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"dns_config.service_ttl.uaa" must be a duration such as "5s" or "1m", got "forever"`)))
+
+			cfg.Consul.Agent.DNSConfig.ServiceTTL = nil
+			cfg.Consul.Agent.RecursorTimeout = "2"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"recursor_timeout" must be a duration such as "5s" or "1m", got "2"`)))
+		})
+
+		It("rejects negative DNS settings", func() {
+			cfg.Consul.Agent.DNSConfig.MaxStale = "-5s"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"dns_config.max_stale" must not be negative, got "-5s"`)))
+
+			cfg.Consul.Agent.DNSConfig.MaxStale = ""
+			cfg.Consul.Agent.DNSConfig.UDPAnswerLimit = -1
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"dns_config.udp_answer_limit" must not be negative, got -1`)))
+		})
+
+		It("accepts a zero node TTL", func() {
+			cfg.Consul.Agent.DNSConfig.NodeTTL = "0s"
+			Expect(cfg.Validate()).To(Succeed())
+		})
+
+		It("rejects addresses that are not IPs", func() {
+			cfg.Consul.Agent.AdvertiseAddrWAN = "consul.example.com"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"advertise_addr_wan" must be an IP address, got "consul.example.com"`)))
+
+			cfg.Consul.Agent.AdvertiseAddrWAN = ""
+			cfg.Consul.Agent.Addresses.DNS = "10.0.0"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"addresses.dns" must be an IP address, got "10.0.0"`)))
+		})
+
+		It("rejects autopilot settings on clients", func() {
+			cfg.Consul.Agent.Mode = "client"
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"autopilot" can only be configured on servers`)))
+		})
+
+		It("rejects a bootstrap_expect that is negative or set on clients", func() {
+			cfg.Consul.Agent.BootstrapExpect = -1
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"bootstrap_expect" must not be negative, got -1`)))
+
+			cfg.Consul.Agent.Autopilot = config.ConfigConsulAgentAutopilot{}
+			cfg.Consul.Agent.Mode = "client"
+			cfg.Consul.Agent.BootstrapExpect = 3
+			Expect(cfg.Validate()).To(MatchError(errors.New(`"bootstrap_expect" can only be configured on servers`)))
+		})
+	})
+})
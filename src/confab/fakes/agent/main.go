@@ -12,6 +12,8 @@ import (
 	"time"
 )
 
+const Version = "0.6.4"
+
 type stringSlice []string
 
 func (ss *stringSlice) String() string {
@@ -35,6 +37,11 @@ func main() {
 		log.Fatal("expecting command as first argment")
 	}
 
+	if os.Args[1] == "version" {
+		fmt.Printf("Consul v%s\nConsul Protocol: 3 (Understands back to: 1)\n", Version)
+		os.Exit(0)
+	}
+
 	var configDir string
 	var recursors stringSlice
 	flagSet := flag.NewFlagSet("", flag.ExitOnError)
@@ -18,6 +18,9 @@ type OutputData struct {
 	UseKeyCallCount     int
 	InstallKeyCallCount int
 	StatsCallCount      int
+
+	EnableMaintenanceCallCount  int
+	DisableMaintenanceCallCount int
 }
 
 func NewOutputWriter(filepath string, pid int, args []string) *OutputWriter {
@@ -47,6 +50,10 @@ func (ow *OutputWriter) run() {
 			ow.data.UseKeyCallCount++
 		case "stats":
 			ow.data.StatsCallCount++
+		case "enablemaintenance":
+			ow.data.EnableMaintenanceCallCount++
+		case "disablemaintenance":
+			ow.data.DisableMaintenanceCallCount++
 		case "exit":
 			return
 		}
@@ -83,6 +90,14 @@ func (ow *OutputWriter) StatsCalled() {
 	ow.callCountChan <- "stats"
 }
 
+func (ow *OutputWriter) EnableMaintenanceCalled() {
+	ow.callCountChan <- "enablemaintenance"
+}
+
+func (ow *OutputWriter) DisableMaintenanceCalled() {
+	ow.callCountChan <- "disablemaintenance"
+}
+
 func (ow *OutputWriter) Exit() {
 	ow.callCountChan <- "exit"
 }
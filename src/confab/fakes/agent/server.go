@@ -54,14 +54,37 @@ func (s *Server) ServeHTTP() {
 		var members []api.AgentMember
 		for _, member := range s.Members {
 			members = append(members, api.AgentMember{
-				Addr: member,
+				Addr:   member,
+				Status: 1,
 				Tags: map[string]string{
 					"role": "consul",
+					"dc":   "dc1",
 				},
 			})
 		}
 		json.NewEncoder(w).Encode(members)
 	})
+	mux.HandleFunc("/v1/agent/self", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]map[string]interface{}{
+			"Config": {
+				"Version": Version,
+			},
+		})
+	})
+
+	mux.HandleFunc("/v1/agent/checks", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]api.AgentCheck{})
+	})
+	mux.HandleFunc("/v1/agent/maintenance", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("enable") == "true" {
+			s.OutputWriter.EnableMaintenanceCalled()
+		} else {
+			s.OutputWriter.DisableMaintenanceCalled()
+		}
+	})
+	mux.HandleFunc("/v1/health/service/", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode([]api.ServiceEntry{})
+	})
 
 	server := &http.Server{
 		Addr:    s.HTTPAddr,
@@ -1,6 +1,9 @@
 package fakes
 
-import "github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+import (
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+)
 
 type AgentClient struct {
 	VerifyJoinedCalls struct {
@@ -23,6 +26,22 @@ type AgentClient struct {
 		}
 	}
 
+	StatusCall struct {
+		CallCount int
+		Returns   struct {
+			Status agent.Status
+			Error  error
+		}
+	}
+
+	VersionCall struct {
+		CallCount int
+		Returns   struct {
+			Version string
+			Error   error
+		}
+	}
+
 	SetKeysCall struct {
 		Receives struct {
 			Keys []string
@@ -32,6 +51,16 @@ type AgentClient struct {
 		}
 	}
 
+	BootstrapACLsCall struct {
+		CallCount int
+		Receives  struct {
+			Policies []config.ACLPolicy
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
 	LeaveCall struct {
 		CallCount int
 		Returns   struct {
@@ -39,6 +68,46 @@ type AgentClient struct {
 		}
 	}
 
+	EnableMaintenanceCall struct {
+		CallCount int
+		Receives  struct {
+			Reason string
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
+	EndDrainCall struct {
+		CallCount int
+		Returns   struct {
+			Error error
+		}
+	}
+
+	IsDrainedCalls struct {
+		CallCount int
+		Receives  struct {
+			Node     string
+			Services []string
+		}
+		Returns struct {
+			Drained []bool
+			Error   error
+		}
+	}
+
+	ServiceStatesCalls struct {
+		CallCount int
+		Receives  struct {
+			IDs []string
+		}
+		Returns struct {
+			States [][]agent.ServiceState
+			Error  error
+		}
+	}
+
 	SetConsulRPCClientCall struct {
 		CallCount int
 		Receives  struct {
@@ -63,16 +132,72 @@ func (c *AgentClient) IsLastNode() (bool, error) {
 	return c.IsLastNodeCall.Returns.IsLastNode, c.IsLastNodeCall.Returns.Error
 }
 
+func (c *AgentClient) Status() (agent.Status, error) {
+	c.StatusCall.CallCount++
+	return c.StatusCall.Returns.Status, c.StatusCall.Returns.Error
+}
+
+func (c *AgentClient) Version() (string, error) {
+	c.VersionCall.CallCount++
+	return c.VersionCall.Returns.Version, c.VersionCall.Returns.Error
+}
+
 func (c *AgentClient) SetKeys(keys []string) error {
 	c.SetKeysCall.Receives.Keys = keys
 	return c.SetKeysCall.Returns.Error
 }
 
+func (c *AgentClient) BootstrapACLs(policies []config.ACLPolicy) error {
+	c.BootstrapACLsCall.CallCount++
+	c.BootstrapACLsCall.Receives.Policies = policies
+	return c.BootstrapACLsCall.Returns.Error
+}
+
 func (c *AgentClient) Leave() error {
 	c.LeaveCall.CallCount++
 	return c.LeaveCall.Returns.Error
 }
 
+func (c *AgentClient) EnableMaintenance(reason string) error {
+	c.EnableMaintenanceCall.CallCount++
+	c.EnableMaintenanceCall.Receives.Reason = reason
+	return c.EnableMaintenanceCall.Returns.Error
+}
+
+func (c *AgentClient) EndDrain() error {
+	c.EndDrainCall.CallCount++
+	return c.EndDrainCall.Returns.Error
+}
+
+func (c *AgentClient) IsDrained(node string, services []string) (bool, error) {
+	c.IsDrainedCalls.Receives.Node = node
+	c.IsDrainedCalls.Receives.Services = services
+
+	var drained bool
+	if c.IsDrainedCalls.CallCount < len(c.IsDrainedCalls.Returns.Drained) {
+		drained = c.IsDrainedCalls.Returns.Drained[c.IsDrainedCalls.CallCount]
+	}
+	c.IsDrainedCalls.CallCount++
+
+	return drained, c.IsDrainedCalls.Returns.Error
+}
+
+func (c *AgentClient) ServiceStates(ids []string) ([]agent.ServiceState, error) {
+	c.ServiceStatesCalls.Receives.IDs = ids
+
+	var states []agent.ServiceState
+	if n := len(c.ServiceStatesCalls.Returns.States); n > 0 {
+		if c.ServiceStatesCalls.CallCount < n {
+			states = c.ServiceStatesCalls.Returns.States[c.ServiceStatesCalls.CallCount]
+		} else {
+			states = c.ServiceStatesCalls.Returns.States[n-1]
+		}
+	}
+	c.ServiceStatesCalls.CallCount++
+
+	return states, c.ServiceStatesCalls.Returns.Error
+}
+
 func (c *AgentClient) SetConsulRPCClient(rpcClient agent.ConsulRPCClient) {
 	c.SetConsulRPCClientCall.CallCount++
 	c.SetConsulRPCClientCall.Receives.ConsulRPCClient = rpcClient
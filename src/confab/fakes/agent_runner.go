@@ -29,6 +29,21 @@ type AgentRunner struct {
 		}
 	}
 
+	VersionCall struct {
+		CallCount int
+		Returns   struct {
+			Output string
+			Error  error
+		}
+	}
+
+	ReloadCall struct {
+		CallCount int
+		Returns   struct {
+			Error error
+		}
+	}
+
 	WritePIDCall struct {
 		CallCount int
 		Returns   struct {
@@ -58,7 +73,17 @@ func (r *AgentRunner) Cleanup() error {
 	return r.CleanupCall.Returns.Error
 }
 
+func (r *AgentRunner) Version() (string, error) {
+	r.VersionCall.CallCount++
+	return r.VersionCall.Returns.Output, r.VersionCall.Returns.Error
+}
+
 func (r *AgentRunner) WritePID() error {
 	r.WritePIDCall.CallCount++
 	return r.WritePIDCall.Returns.Error
 }
+
+func (r *AgentRunner) Reload() error {
+	r.ReloadCall.CallCount++
+	return r.ReloadCall.Returns.Error
+}
@@ -0,0 +1,19 @@
+package fakes
+
+import "github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
+
+type Autopilot struct {
+	HealthCall struct {
+		CallCount int
+		Returns   struct {
+			Health agent.AutopilotHealth
+			Error  error
+		}
+	}
+}
+
+func (a *Autopilot) Health() (agent.AutopilotHealth, error) {
+	a.HealthCall.CallCount++
+
+	return a.HealthCall.Returns.Health, a.HealthCall.Returns.Error
+}
@@ -0,0 +1,34 @@
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
+)
+
+type CertChecker struct {
+	sync.Mutex
+
+	CheckCertExpiryCall struct {
+		CallCount int
+		Returns   struct {
+			Expiries []certs.Expiry
+			Error    error
+		}
+	}
+}
+
+func (c *CertChecker) CheckCertExpiry() ([]certs.Expiry, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.CheckCertExpiryCall.CallCount++
+	return c.CheckCertExpiryCall.Returns.Expiries, c.CheckCertExpiryCall.Returns.Error
+}
+
+func (c *CertChecker) CheckCertExpiryCallCount() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.CheckCertExpiryCall.CallCount
+}
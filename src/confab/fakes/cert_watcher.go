@@ -0,0 +1,34 @@
+package fakes
+
+import "sync"
+
+type CertWatcher struct {
+	sync.Mutex
+
+	ChangedCall struct {
+		CallCount int
+		Returns   struct {
+			Changed []bool
+		}
+	}
+}
+
+func (w *CertWatcher) Changed() bool {
+	w.Lock()
+	defer w.Unlock()
+
+	var changed bool
+	if w.ChangedCall.CallCount < len(w.ChangedCall.Returns.Changed) {
+		changed = w.ChangedCall.Returns.Changed[w.ChangedCall.CallCount]
+	}
+	w.ChangedCall.CallCount++
+
+	return changed
+}
+
+func (w *CertWatcher) ChangedCallCount() int {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.ChangedCall.CallCount
+}
@@ -9,9 +9,22 @@ type Clock struct {
 			Duration time.Duration
 		}
 	}
+
+	NowCall struct {
+		CallCount int
+		Returns   struct {
+			Time time.Time
+		}
+	}
 }
 
 func (c *Clock) Sleep(duration time.Duration) {
 	c.SleepCall.CallCount++
 	c.SleepCall.Receives.Duration = duration
 }
+
+func (c *Clock) Now() time.Time {
+	c.NowCall.CallCount++
+
+	return c.NowCall.Returns.Time
+}
@@ -0,0 +1,31 @@
+package fakes
+
+type ClusterDetector struct {
+	HasRaftStateCall struct {
+		CallCount int
+		Returns   struct {
+			HasRaftState bool
+		}
+	}
+
+	LeaderCall struct {
+		CallCount int
+		Receives  struct {
+			Servers []string
+		}
+		Returns struct {
+			Leader string
+		}
+	}
+}
+
+func (d *ClusterDetector) HasRaftState() bool {
+	d.HasRaftStateCall.CallCount++
+	return d.HasRaftStateCall.Returns.HasRaftState
+}
+
+func (d *ClusterDetector) Leader(servers []string) string {
+	d.LeaderCall.CallCount++
+	d.LeaderCall.Receives.Servers = servers
+	return d.LeaderCall.Returns.Leader
+}
@@ -4,7 +4,8 @@ import "github.com/cloudfoundry-incubator/consul-release/src/confab/config"
 
 type ConfigWriter struct {
 	WriteCall struct {
-		Receives struct {
+		CallCount int
+		Receives  struct {
 			Config config.Config
 		}
 		Returns struct {
@@ -14,6 +15,7 @@ type ConfigWriter struct {
 }
 
 func (w *ConfigWriter) Write(cfg config.Config) error {
+	w.WriteCall.CallCount++
 	w.WriteCall.Receives.Config = cfg
 
 	return w.WriteCall.Returns.Error
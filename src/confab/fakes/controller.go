@@ -2,7 +2,7 @@ package fakes
 
 import (
 	"github.com/cloudfoundry-incubator/consul-release/src/confab"
-	"github.com/hashicorp/consul/command/agent"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/agent"
 )
 
 type Controller struct {
@@ -13,6 +13,20 @@ type Controller struct {
 		}
 	}
 
+	VerifyConsulVersionCall struct {
+		CallCount int
+		Returns   struct {
+			Error error
+		}
+	}
+
+	VerifyTLSCall struct {
+		CallCount int
+		Returns   struct {
+			Error error
+		}
+	}
+
 	WriteServiceDefinitionsCall struct {
 		CallCount int
 		Returns   struct {
@@ -34,7 +48,7 @@ type Controller struct {
 		CallCount int
 		Receives  struct {
 			Timeout   confab.Timeout
-			RPCClient *agent.RPCClient
+			RPCClient agent.ConsulRPCClient
 		}
 		Returns struct {
 			Error error
@@ -43,7 +57,10 @@ type Controller struct {
 
 	ConfigureClientCall struct {
 		CallCount int
-		Returns   struct {
+		Receives  struct {
+			Timeout confab.Timeout
+		}
+		Returns struct {
 			Error error
 		}
 	}
@@ -51,7 +68,7 @@ type Controller struct {
 	StopAgentCall struct {
 		CallCount int
 		Receives  struct {
-			RPCClient *agent.RPCClient
+			RPCClient agent.ConsulRPCClient
 		}
 	}
 }
@@ -62,6 +79,18 @@ func (c *Controller) WriteConsulConfig() error {
 	return c.WriteConsulConfigCall.Returns.Error
 }
 
+func (c *Controller) VerifyConsulVersion() error {
+	c.VerifyConsulVersionCall.CallCount++
+
+	return c.VerifyConsulVersionCall.Returns.Error
+}
+
+func (c *Controller) VerifyTLS() error {
+	c.VerifyTLSCall.CallCount++
+
+	return c.VerifyTLSCall.Returns.Error
+}
+
 func (c *Controller) WriteServiceDefinitions() error {
 	c.WriteServiceDefinitionsCall.CallCount++
 
@@ -75,7 +104,7 @@ func (c *Controller) BootAgent(timeout confab.Timeout) error {
 	return c.BootAgentCall.Returns.Error
 }
 
-func (c *Controller) ConfigureServer(timeout confab.Timeout, rpcClient *agent.RPCClient) error {
+func (c *Controller) ConfigureServer(timeout confab.Timeout, rpcClient agent.ConsulRPCClient) error {
 	c.ConfigureServerCall.CallCount++
 	c.ConfigureServerCall.Receives.Timeout = timeout
 	c.ConfigureServerCall.Receives.RPCClient = rpcClient
@@ -83,13 +112,14 @@ func (c *Controller) ConfigureServer(timeout confab.Timeout, rpcClient *agent.RP
 	return c.ConfigureServerCall.Returns.Error
 }
 
-func (c *Controller) ConfigureClient() error {
+func (c *Controller) ConfigureClient(timeout confab.Timeout) error {
 	c.ConfigureClientCall.CallCount++
+	c.ConfigureClientCall.Receives.Timeout = timeout
 
 	return c.ConfigureClientCall.Returns.Error
 }
 
-func (c *Controller) StopAgent(rpcClient *agent.RPCClient) {
+func (c *Controller) StopAgent(rpcClient agent.ConsulRPCClient) {
 	c.StopAgentCall.CallCount++
 	c.StopAgentCall.Receives.RPCClient = rpcClient
 }
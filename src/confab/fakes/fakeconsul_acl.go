@@ -0,0 +1,57 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type FakeconsulACL struct {
+	UpdateStub        func(acl *api.ACLEntry, q *api.WriteOptions) (*api.WriteMeta, error)
+	updateMutex       sync.RWMutex
+	updateArgsForCall []struct {
+		acl *api.ACLEntry
+		q   *api.WriteOptions
+	}
+	updateReturns struct {
+		result1 *api.WriteMeta
+		result2 error
+	}
+}
+
+func (fake *FakeconsulACL) Update(acl *api.ACLEntry, q *api.WriteOptions) (*api.WriteMeta, error) {
+	fake.updateMutex.Lock()
+	fake.updateArgsForCall = append(fake.updateArgsForCall, struct {
+		acl *api.ACLEntry
+		q   *api.WriteOptions
+	}{acl, q})
+	fake.updateMutex.Unlock()
+	if fake.UpdateStub != nil {
+		return fake.UpdateStub(acl, q)
+	} else {
+		return fake.updateReturns.result1, fake.updateReturns.result2
+	}
+}
+
+func (fake *FakeconsulACL) UpdateCallCount() int {
+	fake.updateMutex.RLock()
+	defer fake.updateMutex.RUnlock()
+	return len(fake.updateArgsForCall)
+}
+
+func (fake *FakeconsulACL) UpdateArgsForCall(i int) (*api.ACLEntry, *api.WriteOptions) {
+	fake.updateMutex.RLock()
+	defer fake.updateMutex.RUnlock()
+	return fake.updateArgsForCall[i].acl, fake.updateArgsForCall[i].q
+}
+
+func (fake *FakeconsulACL) UpdateReturns(result1 *api.WriteMeta, result2 error) {
+	fake.UpdateStub = nil
+	fake.updateReturns = struct {
+		result1 *api.WriteMeta
+		result2 error
+	}{result1, result2}
+}
+
+// var _ confab.consulACL = new(FakeconsulACL)
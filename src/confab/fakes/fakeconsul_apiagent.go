@@ -17,6 +17,58 @@ type FakeconsulAPIAgent struct {
 		result1 []*api.AgentMember
 		result2 error
 	}
+	SelfStub        func() (map[string]map[string]interface{}, error)
+	selfMutex       sync.RWMutex
+	selfArgsForCall []struct{}
+	selfReturns     struct {
+		result1 map[string]map[string]interface{}
+		result2 error
+	}
+	ServicesStub        func() (map[string]*api.AgentService, error)
+	servicesMutex       sync.RWMutex
+	servicesArgsForCall []struct{}
+	servicesReturns     struct {
+		result1 map[string]*api.AgentService
+		result2 error
+	}
+	ChecksStub        func() (map[string]*api.AgentCheck, error)
+	checksMutex       sync.RWMutex
+	checksArgsForCall []struct{}
+	checksReturns     struct {
+		result1 map[string]*api.AgentCheck
+		result2 error
+	}
+	EnableNodeMaintenanceStub        func(reason string) error
+	enableNodeMaintenanceMutex       sync.RWMutex
+	enableNodeMaintenanceArgsForCall []struct {
+		reason string
+	}
+	enableNodeMaintenanceReturns struct {
+		result1 error
+	}
+	DisableNodeMaintenanceStub        func() error
+	disableNodeMaintenanceMutex       sync.RWMutex
+	disableNodeMaintenanceArgsForCall []struct{}
+	disableNodeMaintenanceReturns     struct {
+		result1 error
+	}
+	EnableServiceMaintenanceStub        func(serviceID, reason string) error
+	enableServiceMaintenanceMutex       sync.RWMutex
+	enableServiceMaintenanceArgsForCall []struct {
+		serviceID string
+		reason    string
+	}
+	enableServiceMaintenanceReturns struct {
+		result1 error
+	}
+	DisableServiceMaintenanceStub        func(serviceID string) error
+	disableServiceMaintenanceMutex       sync.RWMutex
+	disableServiceMaintenanceArgsForCall []struct {
+		serviceID string
+	}
+	disableServiceMaintenanceReturns struct {
+		result1 error
+	}
 }
 
 func (fake *FakeconsulAPIAgent) Members(wan bool) ([]*api.AgentMember, error) {
@@ -52,4 +104,200 @@ func (fake *FakeconsulAPIAgent) MembersReturns(result1 []*api.AgentMember, resul
 	}{result1, result2}
 }
 
+func (fake *FakeconsulAPIAgent) Self() (map[string]map[string]interface{}, error) {
+	fake.selfMutex.Lock()
+	fake.selfArgsForCall = append(fake.selfArgsForCall, struct{}{})
+	fake.selfMutex.Unlock()
+	if fake.SelfStub != nil {
+		return fake.SelfStub()
+	} else {
+		return fake.selfReturns.result1, fake.selfReturns.result2
+	}
+}
+
+func (fake *FakeconsulAPIAgent) SelfCallCount() int {
+	fake.selfMutex.RLock()
+	defer fake.selfMutex.RUnlock()
+	return len(fake.selfArgsForCall)
+}
+
+func (fake *FakeconsulAPIAgent) SelfReturns(result1 map[string]map[string]interface{}, result2 error) {
+	fake.SelfStub = nil
+	fake.selfReturns = struct {
+		result1 map[string]map[string]interface{}
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeconsulAPIAgent) Services() (map[string]*api.AgentService, error) {
+	fake.servicesMutex.Lock()
+	fake.servicesArgsForCall = append(fake.servicesArgsForCall, struct{}{})
+	fake.servicesMutex.Unlock()
+	if fake.ServicesStub != nil {
+		return fake.ServicesStub()
+	} else {
+		return fake.servicesReturns.result1, fake.servicesReturns.result2
+	}
+}
+
+func (fake *FakeconsulAPIAgent) ServicesCallCount() int {
+	fake.servicesMutex.RLock()
+	defer fake.servicesMutex.RUnlock()
+	return len(fake.servicesArgsForCall)
+}
+
+func (fake *FakeconsulAPIAgent) ServicesReturns(result1 map[string]*api.AgentService, result2 error) {
+	fake.ServicesStub = nil
+	fake.servicesReturns = struct {
+		result1 map[string]*api.AgentService
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeconsulAPIAgent) Checks() (map[string]*api.AgentCheck, error) {
+	fake.checksMutex.Lock()
+	fake.checksArgsForCall = append(fake.checksArgsForCall, struct{}{})
+	fake.checksMutex.Unlock()
+	if fake.ChecksStub != nil {
+		return fake.ChecksStub()
+	} else {
+		return fake.checksReturns.result1, fake.checksReturns.result2
+	}
+}
+
+func (fake *FakeconsulAPIAgent) ChecksCallCount() int {
+	fake.checksMutex.RLock()
+	defer fake.checksMutex.RUnlock()
+	return len(fake.checksArgsForCall)
+}
+
+func (fake *FakeconsulAPIAgent) ChecksReturns(result1 map[string]*api.AgentCheck, result2 error) {
+	fake.ChecksStub = nil
+	fake.checksReturns = struct {
+		result1 map[string]*api.AgentCheck
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeconsulAPIAgent) EnableNodeMaintenance(reason string) error {
+	fake.enableNodeMaintenanceMutex.Lock()
+	fake.enableNodeMaintenanceArgsForCall = append(fake.enableNodeMaintenanceArgsForCall, struct {
+		reason string
+	}{reason})
+	fake.enableNodeMaintenanceMutex.Unlock()
+	if fake.EnableNodeMaintenanceStub != nil {
+		return fake.EnableNodeMaintenanceStub(reason)
+	} else {
+		return fake.enableNodeMaintenanceReturns.result1
+	}
+}
+
+func (fake *FakeconsulAPIAgent) EnableNodeMaintenanceCallCount() int {
+	fake.enableNodeMaintenanceMutex.RLock()
+	defer fake.enableNodeMaintenanceMutex.RUnlock()
+	return len(fake.enableNodeMaintenanceArgsForCall)
+}
+
+func (fake *FakeconsulAPIAgent) EnableNodeMaintenanceArgsForCall(i int) string {
+	fake.enableNodeMaintenanceMutex.RLock()
+	defer fake.enableNodeMaintenanceMutex.RUnlock()
+	return fake.enableNodeMaintenanceArgsForCall[i].reason
+}
+
+func (fake *FakeconsulAPIAgent) EnableNodeMaintenanceReturns(result1 error) {
+	fake.EnableNodeMaintenanceStub = nil
+	fake.enableNodeMaintenanceReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeconsulAPIAgent) DisableNodeMaintenance() error {
+	fake.disableNodeMaintenanceMutex.Lock()
+	fake.disableNodeMaintenanceArgsForCall = append(fake.disableNodeMaintenanceArgsForCall, struct{}{})
+	fake.disableNodeMaintenanceMutex.Unlock()
+	if fake.DisableNodeMaintenanceStub != nil {
+		return fake.DisableNodeMaintenanceStub()
+	} else {
+		return fake.disableNodeMaintenanceReturns.result1
+	}
+}
+
+func (fake *FakeconsulAPIAgent) DisableNodeMaintenanceCallCount() int {
+	fake.disableNodeMaintenanceMutex.RLock()
+	defer fake.disableNodeMaintenanceMutex.RUnlock()
+	return len(fake.disableNodeMaintenanceArgsForCall)
+}
+
+func (fake *FakeconsulAPIAgent) DisableNodeMaintenanceReturns(result1 error) {
+	fake.DisableNodeMaintenanceStub = nil
+	fake.disableNodeMaintenanceReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeconsulAPIAgent) EnableServiceMaintenance(serviceID, reason string) error {
+	fake.enableServiceMaintenanceMutex.Lock()
+	fake.enableServiceMaintenanceArgsForCall = append(fake.enableServiceMaintenanceArgsForCall, struct {
+		serviceID string
+		reason    string
+	}{serviceID, reason})
+	fake.enableServiceMaintenanceMutex.Unlock()
+	if fake.EnableServiceMaintenanceStub != nil {
+		return fake.EnableServiceMaintenanceStub(serviceID, reason)
+	} else {
+		return fake.enableServiceMaintenanceReturns.result1
+	}
+}
+
+func (fake *FakeconsulAPIAgent) EnableServiceMaintenanceCallCount() int {
+	fake.enableServiceMaintenanceMutex.RLock()
+	defer fake.enableServiceMaintenanceMutex.RUnlock()
+	return len(fake.enableServiceMaintenanceArgsForCall)
+}
+
+func (fake *FakeconsulAPIAgent) EnableServiceMaintenanceArgsForCall(i int) (string, string) {
+	fake.enableServiceMaintenanceMutex.RLock()
+	defer fake.enableServiceMaintenanceMutex.RUnlock()
+	return fake.enableServiceMaintenanceArgsForCall[i].serviceID, fake.enableServiceMaintenanceArgsForCall[i].reason
+}
+
+func (fake *FakeconsulAPIAgent) EnableServiceMaintenanceReturns(result1 error) {
+	fake.EnableServiceMaintenanceStub = nil
+	fake.enableServiceMaintenanceReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeconsulAPIAgent) DisableServiceMaintenance(serviceID string) error {
+	fake.disableServiceMaintenanceMutex.Lock()
+	fake.disableServiceMaintenanceArgsForCall = append(fake.disableServiceMaintenanceArgsForCall, struct {
+		serviceID string
+	}{serviceID})
+	fake.disableServiceMaintenanceMutex.Unlock()
+	if fake.DisableServiceMaintenanceStub != nil {
+		return fake.DisableServiceMaintenanceStub(serviceID)
+	} else {
+		return fake.disableServiceMaintenanceReturns.result1
+	}
+}
+
+func (fake *FakeconsulAPIAgent) DisableServiceMaintenanceCallCount() int {
+	fake.disableServiceMaintenanceMutex.RLock()
+	defer fake.disableServiceMaintenanceMutex.RUnlock()
+	return len(fake.disableServiceMaintenanceArgsForCall)
+}
+
+func (fake *FakeconsulAPIAgent) DisableServiceMaintenanceArgsForCall(i int) string {
+	fake.disableServiceMaintenanceMutex.RLock()
+	defer fake.disableServiceMaintenanceMutex.RUnlock()
+	return fake.disableServiceMaintenanceArgsForCall[i].serviceID
+}
+
+func (fake *FakeconsulAPIAgent) DisableServiceMaintenanceReturns(result1 error) {
+	fake.DisableServiceMaintenanceStub = nil
+	fake.disableServiceMaintenanceReturns = struct {
+		result1 error
+	}{result1}
+}
+
 // var _ confab.consulAPIAgent = new(FakeconsulAPIAgent)
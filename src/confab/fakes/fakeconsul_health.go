@@ -0,0 +1,61 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type FakeconsulHealth struct {
+	ServiceStub        func(service, tag string, passingOnly bool, q *api.QueryOptions) ([]*api.ServiceEntry, *api.QueryMeta, error)
+	serviceMutex       sync.RWMutex
+	serviceArgsForCall []struct {
+		service     string
+		tag         string
+		passingOnly bool
+		q           *api.QueryOptions
+	}
+	serviceReturns struct {
+		result1 []*api.ServiceEntry
+		result2 *api.QueryMeta
+		result3 error
+	}
+}
+
+func (fake *FakeconsulHealth) Service(service, tag string, passingOnly bool, q *api.QueryOptions) ([]*api.ServiceEntry, *api.QueryMeta, error) {
+	fake.serviceMutex.Lock()
+	fake.serviceArgsForCall = append(fake.serviceArgsForCall, struct {
+		service     string
+		tag         string
+		passingOnly bool
+		q           *api.QueryOptions
+	}{service, tag, passingOnly, q})
+	fake.serviceMutex.Unlock()
+	if fake.ServiceStub != nil {
+		return fake.ServiceStub(service, tag, passingOnly, q)
+	} else {
+		return fake.serviceReturns.result1, fake.serviceReturns.result2, fake.serviceReturns.result3
+	}
+}
+
+func (fake *FakeconsulHealth) ServiceCallCount() int {
+	fake.serviceMutex.RLock()
+	defer fake.serviceMutex.RUnlock()
+	return len(fake.serviceArgsForCall)
+}
+
+func (fake *FakeconsulHealth) ServiceArgsForCall(i int) (string, string, bool, *api.QueryOptions) {
+	fake.serviceMutex.RLock()
+	defer fake.serviceMutex.RUnlock()
+	return fake.serviceArgsForCall[i].service, fake.serviceArgsForCall[i].tag, fake.serviceArgsForCall[i].passingOnly, fake.serviceArgsForCall[i].q
+}
+
+func (fake *FakeconsulHealth) ServiceReturns(result1 []*api.ServiceEntry, result2 *api.QueryMeta, result3 error) {
+	fake.ServiceStub = nil
+	fake.serviceReturns = struct {
+		result1 []*api.ServiceEntry
+		result2 *api.QueryMeta
+		result3 error
+	}{result1, result2, result3}
+}
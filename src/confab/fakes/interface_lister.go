@@ -0,0 +1,18 @@
+package fakes
+
+import "net"
+
+type InterfaceLister struct {
+	InterfaceAddrsCall struct {
+		CallCount int
+		Returns   struct {
+			Addrs []net.Addr
+			Error error
+		}
+	}
+}
+
+func (l *InterfaceLister) InterfaceAddrs() ([]net.Addr, error) {
+	l.InterfaceAddrsCall.CallCount++
+	return l.InterfaceAddrsCall.Returns.Addrs, l.InterfaceAddrsCall.Returns.Error
+}
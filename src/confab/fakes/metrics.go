@@ -0,0 +1,44 @@
+package fakes
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type Metrics struct {
+	sync.Mutex
+	Counters     map[string]float32
+	Gauges       map[string]float32
+	Measurements map[string]int
+}
+
+func (m *Metrics) IncrCounter(key []string, val float32) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.Counters == nil {
+		m.Counters = map[string]float32{}
+	}
+	m.Counters[strings.Join(key, ".")] += val
+}
+
+func (m *Metrics) SetGauge(key []string, val float32) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.Gauges == nil {
+		m.Gauges = map[string]float32{}
+	}
+	m.Gauges[strings.Join(key, ".")] = val
+}
+
+func (m *Metrics) MeasureSince(key []string, start time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.Measurements == nil {
+		m.Measurements = map[string]int{}
+	}
+	m.Measurements[strings.Join(key, ".")]++
+}
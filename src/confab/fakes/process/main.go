@@ -44,6 +44,11 @@ func main() {
 		log.Fatal("expecting command as first argment")
 	}
 
+	if data.Args[0] == "version" {
+		fmt.Fprintf(os.Stdout, "Consul v0.6.4\nConsul Protocol: 3 (Understands back to: 1)\n")
+		return
+	}
+
 	var configDir string
 	var recursors stringSlice
 	flagSet := flag.NewFlagSet("", flag.ExitOnError)
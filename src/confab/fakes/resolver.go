@@ -0,0 +1,62 @@
+package fakes
+
+import (
+	"errors"
+	"net"
+)
+
+type Resolver struct {
+	LookupHostCall struct {
+		CallCount int
+		Receives  struct {
+			Host string
+		}
+		Returns struct {
+			Addresses map[string][]string
+			Error     error
+		}
+	}
+
+	LookupSRVCall struct {
+		CallCount int
+		Receives  struct {
+			Name string
+		}
+		Returns struct {
+			Records map[string][]*net.SRV
+			Error   error
+		}
+	}
+}
+
+func (r *Resolver) LookupHost(host string) ([]string, error) {
+	r.LookupHostCall.CallCount++
+	r.LookupHostCall.Receives.Host = host
+
+	if r.LookupHostCall.Returns.Error != nil {
+		return nil, r.LookupHostCall.Returns.Error
+	}
+
+	addresses, ok := r.LookupHostCall.Returns.Addresses[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+
+	return addresses, nil
+}
+
+func (r *Resolver) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	r.LookupSRVCall.CallCount++
+	r.LookupSRVCall.Receives.Name = name
+
+	if r.LookupSRVCall.Returns.Error != nil {
+		return "", nil, r.LookupSRVCall.Returns.Error
+	}
+
+	records, ok := r.LookupSRVCall.Returns.Records[name]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+
+	return name, records, nil
+}
@@ -0,0 +1,68 @@
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+)
+
+type Runner struct {
+	sync.Mutex
+
+	StartCall struct {
+		CallCount int
+		Receives  struct {
+			Config  config.Config
+			Timeout confab.Timeout
+		}
+		Returns struct {
+			Errors []error
+		}
+	}
+
+	StopCall struct {
+		CallCount int
+		Returns   struct {
+			Error error
+		}
+	}
+}
+
+func (r *Runner) Start(cfg config.Config, timeout confab.Timeout) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.StartCall.Receives.Config = cfg
+	r.StartCall.Receives.Timeout = timeout
+
+	var err error
+	if r.StartCall.CallCount < len(r.StartCall.Returns.Errors) {
+		err = r.StartCall.Returns.Errors[r.StartCall.CallCount]
+	}
+	r.StartCall.CallCount++
+
+	return err
+}
+
+func (r *Runner) Stop() error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.StopCall.CallCount++
+	return r.StopCall.Returns.Error
+}
+
+func (r *Runner) StartCallCount() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.StartCall.CallCount
+}
+
+func (r *Runner) StopCallCount() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.StopCall.CallCount
+}
@@ -0,0 +1,30 @@
+package fakes
+
+import "sync"
+
+type TLSReloader struct {
+	sync.Mutex
+
+	ReloadTLSCall struct {
+		CallCount int
+		Returns   struct {
+			Reloaded bool
+			Error    error
+		}
+	}
+}
+
+func (r *TLSReloader) ReloadTLS() (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.ReloadTLSCall.CallCount++
+	return r.ReloadTLSCall.Returns.Reloaded, r.ReloadTLSCall.Returns.Error
+}
+
+func (r *TLSReloader) ReloadTLSCallCount() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.ReloadTLSCall.CallCount
+}
@@ -0,0 +1,44 @@
+package fakes
+
+import "github.com/cloudfoundry-incubator/consul-release/src/confab/certs"
+
+type TLSVerifier struct {
+	VerifyCall struct {
+		CallCount int
+		Receives  struct {
+			Files      certs.Files
+			ServerName string
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
+	ExpiriesCall struct {
+		CallCount int
+		Receives  struct {
+			CAFile    string
+			CertFiles []string
+		}
+		Returns struct {
+			Expiries []certs.Expiry
+			Error    error
+		}
+	}
+}
+
+func (v *TLSVerifier) Verify(files certs.Files, serverName string) error {
+	v.VerifyCall.CallCount++
+	v.VerifyCall.Receives.Files = files
+	v.VerifyCall.Receives.ServerName = serverName
+
+	return v.VerifyCall.Returns.Error
+}
+
+func (v *TLSVerifier) Expiries(caFile string, certFiles []string) ([]certs.Expiry, error) {
+	v.ExpiriesCall.CallCount++
+	v.ExpiriesCall.Receives.CAFile = caFile
+	v.ExpiriesCall.Receives.CertFiles = certFiles
+
+	return v.ExpiriesCall.Returns.Expiries, v.ExpiriesCall.Returns.Error
+}
@@ -0,0 +1,140 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// A gossip key is an AES-128 key encoded with standard base64, or an
+// AES-192 or AES-256 key encoded the same way and marked with KeyPrefix. Any
+// other value is a passphrase, which is turned into a key with
+// PBKDF2-HMAC-SHA1 using an empty salt and 20000 iterations. The derivation
+// is deterministic, so every node turns the same passphrase into the same
+// key, and it always produces 16-byte keys, which every consul version the
+// release has shipped understands. Unmarked base64 of 24 or 32 bytes is a
+// passphrase, as it always has been, so existing deployments keep their keys.
+const (
+	DerivationIterations = 20000
+	DerivedKeySize       = 16
+	DefaultKeySize       = 16
+	KeyPrefix            = "base64:"
+)
+
+var derivationSalt = []byte("")
+
+// KeySizes are the key lengths in bytes consul accepts.
+var KeySizes = []int{16, 24, 32}
+
+// Key returns the base64 encoded gossip key for a configured value, which is
+// either a key already or a passphrase.
+func Key(value string) string {
+	if IsKey(value) {
+		return strings.TrimPrefix(value, KeyPrefix)
+	}
+
+	return base64.StdEncoding.EncodeToString(derive(value))
+}
+
+// Keys returns the gossip key of each of the configured values.
+func Keys(values []string) []string {
+	var keys []string
+	for _, value := range values {
+		keys = append(keys, Key(value))
+	}
+
+	return keys
+}
+
+// IsKey reports whether the value is a base64 encoded 16-byte key, or a key
+// of one of the KeySizes marked with KeyPrefix, rather than a passphrase.
+func IsKey(value string) bool {
+	if strings.HasPrefix(value, KeyPrefix) {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, KeyPrefix))
+		return err == nil && validSize(len(decoded))
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	return err == nil && len(decoded) == DerivedKeySize
+}
+
+// Fingerprint identifies the key of a configured value without revealing
+// it, so keys can be told apart in logs and command output.
+func Fingerprint(value string) string {
+	return KeyFingerprint(Key(value))
+}
+
+// Fingerprints returns the fingerprint of each of the values.
+func Fingerprints(values []string) []string {
+	fingerprints := []string{}
+	for _, value := range values {
+		fingerprints = append(fingerprints, Fingerprint(value))
+	}
+
+	return fingerprints
+}
+
+// KeyFingerprint identifies a base64 encoded key as consul reports it. It is
+// the first 8 bytes of the SHA-256 of the key, hex encoded.
+func KeyFingerprint(key string) string {
+	decoded, _ := base64.StdEncoding.DecodeString(key)
+	sum := sha256.Sum256(decoded)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyFingerprints returns the fingerprint of each of the keys.
+func KeyFingerprints(keys []string) []string {
+	fingerprints := []string{}
+	for _, key := range keys {
+		fingerprints = append(fingerprints, KeyFingerprint(key))
+	}
+
+	return fingerprints
+}
+
+// Generate returns a new random key of the given size in bytes, read from
+// random, or from crypto/rand when random is nil. Keys larger than 16 bytes
+// carry KeyPrefix so they are used as they are rather than as a passphrase.
+func Generate(random io.Reader, size int) (string, error) {
+	if !validSize(size) {
+		return "", fmt.Errorf("key size must be one of 16, 24 or 32 bytes, got %d", size)
+	}
+
+	if random == nil {
+		random = rand.Reader
+	}
+
+	key := make([]byte, size)
+	if _, err := io.ReadFull(random, key); err != nil {
+		return "", err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(key)
+	if size != DerivedKeySize {
+		encoded = KeyPrefix + encoded
+	}
+
+	return encoded, nil
+}
+
+func derive(passphrase string) []byte {
+	return pbkdf2.Key([]byte(passphrase), derivationSalt, DerivationIterations, DerivedKeySize, sha1.New)
+}
+
+func validSize(size int) bool {
+	for _, keySize := range KeySizes {
+		if size == keySize {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,117 @@
+package keyring_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/keyring"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("no entropy")
+}
+
+var _ = Describe("Keyring", func() {
+	Describe("Key", func() {
+		It("derives a 16-byte key from a passphrase", func() {
+			Expect(keyring.Key("banana")).To(Equal("enqzXBmgKOy13WIGsmUk+g=="))
+		})
+
+		It("leaves 16-byte keys alone", func() {
+			Expect(keyring.Key("enqzXBmgKOy13WIGsmUk+g==")).To(Equal("enqzXBmgKOy13WIGsmUk+g=="))
+		})
+
+		It("uses larger keys marked with the key prefix as they are", func() {
+			Expect(keyring.Key("base64:AAECAwQFBgcICQoLDA0ODxAREhMUFRYX")).To(Equal("AAECAwQFBgcICQoLDA0ODxAREhMUFRYX"))
+			Expect(keyring.Key("base64:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=")).To(Equal("AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="))
+		})
+
+		It("keeps deriving unmarked 24 and 32-byte values as passphrases", func() {
+			Expect(keyring.IsKey("AAECAwQFBgcICQoLDA0ODxAREhMUFRYX")).To(BeFalse())
+			Expect(keyring.Key("AAECAwQFBgcICQoLDA0ODxAREhMUFRYX")).To(Equal("87w1IyDkLyPk8q3389qtpw=="))
+			Expect(keyring.IsKey("AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=")).To(BeFalse())
+			Expect(keyring.Key("AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=")).To(Equal("29/+QJRi4YzgVrToAEUa1g=="))
+		})
+
+		It("treats base64 of an unsupported size as a passphrase", func() {
+			key := keyring.Key("AAECAwQ=")
+			Expect(key).NotTo(Equal("AAECAwQ="))
+			Expect(keyring.IsKey(key)).To(BeTrue())
+
+			Expect(keyring.IsKey("base64:AAECAwQ=")).To(BeFalse())
+		})
+	})
+
+	Describe("Keys", func() {
+		It("returns the key of each value in order", func() {
+			Expect(keyring.Keys([]string{"banana", "base64:AAECAwQFBgcICQoLDA0ODxAREhMUFRYX"})).To(Equal([]string{
+				"enqzXBmgKOy13WIGsmUk+g==",
+				"AAECAwQFBgcICQoLDA0ODxAREhMUFRYX",
+			}))
+		})
+	})
+
+	Describe("Fingerprint", func() {
+		It("is the truncated sha256 of the key", func() {
+			Expect(keyring.Fingerprint("enqzXBmgKOy13WIGsmUk+g==")).To(Equal("99d43860f08c390d"))
+		})
+
+		It("is the same for a passphrase and the key derived from it", func() {
+			Expect(keyring.Fingerprint("banana")).To(Equal("99d43860f08c390d"))
+			Expect(keyring.Fingerprints([]string{"banana", "enqzXBmgKOy13WIGsmUk+g=="})).To(Equal([]string{
+				"99d43860f08c390d",
+				"99d43860f08c390d",
+			}))
+		})
+
+		It("fingerprints keys as consul reports them", func() {
+			Expect(keyring.KeyFingerprint("enqzXBmgKOy13WIGsmUk+g==")).To(Equal("99d43860f08c390d"))
+			Expect(keyring.KeyFingerprints([]string{"AAECAwQFBgcICQoLDA0ODxAREhMUFRYX"})).To(Equal([]string{
+				keyring.Fingerprint("base64:AAECAwQFBgcICQoLDA0ODxAREhMUFRYX"),
+			}))
+		})
+	})
+
+	Describe("Generate", func() {
+		It("reads a key of the given size", func() {
+			key, err := keyring.Generate(bytes.NewReader(make([]byte, 16)), 16)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal(base64.StdEncoding.EncodeToString(make([]byte, 16))))
+		})
+
+		It("marks larger keys with the key prefix", func() {
+			key, err := keyring.Generate(bytes.NewReader(make([]byte, 32)), 32)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal("base64:" + base64.StdEncoding.EncodeToString(make([]byte, 32))))
+			Expect(keyring.IsKey(key)).To(BeTrue())
+		})
+
+		It("uses crypto/rand by default", func() {
+			first, err := keyring.Generate(nil, keyring.DefaultKeySize)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keyring.IsKey(first)).To(BeTrue())
+
+			second, err := keyring.Generate(nil, keyring.DefaultKeySize)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second).NotTo(Equal(first))
+		})
+
+		Context("failure cases", func() {
+			It("rejects sizes consul does not accept", func() {
+				_, err := keyring.Generate(nil, 20)
+				Expect(err).To(MatchError("key size must be one of 16, 24 or 32 bytes, got 20"))
+			})
+
+			It("returns an error when the random source fails", func() {
+				_, err := keyring.Generate(failingReader{}, 16)
+				Expect(err).To(MatchError("no entropy"))
+			})
+		})
+	})
+})
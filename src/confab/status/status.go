@@ -0,0 +1,154 @@
+package status
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Status struct {
+	AgentUp         bool
+	AgentRestarts   int
+	LastStart       time.Time
+	LANMembers      int
+	LANServers      int
+	ExpectedServers int
+	Raft            bool
+	CommitIndex     int64
+	LastLogIndex    int64
+	KeyringKeys     int
+	EncryptStage    string
+	CollectError    string
+	Certificates    []Certificate
+}
+
+type Certificate struct {
+	File          string
+	CommonName    string
+	DaysRemaining int
+	Expired       bool
+}
+
+// Healthy reports whether the agent is running, the last collection
+// succeeded, the agent can see at least one server and none of its
+// certificates have expired.
+func (s Status) Healthy() (bool, string) {
+	for _, certificate := range s.Certificates {
+		if certificate.Expired {
+			return false, fmt.Sprintf("certificate %q in %s has expired", certificate.CommonName, certificate.File)
+		}
+	}
+
+	switch {
+	case !s.AgentUp:
+		return false, "agent is not running"
+	case s.CollectError != "":
+		return false, s.CollectError
+	case s.LANServers == 0:
+		return false, "no servers are alive in the LAN pool"
+	default:
+		return true, "ok"
+	}
+}
+
+// Tracker holds the latest status of the node and serves it over HTTP.
+type Tracker struct {
+	mutex  sync.RWMutex
+	status Status
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+func (t *Tracker) Update(update func(*Status)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	update(&t.status)
+}
+
+func (t *Tracker) Status() Status {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.status
+}
+
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/metrics":
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteMetrics(w, t.Status())
+	case "/healthz":
+		healthy, reason := t.Status().Healthy()
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintln(w, reason)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// WriteMetrics writes the status in the Prometheus text exposition format.
+func WriteMetrics(w io.Writer, s Status) {
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+		fmt.Fprintf(w, "%s %v\n", name, value)
+	}
+
+	metric("confab_agent_up", "gauge", "Whether the consul agent process is running.", boolValue(s.AgentUp))
+	metric("confab_agent_restarts_total", "counter", "Number of times confab restarted the consul agent.", s.AgentRestarts)
+
+	var lastStart int64
+	if !s.LastStart.IsZero() {
+		lastStart = s.LastStart.Unix()
+	}
+	metric("confab_last_start_timestamp_seconds", "gauge", "Time of the last successful agent start.", lastStart)
+
+	metric("confab_lan_members", "gauge", "Number of members in the LAN gossip pool.", s.LANMembers)
+	metric("confab_lan_servers", "gauge", "Number of alive servers in the LAN gossip pool.", s.LANServers)
+	metric("confab_expected_servers", "gauge", "Number of servers confab expects to find in the LAN gossip pool.", s.ExpectedServers)
+
+	if s.Raft {
+		metric("confab_raft_commit_index", "gauge", "Raft commit index reported by the agent.", s.CommitIndex)
+		metric("confab_raft_last_log_index", "gauge", "Raft last log index reported by the agent.", s.LastLogIndex)
+	}
+
+	metric("confab_keyring_keys", "gauge", "Number of keys installed in the LAN gossip keyring.", s.KeyringKeys)
+	if s.EncryptStage != "" {
+		fmt.Fprintln(w, "# HELP confab_gossip_encryption_stage Stage of the gossip encryption rollout the agent is configured for.")
+		fmt.Fprintln(w, "# TYPE confab_gossip_encryption_stage gauge")
+		fmt.Fprintf(w, "confab_gossip_encryption_stage{stage=\"%s\"} 1\n", labelValue(s.EncryptStage))
+	}
+
+	metric("confab_collect_errors", "gauge", "Whether the last status collection failed.", boolValue(s.CollectError != ""))
+
+	if len(s.Certificates) > 0 {
+		fmt.Fprintln(w, "# HELP confab_cert_expiry_days Whole days until the certificate expires, negative once expired.")
+		fmt.Fprintln(w, "# TYPE confab_cert_expiry_days gauge")
+		for _, certificate := range s.Certificates {
+			fmt.Fprintf(w, "confab_cert_expiry_days{file=\"%s\",common_name=\"%s\"} %d\n",
+				labelValue(certificate.File), labelValue(certificate.CommonName), certificate.DaysRemaining)
+		}
+	}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,151 @@
+package status_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/status"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracker", func() {
+	var (
+		tracker *status.Tracker
+		server  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		tracker = status.NewTracker()
+		server = httptest.NewServer(tracker)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+
+		return resp.StatusCode, string(body)
+	}
+
+	Describe("/metrics", func() {
+		It("exposes the status in the prometheus text format", func() {
+			tracker.Update(func(s *status.Status) {
+				s.AgentUp = true
+				s.AgentRestarts = 2
+				s.LastStart = time.Unix(1460000000, 0)
+				s.LANMembers = 5
+				s.LANServers = 3
+				s.ExpectedServers = 3
+				s.Raft = true
+				s.CommitIndex = 42
+				s.LastLogIndex = 43
+				s.KeyringKeys = 1
+				s.EncryptStage = "send"
+			})
+
+			code, body := get("/metrics")
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(body).To(ContainSubstring("# TYPE confab_agent_up gauge\nconfab_agent_up 1\n"))
+			Expect(body).To(ContainSubstring("# TYPE confab_agent_restarts_total counter\nconfab_agent_restarts_total 2\n"))
+			Expect(body).To(ContainSubstring("confab_last_start_timestamp_seconds 1460000000\n"))
+			Expect(body).To(ContainSubstring("confab_lan_members 5\n"))
+			Expect(body).To(ContainSubstring("confab_lan_servers 3\n"))
+			Expect(body).To(ContainSubstring("confab_expected_servers 3\n"))
+			Expect(body).To(ContainSubstring("confab_raft_commit_index 42\n"))
+			Expect(body).To(ContainSubstring("confab_raft_last_log_index 43\n"))
+			Expect(body).To(ContainSubstring("confab_keyring_keys 1\n"))
+			Expect(body).To(ContainSubstring("# TYPE confab_gossip_encryption_stage gauge\nconfab_gossip_encryption_stage{stage=\"send\"} 1\n"))
+			Expect(body).To(ContainSubstring("confab_collect_errors 0\n"))
+		})
+
+		It("exposes the days until each certificate expires", func() {
+			tracker.Update(func(s *status.Status) {
+				s.Certificates = []status.Certificate{
+					{File: "/certs/ca.crt", CommonName: "consul-ca", DaysRemaining: 300},
+					{File: "/certs/agent.crt", CommonName: `agent "1"`, DaysRemaining: -2, Expired: true},
+				}
+			})
+
+			_, body := get("/metrics")
+			Expect(body).To(ContainSubstring("# TYPE confab_cert_expiry_days gauge\n" +
+				"confab_cert_expiry_days{file=\"/certs/ca.crt\",common_name=\"consul-ca\"} 300\n" +
+				"confab_cert_expiry_days{file=\"/certs/agent.crt\",common_name=\"agent \\\"1\\\"\"} -2\n"))
+		})
+
+		It("omits raft metrics when the agent is not a server", func() {
+			_, body := get("/metrics")
+			Expect(body).NotTo(ContainSubstring("confab_raft_commit_index"))
+		})
+	})
+
+	Describe("/healthz", func() {
+		It("reports healthy when the agent is up and can see a server", func() {
+			tracker.Update(func(s *status.Status) {
+				s.AgentUp = true
+				s.LANServers = 1
+			})
+
+			code, body := get("/healthz")
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(body).To(Equal("ok\n"))
+		})
+
+		It("reports unhealthy when the agent is not running", func() {
+			code, body := get("/healthz")
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(body).To(Equal("agent is not running\n"))
+		})
+
+		It("reports unhealthy when status collection failed", func() {
+			tracker.Update(func(s *status.Status) {
+				s.AgentUp = true
+				s.LANServers = 1
+				s.CollectError = "members error"
+			})
+
+			code, body := get("/healthz")
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(body).To(Equal("members error\n"))
+		})
+
+		It("reports unhealthy when a certificate has expired", func() {
+			tracker.Update(func(s *status.Status) {
+				s.AgentUp = true
+				s.LANServers = 1
+				s.Certificates = []status.Certificate{
+					{File: "/certs/agent.crt", CommonName: "agent", DaysRemaining: -1, Expired: true},
+				}
+			})
+
+			code, body := get("/healthz")
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(body).To(Equal("certificate \"agent\" in /certs/agent.crt has expired\n"))
+		})
+
+		It("reports unhealthy when no servers are alive", func() {
+			tracker.Update(func(s *status.Status) {
+				s.AgentUp = true
+			})
+
+			code, body := get("/healthz")
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(body).To(Equal("no servers are alive in the LAN pool\n"))
+		})
+	})
+
+	It("returns 404 for unknown paths", func() {
+		code, _ := get("/unknown")
+		Expect(code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,94 @@
+package telemetry
+
+import (
+	"errors"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+)
+
+const defaultPrefix = "confab"
+
+// flushDelay gives the statsd and statsite sinks, which flush on an interval,
+// a chance to send buffered metrics before they are shut down.
+var flushDelay = 250 * time.Millisecond
+
+type shutdowner interface {
+	Shutdown()
+}
+
+type Metrics struct {
+	*metrics.Metrics
+	sinks []shutdowner
+}
+
+// New builds a metrics emitter that sends confab's own measurements to the
+// same sinks the agent is configured to use. When no sink is configured the
+// measurements are discarded.
+func New(cfg config.ConfigConsulAgentTelemetry) (*Metrics, error) {
+	var (
+		fanout metrics.FanoutSink
+		sinks  []shutdowner
+	)
+
+	for _, address := range []string{cfg.StatsdAddress, cfg.DogstatsdAddress} {
+		if address == "" {
+			continue
+		}
+
+		sink, err := metrics.NewStatsdSink(address)
+		if err != nil {
+			return nil, errors.New(err.Error())
+		}
+
+		fanout = append(fanout, sink)
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.StatsiteAddress != "" {
+		sink, err := metrics.NewStatsiteSink(cfg.StatsiteAddress)
+		if err != nil {
+			return nil, errors.New(err.Error())
+		}
+
+		fanout = append(fanout, sink)
+		sinks = append(sinks, sink)
+	}
+
+	var sink metrics.MetricSink = &metrics.BlackholeSink{}
+	if len(fanout) > 0 {
+		sink = fanout
+	}
+
+	prefix := cfg.ConfabPrefix
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+
+	metricsConfig := metrics.DefaultConfig(prefix)
+	metricsConfig.EnableHostname = false
+	metricsConfig.EnableRuntimeMetrics = false
+
+	m, err := metrics.New(metricsConfig, sink)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+
+	return &Metrics{
+		Metrics: m,
+		sinks:   sinks,
+	}, nil
+}
+
+// Shutdown flushes buffered metrics and closes the sinks.
+func (m *Metrics) Shutdown() {
+	if len(m.sinks) == 0 {
+		return
+	}
+
+	time.Sleep(flushDelay)
+	for _, sink := range m.sinks {
+		sink.Shutdown()
+	}
+}
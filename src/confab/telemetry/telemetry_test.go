@@ -0,0 +1,78 @@
+package telemetry_test
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/config"
+	"github.com/cloudfoundry-incubator/consul-release/src/confab/telemetry"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var listener *net.UDPConn
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	received := func() string {
+		var packets []string
+		buf := make([]byte, 65536)
+		for {
+			listener.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+			n, err := listener.Read(buf)
+			if err != nil {
+				break
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+
+		return strings.Join(packets, "")
+	}
+
+	It("emits metrics to the statsd address", func() {
+		metrics, err := telemetry.New(config.ConfigConsulAgentTelemetry{
+			StatsdAddress: listener.LocalAddr().String(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		metrics.IncrCounter([]string{"agent", "runs"}, 1)
+		metrics.SetGauge([]string{"agent", "members"}, 3)
+		metrics.Shutdown()
+
+		output := received()
+		Expect(output).To(ContainSubstring("confab.agent.runs:1.000000|c\n"))
+		Expect(output).To(ContainSubstring("confab.agent.members:3.000000|g\n"))
+	})
+
+	It("uses the configured prefix", func() {
+		metrics, err := telemetry.New(config.ConfigConsulAgentTelemetry{
+			DogstatsdAddress: listener.LocalAddr().String(),
+			ConfabPrefix:     "some-prefix",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		metrics.IncrCounter([]string{"agent", "runs"}, 1)
+		metrics.Shutdown()
+
+		Expect(received()).To(ContainSubstring("some-prefix.agent.runs:1.000000|c\n"))
+	})
+
+	It("discards metrics when no sink is configured", func() {
+		metrics, err := telemetry.New(config.ConfigConsulAgentTelemetry{})
+		Expect(err).NotTo(HaveOccurred())
+
+		metrics.IncrCounter([]string{"agent", "runs"}, 1)
+		metrics.Shutdown()
+	})
+})